@@ -0,0 +1,5 @@
+-- DropIndex
+DROP INDEX "TestResult_testCaseId_idx";
+
+-- CreateIndex
+CREATE INDEX "TestResult_testCaseId_createdAt_idx" ON "TestResult"("testCaseId", "createdAt");
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "TestRun" ADD COLUMN     "warnings" TEXT[] DEFAULT ARRAY[]::TEXT[];
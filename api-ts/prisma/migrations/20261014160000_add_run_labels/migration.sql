@@ -0,0 +1,14 @@
+-- CreateTable
+CREATE TABLE "RunLabel" (
+    "runId" TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    "value" TEXT NOT NULL,
+
+    CONSTRAINT "RunLabel_pkey" PRIMARY KEY ("runId","key")
+);
+
+-- CreateIndex
+CREATE INDEX "RunLabel_key_value_idx" ON "RunLabel"("key", "value");
+
+-- AddForeignKey
+ALTER TABLE "RunLabel" ADD CONSTRAINT "RunLabel_runId_fkey" FOREIGN KEY ("runId") REFERENCES "TestRun"("id") ON DELETE CASCADE ON UPDATE CASCADE;
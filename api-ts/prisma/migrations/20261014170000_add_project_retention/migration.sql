@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "Project" ADD COLUMN     "retentionDays" INTEGER,
+ADD COLUMN     "retentionMaxRuns" INTEGER;
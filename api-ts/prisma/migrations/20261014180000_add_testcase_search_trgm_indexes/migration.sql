@@ -0,0 +1,6 @@
+-- Trigram indexes so project search (ILIKE '%q%') on test cases stays fast
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS "TestCase_name_trgm_idx" ON "TestCase" USING GIN ("name" gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS "TestCase_externalId_trgm_idx" ON "TestCase" USING GIN ("externalId" gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS "TestCase_suiteName_trgm_idx" ON "TestCase" USING GIN ("suiteName" gin_trgm_ops);
@@ -0,0 +1,8 @@
+-- AlterTable
+ALTER TABLE "TestRun" ADD COLUMN "ciBuildUrl" TEXT;
+
+-- Commit SHAs are stored lowercase from now on
+UPDATE "TestRun" SET "commitSha" = lower("commitSha") WHERE "commitSha" <> lower("commitSha");
+
+-- ?commit= matches SHA prefixes (LIKE 'abc%'), which needs text_pattern_ops
+CREATE INDEX IF NOT EXISTS "TestRun_projectId_commitSha_idx" ON "TestRun" ("projectId", "commitSha" text_pattern_ops);
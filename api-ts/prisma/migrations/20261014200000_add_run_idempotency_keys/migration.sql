@@ -0,0 +1,16 @@
+-- CreateTable
+CREATE TABLE "RunIdempotencyKey" (
+    "projectId" TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    "runId" TEXT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "expiresAt" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "RunIdempotencyKey_pkey" PRIMARY KEY ("projectId","key")
+);
+
+-- CreateIndex
+CREATE INDEX "RunIdempotencyKey_expiresAt_idx" ON "RunIdempotencyKey"("expiresAt");
+
+-- AddForeignKey
+ALTER TABLE "RunIdempotencyKey" ADD CONSTRAINT "RunIdempotencyKey_runId_fkey" FOREIGN KEY ("runId") REFERENCES "TestRun"("id") ON DELETE CASCADE ON UPDATE CASCADE;
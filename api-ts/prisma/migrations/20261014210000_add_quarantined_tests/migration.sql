@@ -0,0 +1,27 @@
+-- CreateTable
+CREATE TABLE "QuarantinedTest" (
+    "id" TEXT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updatedAt" TIMESTAMP(3) NOT NULL,
+    "projectId" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "reason" TEXT,
+    "expiresAt" TIMESTAMP(3),
+
+    CONSTRAINT "QuarantinedTest_pkey" PRIMARY KEY ("id")
+);
+
+-- AlterTable
+ALTER TABLE "TestRun" ADD COLUMN "quarantinedCount" INTEGER NOT NULL DEFAULT 0;
+
+-- AlterTable
+ALTER TABLE "TestResult" ADD COLUMN "quarantined" BOOLEAN NOT NULL DEFAULT false;
+
+-- CreateIndex
+CREATE UNIQUE INDEX "QuarantinedTest_projectId_name_key" ON "QuarantinedTest"("projectId", "name");
+
+-- CreateIndex
+CREATE INDEX "QuarantinedTest_expiresAt_idx" ON "QuarantinedTest"("expiresAt");
+
+-- AddForeignKey
+ALTER TABLE "QuarantinedTest" ADD CONSTRAINT "QuarantinedTest_projectId_fkey" FOREIGN KEY ("projectId") REFERENCES "Project"("id") ON DELETE CASCADE ON UPDATE CASCADE;
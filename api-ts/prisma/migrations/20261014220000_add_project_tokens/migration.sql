@@ -0,0 +1,24 @@
+-- CreateTable
+CREATE TABLE "ProjectToken" (
+    "id" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "prefix" TEXT NOT NULL,
+    "hash" TEXT NOT NULL,
+    "scopes" TEXT[],
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "lastUsedAt" TIMESTAMP(3),
+    "expiresAt" TIMESTAMP(3),
+    "revokedAt" TIMESTAMP(3),
+    "projectId" TEXT NOT NULL,
+
+    CONSTRAINT "ProjectToken_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "ProjectToken_prefix_key" ON "ProjectToken"("prefix");
+
+-- CreateIndex
+CREATE INDEX "ProjectToken_projectId_idx" ON "ProjectToken"("projectId");
+
+-- AddForeignKey
+ALTER TABLE "ProjectToken" ADD CONSTRAINT "ProjectToken_projectId_fkey" FOREIGN KEY ("projectId") REFERENCES "Project"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+-- CreateIndex
+CREATE INDEX "TestRun_status_createdAt_idx" ON "TestRun"("status", "createdAt" DESC);
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "TestRun" ADD COLUMN "environment" JSONB;
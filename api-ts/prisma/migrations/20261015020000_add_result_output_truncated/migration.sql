@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "TestResult" ADD COLUMN "outputTruncated" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,121 @@
+import type { FastifyBaseLogger, FastifyRequest } from 'fastify';
+import { FakeClock } from '../src/lib/clock';
+import { requestBudgetMs } from '../src/lib/deadline';
+import type {
+	OutboundHttpClient,
+	OutboundRequest,
+} from '../src/lib/outboundHttp';
+import {
+	deliverWebhook,
+	signWebhook,
+	SIGNATURE_HEADER,
+	TIMESTAMP_HEADER,
+} from '../src/lib/webhooks';
+import { check, runSmoke } from './lib/smoke';
+
+const START = new Date('2026-01-01T00:00:00.000Z');
+
+// Deliveries log; nothing here reads it
+const silentLog = {
+	child: () => silentLog,
+	info() {},
+	warn() {},
+	error() {},
+} as unknown as FastifyBaseLogger;
+
+/** Just what requestBudgetMs reads off a request. */
+function fakeRequest(clock: FakeClock, deadline: number | null) {
+	return { deadline, server: { clock } } as unknown as FastifyRequest;
+}
+
+async function main() {
+	const clock = new FakeClock(START);
+	clock.advance(1_500);
+	check(
+		'advance moves the wall clock and the monotonic one',
+		clock.now().getTime() === START.getTime() + 1_500 &&
+			clock.monotonic() === 1_500,
+	);
+	clock.set(START);
+	check(
+		'set moves the wall clock alone (like an NTP step)',
+		clock.now().getTime() === START.getTime() && clock.monotonic() === 1_500,
+	);
+	let rejected = false;
+	try {
+		clock.advance(-1);
+	} catch (err) {
+		rejected = err instanceof RangeError;
+	}
+	check('advance refuses to go back', rejected);
+
+	const req = fakeRequest(clock, clock.monotonic() + 2_000);
+	check(
+		'budget: the cap when the deadline is further away',
+		requestBudgetMs(req, 500) === 500,
+	);
+	check('budget: cap 0 means what is left', requestBudgetMs(req, 0) === 2_000);
+	clock.advance(1_200);
+	check(
+		'budget: shrinks as the clock moves',
+		requestBudgetMs(req, 5_000) === 800,
+		String(requestBudgetMs(req, 5_000)),
+	);
+	clock.advance(5_000);
+	check(
+		'budget: 1 ms (not "no limit") once the deadline passed',
+		requestBudgetMs(req, 5_000) === 1,
+	);
+	check(
+		'budget: no deadline keeps the cap',
+		requestBudgetMs(fakeRequest(clock, null), 5_000) === 5_000,
+	);
+
+	// First attempt gets a 503; a minute passes before the retry
+	const webhookClock = new FakeClock(START);
+	const sent: OutboundRequest[] = [];
+	const http = {
+		async request(_url: string, req: OutboundRequest) {
+			sent.push(req);
+			if (sent.length > 1) return { status: 204 };
+			webhookClock.advance(60_000);
+			return { status: 503 };
+		},
+	} as unknown as OutboundHttpClient;
+	const secret = 'whsec_smoke';
+	const delivered = await deliverWebhook(
+		{ id: 'wh_1', url: 'https://ci.example.com/hook', secret },
+		'run.completed',
+		{ runId: 'run_1' },
+		{ attempts: 2, http, clock: webhookClock, log: silentLog },
+	);
+	const body = JSON.parse(sent[0]?.body ?? '{}');
+	const stamps = sent.map((req) => req.headers[TIMESTAMP_HEADER]);
+	const startSeconds = START.getTime() / 1000;
+	check(
+		'webhook: delivered on the retry',
+		delivered && sent.length === 2,
+		`${delivered} ${sent.length}`,
+	);
+	check(
+		"webhook: createdAt is the clock's time when the event was queued",
+		body.createdAt === START.toISOString(),
+		body.createdAt,
+	);
+	check(
+		"webhook: each attempt is stamped with the clock's time then",
+		stamps.join() === `${startSeconds},${startSeconds + 60}`,
+		stamps.join(),
+	);
+	check(
+		'webhook: the signature covers that timestamp',
+		sent.every(
+			(req) =>
+				req.headers[SIGNATURE_HEADER] ===
+				signWebhook(secret, req.headers[TIMESTAMP_HEADER], req.body ?? ''),
+		),
+	);
+
+}
+
+runSmoke(main);
@@ -0,0 +1,59 @@
+import { loadConfig, type AppConfig } from '../src/lib/config';
+import { PRODUCTION_ENV, check, finish } from './lib/smoke';
+
+function load(env: Record<string, string>): AppConfig {
+	return loadConfig({ ...PRODUCTION_ENV, ...env });
+}
+
+const dev = load({ TESTHUB_ENV: 'development' });
+const staging = load({ TESTHUB_ENV: 'staging' });
+const prod = load({ TESTHUB_ENV: 'production' });
+
+check(
+	'log level: debug in development, info in production',
+	dev.LOG_LEVEL === 'debug' && prod.LOG_LEVEL === 'info',
+	`${dev.LOG_LEVEL} / ${prod.LOG_LEVEL}`,
+);
+check(
+	'log format: text in development, json elsewhere',
+	dev.LOG_FORMAT === 'text' &&
+		staging.LOG_FORMAT === 'json' &&
+		prod.LOG_FORMAT === 'json',
+);
+check(
+	'HSTS: off in development only',
+	!dev.HSTS_ENABLED && staging.HSTS_ENABLED && prod.HSTS_ENABLED,
+);
+check(
+	'timeouts: stricter in production',
+	prod.REQUEST_TIMEOUT < dev.REQUEST_TIMEOUT &&
+		prod.TESTHUB_DB_POOL_TIMEOUT < staging.TESTHUB_DB_POOL_TIMEOUT &&
+		prod.WEBHOOK_TIMEOUT < staging.WEBHOOK_TIMEOUT,
+);
+
+// Empty counts as unset: only WEB_APP_URL, never "*" with credentials on
+const devCors = load({ TESTHUB_CORS_ALLOWED_ORIGINS: '' });
+check(
+	'CORS: no origins by default in development (WEB_APP_URL only)',
+	devCors.TESTHUB_CORS_ALLOWED_ORIGINS.length === 0,
+);
+
+let corsError = '';
+try {
+	load({ TESTHUB_ENV: 'production', TESTHUB_CORS_ALLOWED_ORIGINS: '*' });
+} catch (err) {
+	corsError = err instanceof Error ? err.message : String(err);
+}
+check('CORS: "*" rejected in production', corsError.includes('"*"'));
+
+const explicit = load({
+	TESTHUB_ENV: 'production',
+	LOG_LEVEL: 'debug',
+	WEBHOOK_TIMEOUT: '20s',
+});
+check(
+	'explicit values win over environment defaults',
+	explicit.LOG_LEVEL === 'debug' && explicit.WEBHOOK_TIMEOUT === 20_000,
+);
+
+finish();
@@ -0,0 +1,70 @@
+import { ConfigError, loadConfig } from '../src/lib/config';
+import { BASE_ENV, check, finish } from './lib/smoke';
+
+/** The issues loadConfig reports for `env`, or null if it loads. */
+function configIssues(env: Record<string, string>) {
+	try {
+		loadConfig({ ...BASE_ENV, ...env });
+		return null;
+	} catch (err) {
+		if (err instanceof ConfigError) return err.issues;
+		throw err;
+	}
+}
+
+// Another service's settings in the same environment
+const SHARED = {
+	TESTHUB_ADMIN_PORT: '9092',
+	OTHER_ADMIN_PORT: '9091',
+	OTHER_ENABLE_PPROF: 'true',
+};
+
+const own = loadConfig({ ...BASE_ENV, ...SHARED });
+check(
+	'no CONFIG_PREFIX: TESTHUB_* is read, OTHER_* ignored',
+	own.TESTHUB_ADMIN_PORT === 9092 && !own.TESTHUB_ENABLE_PPROF,
+	`${own.TESTHUB_ADMIN_PORT} ${own.TESTHUB_ENABLE_PPROF}`,
+);
+
+const other = loadConfig({ ...BASE_ENV, ...SHARED, CONFIG_PREFIX: 'OTHER' });
+check(
+	'CONFIG_PREFIX=OTHER: OTHER_* is read in place of TESTHUB_*',
+	other.TESTHUB_ADMIN_PORT === 9091 && other.TESTHUB_ENABLE_PPROF,
+	`${other.TESTHUB_ADMIN_PORT} ${other.TESTHUB_ENABLE_PPROF}`,
+);
+const ignored = loadConfig({
+	...BASE_ENV,
+	TESTHUB_ADMIN_PORT: '9092',
+	CONFIG_PREFIX: 'OTHER',
+});
+check(
+	'CONFIG_PREFIX=OTHER: a TESTHUB_* value alone is ignored',
+	ignored.TESTHUB_ADMIN_PORT === 0,
+	`${ignored.TESTHUB_ADMIN_PORT}`,
+);
+check(
+	'CONFIG_PREFIX=OTHER: unprefixed keys still apply',
+	other.DATABASE_URL === BASE_ENV.DATABASE_URL,
+);
+
+const badValue = configIssues({
+	CONFIG_PREFIX: 'OTHER',
+	OTHER_ADMIN_PORT: 'not-a-port',
+});
+check(
+	'an invalid value is reported under the name the operator used',
+	!!badValue?.some((issue) => issue.startsWith('OTHER_ADMIN_PORT')) &&
+		!badValue.some((issue) => issue.includes('TESTHUB_')),
+	JSON.stringify(badValue),
+);
+
+for (const prefix of ['other', 'OTHER_', '9LIVES', 'MY-SVC']) {
+	const issues = configIssues({ CONFIG_PREFIX: prefix });
+	check(
+		`CONFIG_PREFIX="${prefix}" is rejected`,
+		!!issues?.some((issue) => issue.startsWith('CONFIG_PREFIX is invalid')),
+		JSON.stringify(issues),
+	);
+}
+
+finish();
@@ -0,0 +1,49 @@
+import Fastify from 'fastify';
+import { poolCloser } from '../src/plugins/prisma';
+import { captureLines, check, runSmoke } from './lib/smoke';
+
+/** Stands in for a PrismaClient: counts disconnects, each taking `ms`. */
+function fakePool(ms: number) {
+	const pool = {
+		disconnects: 0,
+		async $disconnect() {
+			pool.disconnects++;
+			await new Promise((resolve) => setTimeout(resolve, ms));
+		},
+	};
+	return pool;
+}
+
+async function main() {
+	const { destination, lines, settled } = captureLines();
+	const { log } = Fastify({ logger: { level: 'info', stream: destination } });
+
+	const primary = fakePool(100);
+	const replica = fakePool(100);
+	const close = poolCloser([primary, replica], log);
+	// onClose and the shutdown timeout both asking while the first is running
+	const first = close();
+	const second = close();
+	check('a call during the close gets the same promise', first === second);
+	await Promise.all([first, second]);
+	await close();
+	await settled();
+	check(
+		'each pool is disconnected exactly once',
+		primary.disconnects === 1 && replica.disconnects === 1,
+		`primary ${primary.disconnects}, replica ${replica.disconnects}`,
+	);
+	const closedLines = lines.filter((l) => l.msg === 'database pools closed');
+	check(
+		'"database pools closed" is logged once, with both pools',
+		closedLines.length === 1 && closedLines[0].pools === 2,
+		JSON.stringify(closedLines),
+	);
+
+	const only = fakePool(0);
+	await poolCloser([only, null], log)();
+	check('no replica: only the primary is disconnected', only.disconnects === 1);
+
+}
+
+runSmoke(main);
@@ -0,0 +1,76 @@
+import { withDbRetry } from '../src/lib/dbRetry';
+import { check, runSmoke } from './lib/smoke';
+
+/** Shaped like a Prisma error: only `code` is looked at. */
+function prismaError(code: string) {
+	return Object.assign(new Error(`prisma ${code}`), { code });
+}
+
+/** A repository whose calls fail the way a restarting database does. */
+function fakeRepo() {
+	const calls = { flaky: 0, conflict: 0, down: 0 };
+	return {
+		calls,
+		name: 'fake',
+		async flaky() {
+			if (calls.flaky++ === 0) throw prismaError('P1001');
+			return 'ok';
+		},
+		async conflict() {
+			calls.conflict++;
+			throw prismaError('P2002');
+		},
+		async down() {
+			calls.down++;
+			throw prismaError('P1017');
+		},
+	};
+}
+
+async function outcome(promise: Promise<unknown>) {
+	try {
+		return { value: await promise };
+	} catch (err) {
+		return { err: err as Error & { code?: string } };
+	}
+}
+
+async function main() {
+	const raw = fakeRepo();
+	const retried: string[] = [];
+	const repo = withDbRetry(raw, {
+		delayMs: 10,
+		onRetry: ({ method }) => retried.push(method),
+	});
+
+	const flaky = await outcome(repo.flaky());
+	check(
+		'P1001 on the first call: retried once and the result returned',
+		flaky.value === 'ok' && raw.calls.flaky === 2,
+		JSON.stringify({ flaky, calls: raw.calls.flaky }),
+	);
+	check(
+		'onRetry is told which method was retried',
+		retried.join() === 'flaky',
+		retried.join(),
+	);
+
+	const conflict = await outcome(repo.conflict());
+	check(
+		'a query error (P2002) surfaces at once, without a retry',
+		conflict.err?.code === 'P2002' && raw.calls.conflict === 1,
+		`calls ${raw.calls.conflict}`,
+	);
+
+	const down = await outcome(repo.down());
+	check(
+		'a second connection failure is thrown, not retried again',
+		down.err?.code === 'P1017' && raw.calls.down === 2,
+		`calls ${raw.calls.down}`,
+	);
+
+	check('non-function properties pass through', repo.name === 'fake');
+
+}
+
+runSmoke(main);
@@ -0,0 +1,60 @@
+import Fastify from 'fastify';
+import { loadConfig } from '../src/lib/config';
+import { adminListenerPlugin } from '../src/plugins/adminListener';
+import { debugRoutes } from '../src/routes/debug';
+import { BASE_ENV, check, runSmoke } from './lib/smoke';
+
+// With the pprof routes on
+const ENV = {
+	...BASE_ENV,
+	TESTHUB_ENABLE_PPROF: 'true',
+};
+
+const HEAP = { method: 'GET', url: '/debug/pprof/heap' } as const;
+const INDEX = { method: 'GET', url: '/debug/pprof/' } as const;
+
+/** The debug routes as the server registers them, and the admin split. */
+async function buildDebugApp(env: Record<string, string>) {
+	const app = Fastify();
+	app.decorate('config', loadConfig({ ...ENV, ...env }));
+	await app.register(adminListenerPlugin);
+	await app.register(debugRoutes);
+	await app.ready();
+	return app;
+}
+
+async function main() {
+	const single = await buildDebugApp({});
+	check(
+		'no TESTHUB_ADMIN_PORT: the heap route is not registered',
+		!single.hasRoute(HEAP),
+	);
+	check(
+		'no TESTHUB_ADMIN_PORT: the other pprof routes still are',
+		single.hasRoute(INDEX),
+	);
+	const missing = await single.inject(HEAP);
+	check(
+		'no TESTHUB_ADMIN_PORT: GET heap answers 404',
+		missing.statusCode === 404,
+		`${missing.statusCode}`,
+	);
+
+	const split = await buildDebugApp({ TESTHUB_ADMIN_PORT: '9091' });
+	check(
+		'TESTHUB_ADMIN_PORT set: the heap route is registered',
+		split.hasRoute(HEAP),
+	);
+	// inject() does not come through the admin listener, so it is "public"
+	const publicPort = await split.inject(HEAP);
+	check(
+		'TESTHUB_ADMIN_PORT set: the public port still answers 404',
+		publicPort.statusCode === 404,
+		`${publicPort.statusCode}`,
+	);
+
+	await single.close();
+	await split.close();
+}
+
+runSmoke(main);
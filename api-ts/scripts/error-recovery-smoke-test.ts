@@ -0,0 +1,78 @@
+import Fastify from 'fastify';
+import { loadConfig } from '../src/lib/config';
+import { buildLoggerOptions } from '../src/lib/logger';
+import { handleError } from '../src/lib/problem';
+import { PRODUCTION_ENV, captureLines, check, runSmoke } from './lib/smoke';
+
+const SECRET_DETAIL = 'connection to db.internal:5432 refused';
+
+/** An app with the server's logger and error handler, logging into `lines`. */
+async function buildRecoveryApp(env: Record<string, string>) {
+	const config = loadConfig({ ...PRODUCTION_ENV, ...env });
+	const { destination, lines, settled } = captureLines();
+
+	const app = Fastify({
+		logger: buildLoggerOptions({ ...config, LOG_FORMAT: 'json' }, destination),
+	});
+	app.decorate('config', config);
+	app.setErrorHandler(handleError);
+	app.get('/throws', () => {
+		throw new Error(SECRET_DETAIL);
+	});
+	app.get('/rejects', async () => {
+		await Promise.resolve();
+		throw new TypeError(SECRET_DETAIL);
+	});
+	await app.ready();
+	return { app, lines, settled };
+}
+
+async function main() {
+	const prod = await buildRecoveryApp({ TESTHUB_ENV: 'production' });
+	for (const path of ['/throws', '/rejects']) {
+		const res = await prod.app.inject({ method: 'GET', url: path });
+		const body = res.json();
+		check(
+			`production ${path}: 500 problem+json`,
+			res.statusCode === 500 &&
+				String(res.headers['content-type']).startsWith(
+					'application/problem+json',
+				) &&
+				body.detail === 'internal server error',
+			res.body,
+		);
+		check(
+			`production ${path}: the error message stays out of the body`,
+			!res.body.includes(SECRET_DETAIL),
+		);
+	}
+	await prod.settled();
+	const logged = prod.lines.filter((line) => line.msg === 'unhandled error');
+	check(
+		'production: each failure is logged with its message and stack',
+		logged.length === 2 &&
+			logged.every(
+				(line) =>
+					line.level === 'error' &&
+					line.err?.message === SECRET_DETAIL &&
+					String(line.err?.stack).includes('error-recovery-smoke-test'),
+			),
+		JSON.stringify(logged),
+	);
+
+	const dev = await buildRecoveryApp({
+		TESTHUB_ENV: 'development',
+		TESTHUB_CORS_ALLOWED_ORIGINS: '',
+	});
+	const res = await dev.app.inject({ method: 'GET', url: '/throws' });
+	check(
+		'development: the message is shown to help debugging',
+		res.statusCode === 500 && res.json().detail === SECRET_DETAIL,
+		res.body,
+	);
+
+	await prod.app.close();
+	await dev.app.close();
+}
+
+runSmoke(main);
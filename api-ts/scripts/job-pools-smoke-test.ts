@@ -0,0 +1,54 @@
+import Fastify from 'fastify';
+import { loadConfig } from '../src/lib/config';
+import { jobsPlugin } from '../src/plugins/jobs';
+import { BASE_ENV, check, runSmoke } from './lib/smoke';
+
+// With pools small enough to fill
+const ENV = {
+	...BASE_ENV,
+	WORKER_POOL_SIZE: '1',
+	WORKER_QUEUE_SIZE: '2',
+	WEBHOOK_WORKER_POOL_SIZE: '1',
+	WEBHOOK_QUEUE_SIZE: '2',
+	WORKER_DRAIN_TIMEOUT: '5s',
+};
+
+async function main() {
+	const app = Fastify();
+	app.decorate('config', loadConfig(ENV));
+	await app.register(jobsPlugin);
+	await app.ready();
+
+	// Deliveries to a target that never answers: every worker busy, queue full
+	let release = () => {};
+	const stuck = new Promise<void>((resolve) => (release = resolve));
+	let accepted = 0;
+	while (app.webhookJobs.tryEnqueue('webhook', () => stuck)) accepted++;
+	check(
+		'webhook pool saturates (1 running, 2 queued)',
+		accepted === 3 && app.webhookJobs.active === 1,
+		`accepted ${accepted}`,
+	);
+
+	check('ingest queue still has room', app.jobs.hasCapacity());
+	const ingested = await new Promise<boolean>((resolve) => {
+		const queued = app.jobs.tryEnqueue('report ingest', async () => {
+			resolve(true);
+		});
+		if (!queued) resolve(false);
+	});
+	check('queued report ingest runs while deliveries are stuck', ingested);
+
+	release();
+	await app.close();
+	check(
+		'shutdown drains both pools',
+		!app.webhookJobs.queued &&
+			!app.webhookJobs.active &&
+			!app.jobs.queued &&
+			!app.jobs.active,
+	);
+
+}
+
+runSmoke(main);
@@ -0,0 +1,86 @@
+import fs from 'node:fs';
+import { tmpdir } from 'node:os';
+import path from 'node:path';
+import {
+	checkLogFile,
+	LogFileError,
+	ReopenableFileStream,
+} from '../src/lib/logger';
+import { check, runSmoke } from './lib/smoke';
+
+/** What `fn` writes to stderr (which the file stream falls back to). */
+async function captureStderr(fn: () => Promise<void>) {
+	const written: string[] = [];
+	const write = process.stderr.write;
+	process.stderr.write = ((chunk: string | Uint8Array, ...rest: unknown[]) => {
+		written.push(Buffer.from(chunk).toString('utf8'));
+		const callback = rest.find((arg) => typeof arg === 'function');
+		if (callback) (callback as () => void)();
+		return true;
+	}) as typeof process.stderr.write;
+	try {
+		await fn();
+	} finally {
+		process.stderr.write = write;
+	}
+	return written.join('');
+}
+
+async function main() {
+	const dir = fs.mkdtempSync(path.join(tmpdir(), 'testhub-log-'));
+	const missingDir = path.join(dir, 'not-yet');
+	const logPath = path.join(missingDir, 'api.log');
+
+	let startupError: unknown;
+	try {
+		checkLogFile({ LOG_FILE: logPath });
+	} catch (err) {
+		startupError = err;
+	}
+	check(
+		'startup: a LOG_FILE in a missing directory fails with a clear message',
+		startupError instanceof LogFileError &&
+			startupError.message ===
+				`LOG_FILE is invalid: ${logPath}: directory does not exist`,
+		String(startupError),
+	);
+	let okError: unknown;
+	try {
+		checkLogFile({ LOG_FILE: path.join(dir, 'ok.log') });
+	} catch (err) {
+		okError = err;
+	}
+	check('startup: a writable LOG_FILE passes', okError === undefined);
+
+	// Past the startup check, e.g. the directory removed while running
+	const stream = new ReopenableFileStream(logPath);
+	const stderr = await captureStderr(async () => {
+		stream.write('{"msg":"first"}\n');
+		stream.write('{"msg":"second"}\n');
+		await stream.flush();
+	});
+	check(
+		'a failing file is reported once on stderr, without crashing',
+		stderr.split('logging to stderr until it is reopened').length === 2,
+		stderr,
+	);
+	check(
+		'lines logged meanwhile go to stderr',
+		stderr.includes('"first"') && stderr.includes('"second"'),
+		stderr,
+	);
+
+	fs.mkdirSync(missingDir);
+	await stream.reopen();
+	stream.write('{"msg":"third"}\n');
+	await stream.flush();
+	check(
+		'after a successful reopen lines go to the file again',
+		fs.readFileSync(logPath, 'utf8') === '{"msg":"third"}\n',
+	);
+
+	stream.end();
+	fs.rmSync(dir, { recursive: true, force: true });
+}
+
+runSmoke(main);
@@ -0,0 +1,117 @@
+import Fastify from 'fastify';
+import type { AppConfig } from '../src/lib/config';
+import { buildLoggerOptions, REDACTED } from '../src/lib/logger';
+import { captureLines, check, runSmoke } from './lib/smoke';
+
+type LoggerConfig = Pick<
+	AppConfig,
+	'LOG_FORMAT' | 'LOG_LEVEL' | 'LOG_FILE' | 'LOG_REDACT_KEYS'
+>;
+
+/** A Fastify logger built like the server's, writing into `lines`. */
+function captureLogger(config: Partial<LoggerConfig> = {}) {
+	const { destination, lines, settled } = captureLines();
+	const app = Fastify({
+		logger: buildLoggerOptions(
+			{
+				LOG_FORMAT: 'json',
+				LOG_LEVEL: 'info',
+				LOG_FILE: undefined,
+				LOG_REDACT_KEYS: [],
+				...config,
+			},
+			destination,
+		),
+	});
+	return { log: app.log, lines, settled };
+}
+
+async function main() {
+	const info = captureLogger({ LOG_LEVEL: 'info' });
+	// Touching any of these would mean a filtered call still did work
+	let formatted = 0;
+	const costly = {
+		toString() {
+			formatted++;
+			return 'costly';
+		},
+		toJSON() {
+			formatted++;
+			return 'costly';
+		},
+	};
+	info.log.debug({ costly }, 'debug detail %s', costly);
+	info.log.info('kept');
+	info.log.warn('careful');
+	await info.settled();
+	check(
+		'level info: debug produces no output',
+		info.lines.every((line) => line.level !== 'debug'),
+		JSON.stringify(info.lines),
+	);
+	check('level info: a filtered call does not format its args', !formatted);
+	check(
+		'level info: info and warn are written, with string levels',
+		info.lines.map((line) => line.level).join(',') === 'info,warn',
+	);
+
+	const warn = captureLogger({ LOG_LEVEL: 'warn' });
+	warn.log.info('dropped');
+	warn.log.warn('careful');
+	warn.log.error('broken');
+	await warn.settled();
+	check(
+		'level warn: info is dropped, warn and error are kept',
+		warn.lines.map((line) => line.msg).join(',') === 'careful,broken',
+	);
+
+	const debug = captureLogger({ LOG_LEVEL: 'debug' });
+	debug.log.debug('debug detail');
+	await debug.settled();
+	check('level debug: debug is written', debug.lines.length === 1);
+
+	const redacting = captureLogger({ LOG_REDACT_KEYS: ['X-Tenant-Key'] });
+	redacting.log.info(
+		{
+			user: 'ada',
+			Password: 'sekret-password',
+			headers: { Authorization: 'Bearer sekret', accept: 'application/json' },
+			attempts: [{ token: 'sekret-token' }],
+			'x-tenant-key': 'sekret-tenant',
+		},
+		'login',
+	);
+	redacting.log.child({ apiKey: 'sekret-key' }).info('child');
+	await redacting.settled();
+	const [login, child] = redacting.lines as Record<string, any>[];
+	check(
+		'redaction: a "Password" field is masked, whatever its case',
+		login?.Password === REDACTED,
+		JSON.stringify(login),
+	);
+	check(
+		'redaction: nested and array fields are masked too',
+		login?.headers?.Authorization === REDACTED &&
+			login?.attempts?.[0]?.token === REDACTED,
+	);
+	check(
+		'redaction: other fields pass through unchanged',
+		login?.user === 'ada' && login?.headers?.accept === 'application/json',
+	);
+	check(
+		'redaction: LOG_REDACT_KEYS adds names (case-insensitive)',
+		login?.['x-tenant-key'] === REDACTED,
+	);
+	check(
+		'redaction: child logger bindings are masked',
+		child?.apiKey === REDACTED,
+		JSON.stringify(child),
+	);
+	check(
+		'redaction: no secret value reaches the output',
+		!JSON.stringify(redacting.lines).includes('sekret'),
+	);
+
+}
+
+runSmoke(main);
@@ -0,0 +1,97 @@
+import { mkdtempSync, writeFileSync } from 'node:fs';
+import { tmpdir } from 'node:os';
+import path from 'node:path';
+import sensible from '@fastify/sensible';
+import Fastify from 'fastify';
+import { loadConfig } from '../src/lib/config';
+import { loadRawEnv } from '../src/lib/envFile';
+import { configReloadPlugin } from '../src/plugins/configReload';
+import { rateLimitPlugin } from '../src/plugins/rateLimit';
+import { BASE_ENV, check, runSmoke } from './lib/smoke';
+
+// A reload re-reads the env file; the process env (which wins) is left alone
+const envFile = path.join(mkdtempSync(path.join(tmpdir(), 'testhub-')), '.env');
+process.env.TESTHUB_ENV_FILE = envFile;
+
+function writeEnv(limits: { perSecond: number; burst: number }) {
+	const env = {
+		...BASE_ENV,
+		RATE_LIMIT_PER_SECOND: String(limits.perSecond),
+		RATE_LIMIT_BURST: String(limits.burst),
+	};
+	writeFileSync(
+		envFile,
+		Object.entries(env)
+			.map(([key, value]) => `${key}=${value}\n`)
+			.join(''),
+	);
+}
+
+async function main() {
+	writeEnv({ perSecond: 0, burst: 1 });
+	const app = Fastify();
+	app.decorate('config', loadConfig(loadRawEnv()));
+	await app.register(sensible);
+	await app.register(rateLimitPlugin);
+	await app.register(configReloadPlugin);
+	app.get('/ping', async () => ({ ok: true }));
+	await app.ready();
+
+	/** Status codes of `n` requests in a row from one client. */
+	const burst = async (n: number) => {
+		const codes: number[] = [];
+		for (let i = 0; i < n; i++) {
+			const res = await app.inject({ method: 'GET', url: '/ping' });
+			codes.push(res.statusCode);
+		}
+		return codes.join();
+	};
+
+	/** SIGHUP with new limits; resolves once the config has them. */
+	const reload = async (limits: { perSecond: number; burst: number }) => {
+		writeEnv(limits);
+		process.kill(process.pid, 'SIGHUP');
+		for (let waited = 0; waited < 2_000; waited += 20) {
+			const { RATE_LIMIT_PER_SECOND, RATE_LIMIT_BURST } = app.config;
+			if (
+				RATE_LIMIT_PER_SECOND === limits.perSecond &&
+				RATE_LIMIT_BURST === limits.burst
+			) {
+				return true;
+			}
+			await new Promise((resolve) => setTimeout(resolve, 20));
+		}
+		return false;
+	};
+
+	check('started at 0: nothing is limited', !(await burst(10)).includes('429'));
+
+	check(
+		'reload: 1/s with burst 2 is applied',
+		await reload({ perSecond: 1, burst: 2 }),
+	);
+	const limited = await burst(3);
+	check(
+		'after enabling on reload: the third request gets 429',
+		limited === '200,200,429',
+		limited,
+	);
+
+	await reload({ perSecond: 1, burst: 5 });
+	const raised = await burst(6);
+	check(
+		'after raising the burst: five pass, the sixth gets 429',
+		raised === '200,200,200,200,200,429',
+		raised,
+	);
+
+	await reload({ perSecond: 0, burst: 5 });
+	check(
+		'after disabling on reload: nothing is limited',
+		!(await burst(10)).includes('429'),
+	);
+
+	await app.close();
+}
+
+runSmoke(main);
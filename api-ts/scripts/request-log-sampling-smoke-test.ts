@@ -0,0 +1,85 @@
+import Fastify from 'fastify';
+import { loadConfig } from '../src/lib/config';
+import { buildLoggerOptions } from '../src/lib/logger';
+import {
+	inLogSample,
+	requestLoggingPlugin,
+} from '../src/plugins/requestLogging';
+import { BASE_ENV, captureLines, check, runSmoke } from './lib/smoke';
+
+// Logging 1 in 4 successful requests
+const ENV = {
+	...BASE_ENV,
+	REQUEST_LOG_SAMPLE_RATE: '4',
+};
+
+const REQUESTS = 40;
+
+async function main() {
+	const ids = Array.from({ length: 1_000 }, (_, i) => `req-${i}`);
+	const sampled = ids.filter((id) => inLogSample(id, 10)).length;
+	check(
+		'rate 10: about 1 in 10 request IDs are in the sample',
+		sampled >= 70 && sampled <= 130,
+		`${sampled} of ${ids.length}`,
+	);
+	check(
+		'the same request ID always gets the same answer',
+		ids.every((id) => inLogSample(id, 10) === inLogSample(id, 10)),
+	);
+	check(
+		'rate 1: every request is in the sample',
+		ids.every((id) => inLogSample(id, 1)),
+	);
+
+	const config = loadConfig(ENV);
+	const { destination, lines, settled } = captureLines();
+	let seq = 0;
+	const app = Fastify({
+		logger: buildLoggerOptions({ ...config, LOG_FORMAT: 'json' }, destination),
+		genReqId: () => `smoke-${++seq}`,
+	});
+	app.decorate('config', config);
+	await app.register(requestLoggingPlugin);
+	app.get('/ok', async () => ({ ok: true }));
+	app.get('/fail', async (_req, reply) => reply.code(404).send());
+	app.get('/health', async () => ({ ok: true }));
+	await app.ready();
+
+	const okIds: string[] = [];
+	for (let i = 0; i < REQUESTS; i++) {
+		await app.inject({ method: 'GET', url: '/ok' });
+		okIds.push(`smoke-${seq}`);
+	}
+	for (let i = 0; i < REQUESTS; i++) {
+		await app.inject({ method: 'GET', url: '/fail' });
+		await app.inject({ method: 'GET', url: '/health' });
+	}
+	await settled();
+	const logged = lines.filter((line) => line.msg === 'request completed');
+	const byPath = (path: string) => logged.filter((line) => line.path === path);
+
+	const expected = okIds.filter((id) => inLogSample(id, 4));
+	check(
+		'2xx: exactly the sampled request IDs are logged',
+		byPath('/ok')
+			.map((line) => line.reqId)
+			.join() === expected.join() &&
+			expected.length > 0 &&
+			expected.length < REQUESTS,
+		`${byPath('/ok').length} logged, ${expected.length} sampled`,
+	);
+	check(
+		'4xx: every request is logged despite the sample rate',
+		byPath('/fail').length === REQUESTS,
+		`${byPath('/fail').length} of ${REQUESTS}`,
+	);
+	check(
+		'REQUEST_LOG_SKIP_PATHS: /health is never logged',
+		byPath('/health').length === 0,
+	);
+
+	await app.close();
+}
+
+runSmoke(main);
@@ -0,0 +1,123 @@
+import http from 'node:http';
+import type { AddressInfo } from 'node:net';
+import Fastify, { type FastifyRequest } from 'fastify';
+import { systemClock } from '../src/lib/clock';
+import { loadConfig } from '../src/lib/config';
+import { buildLoggerOptions } from '../src/lib/logger';
+import { clockPlugin } from '../src/plugins/clock';
+import { requestTimeoutPlugin } from '../src/plugins/requestTimeout';
+import { BASE_ENV, captureLines, check, runSmoke } from './lib/smoke';
+
+// With a deadline short enough to wait for
+const ENV = {
+	...BASE_ENV,
+	REQUEST_TIMEOUT: '200ms',
+	REQUEST_TIMEOUT_EXEMPT_PATHS: '/stream,/follow',
+};
+
+// How long the slow handlers take when nothing stops them
+const SLOW_MS = 1_000;
+
+/** Resolves after `ms`, or as soon as the request's signal aborts. */
+function work(req: FastifyRequest, ms: number) {
+	return new Promise<void>((resolve) => {
+		const timer = setTimeout(resolve, ms);
+		req.abortSignal.addEventListener('abort', () => {
+			clearTimeout(timer);
+			resolve();
+		});
+	});
+}
+
+async function main() {
+	const config = loadConfig(ENV);
+	const { destination, lines, settled } = captureLines();
+	const app = Fastify({
+		logger: buildLoggerOptions({ ...config, LOG_FORMAT: 'json' }, destination),
+	});
+	app.decorate('config', config);
+	await app.register(clockPlugin, { clock: systemClock });
+	await app.register(requestTimeoutPlugin);
+
+	const seen: { signal?: AbortSignal; deadline?: number | null } = {};
+	app.get('/slow', async (req, reply) => {
+		seen.signal = req.abortSignal;
+		seen.deadline = req.deadline;
+		await work(req, SLOW_MS);
+		return reply;
+	});
+	app.get('/stream', async (req) => {
+		seen.deadline = req.deadline;
+		await work(req, 400);
+		return { done: true };
+	});
+	// Exempt, so only the client going away can stop it
+	let followStarted = () => {};
+	const following = new Promise<void>((resolve) => (followStarted = resolve));
+	app.get('/follow', async (req) => {
+		seen.signal = req.abortSignal;
+		followStarted();
+		await work(req, SLOW_MS * 5);
+		return { done: true };
+	});
+	await app.ready();
+
+	const started = performance.now();
+	const res = await app.inject({ method: 'GET', url: '/slow' });
+	const tookMs = performance.now() - started;
+	check(
+		'slow handler: 503 "request timeout" once REQUEST_TIMEOUT passes',
+		res.statusCode === 503 && res.json().detail === 'request timeout',
+		`${res.statusCode} ${res.body}`,
+	);
+	check(
+		'slow handler: answered at the deadline, not when it finished',
+		tookMs < SLOW_MS / 2,
+		`${Math.round(tookMs)}ms`,
+	);
+	check(
+		'slow handler: its abortSignal is aborted (the work is cancelled)',
+		!!seen.signal?.aborted &&
+			String((seen.signal.reason as Error)?.message) === 'request timeout',
+	);
+	check(
+		'slow handler: req.deadline was set',
+		typeof seen.deadline === 'number',
+	);
+
+	const exempt = await app.inject({ method: 'GET', url: '/stream' });
+	check(
+		'exempt path: runs past REQUEST_TIMEOUT without a deadline',
+		exempt.statusCode === 200 && seen.deadline === null,
+		`${exempt.statusCode} ${exempt.body}`,
+	);
+
+	// A real socket: inject() has no client that can hang up
+	seen.signal = undefined;
+	await app.listen({ port: 0, host: '127.0.0.1' });
+	const { port } = app.server.address() as AddressInfo;
+	const client = http.get(`http://127.0.0.1:${port}/follow`);
+	client.on('error', () => {});
+	await following;
+	const signal = seen.signal as AbortSignal | undefined;
+	const aborted = new Promise<boolean>((resolve) => {
+		setTimeout(() => resolve(false), SLOW_MS);
+		signal?.addEventListener('abort', () => resolve(true));
+	});
+	client.destroy();
+	check(
+		'client disconnect: the handler\'s abortSignal is aborted',
+		(await aborted) &&
+			String((signal?.reason as Error)?.message) === 'client disconnected',
+		String((signal?.reason as Error)?.message),
+	);
+	await settled();
+	check(
+		'client disconnect: "request aborted by client" is logged',
+		lines.some((line) => line.msg === 'request aborted by client'),
+	);
+
+	await app.close();
+}
+
+runSmoke(main);
@@ -215,7 +215,7 @@ function buildHeaders(): HeadersInit {
 }
 
 async function postJson<T>(path: string, body?: unknown): Promise<T> {
-	const res = await fetch(`${API_BASE}${path}`, {
+	const res = await fetch(`${API_BASE}/v1${path}`, {
 		method: 'POST',
 		headers: buildHeaders(),
 		body: body ? JSON.stringify(body) : undefined,
@@ -0,0 +1,73 @@
+import Fastify from 'fastify';
+import type { Server } from 'node:http';
+import { loadConfig } from '../src/lib/config';
+import { serverTimeoutOptions } from '../src/lib/serverTimeouts';
+import {
+	closeAdminServer,
+	startAdminServer,
+} from '../src/plugins/adminListener';
+import { BASE_ENV, check, runSmoke } from './lib/smoke';
+
+// With every timeout distinct
+const ENV = {
+	...BASE_ENV,
+	HEADERS_TIMEOUT: '2s',
+	READ_TIMEOUT: '7s',
+	WRITE_TIMEOUT: '11s',
+	IDLE_TIMEOUT: '13s',
+};
+
+function timeouts(server: Server) {
+	return {
+		headersTimeout: server.headersTimeout,
+		requestTimeout: server.requestTimeout,
+		writeTimeout: server.timeout,
+		keepAliveTimeout: server.keepAliveTimeout,
+	};
+}
+
+const EXPECTED = JSON.stringify({
+	headersTimeout: 2_000,
+	requestTimeout: 7_000,
+	writeTimeout: 11_000,
+	keepAliveTimeout: 13_000,
+});
+
+async function main() {
+	const config = loadConfig(ENV);
+	// Built the way buildApp and main() build the public server
+	const app = Fastify({ ...serverTimeoutOptions(config) });
+	app.decorate('config', config);
+	await app.ready();
+	app.server.headersTimeout = config.HEADERS_TIMEOUT;
+	check(
+		'public server: READ/WRITE/IDLE/HEADERS_TIMEOUT are applied',
+		JSON.stringify(timeouts(app.server)) === EXPECTED,
+		JSON.stringify(timeouts(app.server)),
+	);
+
+	const unbounded = loadConfig({
+		...ENV,
+		READ_TIMEOUT: '0',
+		IDLE_TIMEOUT: '0',
+	});
+	const options = serverTimeoutOptions(unbounded);
+	check(
+		'"0" is passed through as unbounded',
+		options.requestTimeout === 0 && options.keepAliveTimeout === 0,
+		JSON.stringify(options),
+	);
+
+	// Port 0 binds any free port; only the server's settings are inspected
+	const admin = await startAdminServer(app);
+	check(
+		'admin listener: the same limits as the public server',
+		JSON.stringify(timeouts(admin)) === EXPECTED,
+		JSON.stringify(timeouts(admin)),
+	);
+	await closeAdminServer(admin);
+
+	await app.close();
+}
+
+runSmoke(main);
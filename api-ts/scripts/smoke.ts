@@ -0,0 +1,47 @@
+import { spawnSync } from 'node:child_process';
+import { readdirSync } from 'node:fs';
+import path from 'node:path';
+import { fileURLToPath } from 'node:url';
+
+// Need a running API and database; run by hand (see README)
+const NEEDS_SERVER = new Set(['auth-smoke-test.ts']);
+
+// A script still running after this is counted as failed
+const SCRIPT_TIMEOUT_MS = 60_000;
+
+/**
+ * Runs every scripts/*-smoke-test.ts that works without a server, each in
+ * its own process, and exits 1 if any of them failed. Arguments narrow the
+ * run to scripts whose name contains one of them (`pnpm smoke logger`).
+ */
+function main() {
+	const dir = path.dirname(fileURLToPath(import.meta.url));
+	const filters = process.argv.slice(2);
+	const scripts = readdirSync(dir)
+		.filter((file) => file.endsWith('-smoke-test.ts'))
+		.filter((file) => !NEEDS_SERVER.has(file))
+		.filter((file) => !filters.length || filters.some((f) => file.includes(f)))
+		.sort();
+
+	const failed: string[] = [];
+	for (const file of scripts) {
+		process.stdout.write(`\n== ${file}\n`);
+		const res = spawnSync(
+			process.execPath,
+			['--import', 'tsx', path.join(dir, file)],
+			{ stdio: 'inherit', timeout: SCRIPT_TIMEOUT_MS },
+		);
+		if (res.status !== 0) failed.push(file);
+	}
+
+	const passed = scripts.length - failed.length;
+	process.stdout.write(
+		`\n${passed} of ${scripts.length} smoke scripts passed\n`,
+	);
+	if (failed.length) {
+		process.stdout.write(`failed: ${failed.join(', ')}\n`);
+		process.exit(1);
+	}
+}
+
+main();
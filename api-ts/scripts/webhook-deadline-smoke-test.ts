@@ -0,0 +1,133 @@
+import http from 'node:http';
+import type { AddressInfo } from 'node:net';
+import { setTimeout as delay } from 'node:timers/promises';
+import Fastify from 'fastify';
+import { systemClock } from '../src/lib/clock';
+import { loadConfig } from '../src/lib/config';
+import { OutboundHttpClient } from '../src/lib/outboundHttp';
+import { retryWithBackoff } from '../src/lib/retry';
+import { deliverWebhook } from '../src/lib/webhooks';
+import { clockPlugin } from '../src/plugins/clock';
+import { requestTimeoutPlugin } from '../src/plugins/requestTimeout';
+import { BASE_ENV, check, runSmoke } from './lib/smoke';
+
+// A handler delivering a webhook to a receiver that never answers: the
+// delivery has to end with the request's deadline, not WEBHOOK_TIMEOUT
+const REQUEST_TIMEOUT_MS = 300;
+const WEBHOOK_TIMEOUT_MS = 10_000;
+// Slack for timers and socket teardown
+const SLACK_MS = 250;
+
+async function main() {
+	let onReceiverClose: (at: number) => void = () => undefined;
+	const receiverClosed = new Promise<number>((resolve) => {
+		onReceiverClose = resolve;
+	});
+	const receiver = http.createServer((req) => {
+		// Read the body, never respond
+		req.resume();
+		req.socket.once('close', () => onReceiverClose(performance.now()));
+	});
+	await new Promise<void>((resolve) => {
+		receiver.listen(0, '127.0.0.1', resolve);
+	});
+	const { port } = receiver.address() as AddressInfo;
+
+	const app = Fastify({ logger: false });
+	app.decorate(
+		'config',
+		loadConfig({ ...BASE_ENV, REQUEST_TIMEOUT: `${REQUEST_TIMEOUT_MS}ms` }),
+	);
+	await app.register(clockPlugin, { clock: systemClock });
+	await app.register(requestTimeoutPlugin);
+
+	const client = new OutboundHttpClient({
+		timeoutMs: WEBHOOK_TIMEOUT_MS,
+		proxy: { noProxy: [] },
+		// The receiver runs on loopback, which deliveries refuse by default
+		allowedNetworks: ['127.0.0.1/32'],
+	});
+	// Set by the handler; an object so TS doesn't keep it narrowed to null
+	const handler: {
+		delivery: Promise<{ delivered: boolean; endedAt: number }> | null;
+	} = { delivery: null };
+	app.post('/ingest', async (req) => {
+		const delivery = deliverWebhook(
+			{ id: 'smoke', url: `http://127.0.0.1:${port}/hook`, secret: 'smoke' },
+			'run.completed',
+			{},
+			{
+				attempts: 3,
+				http: client,
+				clock: app.clock,
+				log: app.log,
+				signal: req.abortSignal,
+			},
+		).then((delivered) => ({ delivered, endedAt: performance.now() }));
+		handler.delivery = delivery;
+		await delivery;
+		return { ok: true };
+	});
+
+	const startedAt = performance.now();
+	const res = await app.inject({ method: 'POST', url: '/ingest' });
+	const respondedAt = performance.now();
+	if (!handler.delivery) throw new Error('handler did not run');
+	const outcome = await handler.delivery;
+	// The receiver sees the socket close a moment after the client drops it
+	const closedAt = await Promise.race([
+		receiverClosed,
+		delay(SLACK_MS).then(() => null),
+	]);
+
+	check(
+		'request answers 503 at its deadline',
+		res.statusCode === 503 &&
+			respondedAt - startedAt < REQUEST_TIMEOUT_MS + SLACK_MS,
+		`${res.statusCode} after ${Math.round(respondedAt - startedAt)}ms`,
+	);
+	check(
+		'slow webhook delivery is cancelled with the request',
+		!outcome.delivered &&
+			outcome.endedAt - startedAt < REQUEST_TIMEOUT_MS + SLACK_MS,
+		`ended after ${Math.round(outcome.endedAt - startedAt)}ms`,
+	);
+	check(
+		'receiver connection is closed, not left hanging',
+		closedAt != null && closedAt - startedAt < REQUEST_TIMEOUT_MS + SLACK_MS,
+	);
+
+	// The backoff wait is cut short too, and no attempt follows the abort
+	const controller = new AbortController();
+	let attempts = 0;
+	const retryStarted = performance.now();
+	const retried = retryWithBackoff(
+		async () => {
+			attempts++;
+			throw new Error('receiver responded 503');
+		},
+		{
+			attempts: 5,
+			initialDelayMs: 5_000,
+			maxDelayMs: 5_000,
+			signal: controller.signal,
+		},
+	).catch((err: Error) => err);
+	setTimeout(() => controller.abort(), 50);
+	const retryError = await retried;
+	const retryMs = performance.now() - retryStarted;
+	check(
+		'retry: an abort during the backoff ends it with the last error',
+		attempts === 1 &&
+			retryError instanceof Error &&
+			retryError.message === 'receiver responded 503' &&
+			retryMs < SLACK_MS * 2,
+		`${attempts} attempt(s) in ${Math.round(retryMs)}ms`,
+	);
+
+	await app.close();
+	receiver.close();
+	receiver.closeAllConnections();
+}
+
+runSmoke(main);
@@ -1,4 +1,5 @@
 import crypto from 'node:crypto';
+import type { IncomingHttpHeaders } from 'node:http';
 
 export type ParsedApiKey = { prefix: string; raw: string };
 
@@ -15,6 +16,25 @@ export function safeEqualHex(a: string, b: string): boolean {
 	return crypto.timingSafeEqual(bufA, bufB);
 }
 
+const BEARER_PATTERN = /^Bearer\s+(.+)$/i;
+
+/**
+ * The API key presented by the client: `x-api-key: <key>` or
+ * `Authorization: Bearer <key>` (x-api-key wins if both are sent).
+ * Returns null when neither header carries a value.
+ */
+export function readPresentedApiKey(
+	headers: IncomingHttpHeaders,
+): string | null {
+	// Fastify headers can be string | string[] | undefined
+	const header = headers['x-api-key'];
+	const apiKey = Array.isArray(header) ? header[0] : header;
+	if (apiKey) return apiKey;
+
+	const bearer = BEARER_PATTERN.exec(headers.authorization ?? '');
+	return bearer ? bearer[1].trim() : null;
+}
+
 /**
  * Expected format: "<prefix>.<secret>"
  * - prefix is stored in DB (lookup)
@@ -0,0 +1,163 @@
+import { createHash } from 'node:crypto';
+import fs from 'node:fs';
+import path from 'node:path';
+import { Transform, type Readable } from 'node:stream';
+import { pipeline } from 'node:stream/promises';
+import type { AppConfig } from './config';
+import { S3Client } from './s3';
+
+/** An upload already written to a local temp file. */
+export type StagedFile = {
+	path: string;
+	size: number;
+	sha256: string;
+	contentType: string;
+};
+
+export class ArtifactTooLargeError extends Error {
+	constructor(maxBytes: number) {
+		super(`artifact exceeds the ${maxBytes} byte limit`);
+		this.name = 'ArtifactTooLargeError';
+	}
+}
+
+/**
+ * Write `body` to `target` while counting and hashing it; fails with
+ * ArtifactTooLargeError as soon as more than `maxBytes` arrive.
+ */
+export async function stageFile(
+	body: Readable,
+	target: string,
+	maxBytes: number,
+	contentType: string,
+): Promise<StagedFile> {
+	const hash = createHash('sha256');
+	let size = 0;
+	const meter = new Transform({
+		transform(chunk: Buffer, _encoding, callback) {
+			size += chunk.length;
+			if (size > maxBytes) {
+				callback(new ArtifactTooLargeError(maxBytes));
+				return;
+			}
+			hash.update(chunk);
+			callback(null, chunk);
+		},
+	});
+	await pipeline(body, meter, fs.createWriteStream(target));
+	return { path: target, size, sha256: hash.digest('hex'), contentType };
+}
+
+export interface ArtifactStorage {
+	readonly kind: 'local' | 's3';
+	/** Store the staged file under `key` (the staged file may be moved). */
+	put(key: string, file: StagedFile): Promise<void>;
+	/** Stream the stored bytes; null if nothing is stored under `key`. */
+	get(key: string): Promise<Readable | null>;
+	/** No-op when the key does not exist. */
+	delete(key: string): Promise<void>;
+}
+
+export class LocalArtifactStorage implements ArtifactStorage {
+	readonly kind = 'local';
+	private readonly root: string;
+
+	constructor(root: string) {
+		this.root = path.resolve(root);
+	}
+
+	// Keys are generated server-side, but never let one escape the root
+	private resolve(key: string) {
+		const target = path.resolve(this.root, key);
+		if (!target.startsWith(this.root + path.sep)) {
+			throw new Error(`artifact key escapes storage root: ${key}`);
+		}
+		return target;
+	}
+
+	async put(key: string, file: StagedFile) {
+		const target = this.resolve(key);
+		await fs.promises.mkdir(path.dirname(target), { recursive: true });
+		try {
+			await fs.promises.rename(file.path, target);
+		} catch (err) {
+			// Temp dir on another filesystem
+			if ((err as NodeJS.ErrnoException).code !== 'EXDEV') throw err;
+			await fs.promises.copyFile(file.path, target);
+		}
+	}
+
+	async get(key: string) {
+		const target = this.resolve(key);
+		try {
+			await fs.promises.access(target, fs.constants.R_OK);
+		} catch {
+			return null;
+		}
+		return fs.createReadStream(target);
+	}
+
+	async delete(key: string) {
+		await fs.promises.rm(this.resolve(key), { force: true });
+	}
+}
+
+export class S3ArtifactStorage implements ArtifactStorage {
+	readonly kind = 's3';
+	private readonly client: S3Client;
+	private readonly prefix: string;
+
+	constructor(client: S3Client, prefix = '') {
+		this.client = client;
+		this.prefix = prefix.replace(/^\/+|\/+$/g, '');
+	}
+
+	private objectKey(key: string) {
+		return this.prefix ? `${this.prefix}/${key}` : key;
+	}
+
+	async put(key: string, file: StagedFile) {
+		await this.client.putObject(
+			this.objectKey(key),
+			fs.createReadStream(file.path),
+			file,
+		);
+	}
+
+	get(key: string) {
+		return this.client.getObject(this.objectKey(key));
+	}
+
+	delete(key: string) {
+		return this.client.deleteObject(this.objectKey(key));
+	}
+}
+
+export function createArtifactStorage(
+	config: Pick<
+		AppConfig,
+		| 'ARTIFACT_STORAGE'
+		| 'ARTIFACT_DIR'
+		| 'ARTIFACT_S3_BUCKET'
+		| 'ARTIFACT_S3_REGION'
+		| 'ARTIFACT_S3_ENDPOINT'
+		| 'ARTIFACT_S3_PREFIX'
+		| 'AWS_ACCESS_KEY_ID'
+		| 'AWS_SECRET_ACCESS_KEY'
+		| 'AWS_SESSION_TOKEN'
+	>,
+): ArtifactStorage {
+	if (config.ARTIFACT_STORAGE === 'local') {
+		return new LocalArtifactStorage(config.ARTIFACT_DIR);
+	}
+	// loadConfig guarantees bucket and credentials for s3
+	const client = new S3Client({
+		bucket: config.ARTIFACT_S3_BUCKET!,
+		region: config.ARTIFACT_S3_REGION,
+		endpoint: config.ARTIFACT_S3_ENDPOINT,
+		accessKeyId: config.AWS_ACCESS_KEY_ID!,
+		secretAccessKey: config.AWS_SECRET_ACCESS_KEY!,
+		sessionToken: config.AWS_SESSION_TOKEN,
+	});
+	return new S3ArtifactStorage(client, config.ARTIFACT_S3_PREFIX);
+}
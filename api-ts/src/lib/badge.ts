@@ -0,0 +1,53 @@
+import { escapeXmlAttr, escapeXmlText } from './xml';
+import type { RunStatus } from '../repositories/types';
+
+export type BadgeStatus = 'passing' | 'failing' | 'unknown';
+
+const BADGE_COLORS: Record<BadgeStatus, string> = {
+	passing: '#4c1',
+	failing: '#e05d44',
+	unknown: '#9f9f9f',
+};
+
+/** What the badge says for the status of the latest finished run. */
+export function badgeStatus(status: RunStatus | null): BadgeStatus {
+	if (status === 'COMPLETED') return 'passing';
+	if (status === 'FAILED') return 'failing';
+	return 'unknown';
+}
+
+// Verdana 11px averages about 6.5px per character; 5px padding each side
+function segmentWidth(text: string) {
+	return Math.ceil(text.length * 6.5) + 10;
+}
+
+/**
+ * A flat two-part badge ("tests | passing") in the usual README style:
+ * grey label on the left, status color on the right, with a text shadow.
+ */
+export function renderBadge(label: string, status: BadgeStatus) {
+	const left = segmentWidth(label);
+	const right = segmentWidth(status);
+	const width = left + right;
+	const title = escapeXmlAttr(`${label}: ${status}`);
+	const text = (value: string, x: number) =>
+		`<text x="${x}" y="15" fill="#010101" fill-opacity=".3">${escapeXmlText(value)}</text>` +
+		`<text x="${x}" y="14">${escapeXmlText(value)}</text>`;
+
+	return [
+		`<svg xmlns="http://www.w3.org/2000/svg" width="${width}" height="20" role="img" aria-label="${title}">`,
+		`<title>${title}</title>`,
+		'<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>',
+		`<clipPath id="r"><rect width="${width}" height="20" rx="3" fill="#fff"/></clipPath>`,
+		'<g clip-path="url(#r)">',
+		`<rect width="${left}" height="20" fill="#555"/>`,
+		`<rect x="${left}" width="${right}" height="20" fill="${BADGE_COLORS[status]}"/>`,
+		`<rect width="${width}" height="20" fill="url(#s)"/>`,
+		'</g>',
+		'<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">',
+		text(label, left / 2),
+		text(status, left + right / 2),
+		'</g>',
+		'</svg>',
+	].join('');
+}
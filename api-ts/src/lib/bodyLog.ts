@@ -0,0 +1,62 @@
+import { redactFields } from './logger';
+
+const JSON_TYPE = /^application\/(?:[\w.+-]+\+)?json\b/i;
+const TEXT_TYPE =
+	/^(?:text\/|application\/(?:[\w.+-]+\+)?(?:json|xml|x-tap|x-www-form-urlencoded)\b)/i;
+
+function isStream(value: unknown) {
+	return (
+		!!value &&
+		typeof value === 'object' &&
+		typeof (value as { pipe?: unknown }).pipe === 'function'
+	);
+}
+
+/** `text` cut to `maxBytes` of UTF-8, noting the full size when cut. */
+function capBytes(text: string, maxBytes: number) {
+	const bytes = Buffer.byteLength(text);
+	if (bytes <= maxBytes) return text;
+	const head = Buffer.from(text).subarray(0, maxBytes).toString();
+	return `${head}... (${bytes} bytes)`;
+}
+
+/**
+ * A request or response body as a log string, at most `maxBytes` (plus a
+ * size note); undefined when there is none. JSON (a parsed request body or
+ * a JSON payload) has the `redactKeys` fields masked before it is cut.
+ * Other text is logged as-is, so secrets inside XML/TAP are not masked.
+ * Streams and binary bodies are described, never read: the handler (or
+ * the client) still gets every byte.
+ */
+export function loggableBody(
+	body: unknown,
+	contentType: string | undefined,
+	opts: { maxBytes: number; redactKeys: ReadonlySet<string> },
+): string | undefined {
+	if (body == null || body === '') return undefined;
+	if (isStream(body)) return '[stream]';
+
+	const type = contentType ?? '';
+	let text: string;
+	if (Buffer.isBuffer(body)) {
+		if (!TEXT_TYPE.test(type)) return `[binary, ${body.length} bytes]`;
+		text = body.toString();
+	} else if (typeof body === 'string') {
+		text = body;
+	} else {
+		// Already parsed (JSON request bodies)
+		return capBytes(
+			JSON.stringify(redactFields(body, opts.redactKeys)),
+			opts.maxBytes,
+		);
+	}
+
+	if (JSON_TYPE.test(type)) {
+		try {
+			text = JSON.stringify(redactFields(JSON.parse(text), opts.redactKeys));
+		} catch {
+			// Not actually JSON: logged as sent
+		}
+	}
+	return capBytes(text, opts.maxBytes);
+}
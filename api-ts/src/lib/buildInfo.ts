@@ -0,0 +1,29 @@
+import { DEFAULT_CONFIG_PREFIX } from './config';
+
+export type BuildInfo = {
+	version: string;
+	commit: string;
+	buildTime: string;
+};
+
+const UNSET = 'dev';
+
+/**
+ * Build metadata injected by the build/deploy step, e.g.
+ *   TESTHUB_VERSION=0.6.0 TESTHUB_COMMIT=$(git rev-parse --short HEAD) \
+ *   TESTHUB_BUILD_TIME=$(date -u +%FT%TZ) pnpm start
+ * (with CONFIG_PREFIX set, <PREFIX>_VERSION and so on). Each field falls
+ * back to "dev" so local runs still return a stable shape.
+ */
+export function readBuildInfo(env: NodeJS.ProcessEnv = process.env): BuildInfo {
+	// CONFIG_PREFIX is validated with the rest of the config at startup
+	const prefix = env.CONFIG_PREFIX?.trim() || DEFAULT_CONFIG_PREFIX;
+	return {
+		version: env[`${prefix}_VERSION`] || UNSET,
+		commit: env[`${prefix}_COMMIT`] || UNSET,
+		buildTime: env[`${prefix}_BUILD_TIME`] || UNSET,
+	};
+}
+
+// Read once at startup; these never change for the life of the process
+export const buildInfo: Readonly<BuildInfo> = Object.freeze(readBuildInfo());
@@ -0,0 +1,75 @@
+import net from 'node:net';
+import type { FastifyRequest } from 'fastify';
+import type { AppConfig } from './config';
+
+type ProxyConfig = Pick<AppConfig, 'TRUST_PROXY' | 'TRUSTED_PROXIES'>;
+
+/** "::ffff:10.0.0.1" -> "10.0.0.1"; other addresses unchanged. */
+export function unmapIpv4(address: string) {
+	if (!address?.startsWith('::ffff:')) return address;
+	const v4 = address.slice(7);
+	return net.isIPv4(v4) ? v4 : address;
+}
+
+/**
+ * "10.0.0.0/8", "2001:db8::/32" or a single address into a BlockList;
+ * null when any entry is not an IP or CIDR.
+ */
+export function parseAddressList(entries: string[]) {
+	const list = new net.BlockList();
+	for (const entry of entries) {
+		const [address, bits, extra] = entry.split('/');
+		const family = net.isIP(address);
+		if (!family || extra !== undefined) return null;
+		const type = family === 4 ? 'ipv4' : 'ipv6';
+		if (bits === undefined) {
+			list.addAddress(address, type);
+			continue;
+		}
+		const prefix = Number(bits);
+		if (!/^\d{1,3}$/.test(bits) || prefix > (family === 4 ? 32 : 128)) {
+			return null;
+		}
+		list.addSubnet(address, prefix, type);
+	}
+	return list;
+}
+
+// Built once per TRUSTED_PROXIES array (config reloads don't replace it)
+const trustedLists = new WeakMap<string[], net.BlockList>();
+
+/** Whether a direct peer may set the client IP headers. */
+export function isTrustedProxy(config: ProxyConfig, peer: string) {
+	if (config.TRUST_PROXY) return true;
+	if (!config.TRUSTED_PROXIES.length) return false;
+
+	let list = trustedLists.get(config.TRUSTED_PROXIES);
+	if (!list) {
+		list = parseAddressList(config.TRUSTED_PROXIES) ?? new net.BlockList();
+		trustedLists.set(config.TRUSTED_PROXIES, list);
+	}
+	const address = unmapIpv4(peer);
+	const family = net.isIP(address);
+	return !!family && list.check(address, family === 4 ? 'ipv4' : 'ipv6');
+}
+
+/**
+ * The client's IP for rate limits and logs. X-Forwarded-For is resolved by
+ * Fastify (`req.ip`, trustProxy set from the same config in buildApp): the
+ * rightmost address not added by a trusted proxy. Without it, X-Real-IP is
+ * used when the direct peer is trusted. Anything else gets the peer address,
+ * so headers from untrusted peers are ignored.
+ */
+export function clientIp(req: FastifyRequest) {
+	if (req.headers['x-forwarded-for']) return unmapIpv4(req.ip);
+
+	const config = req.server.config;
+	const peer = req.socket.remoteAddress;
+	// Unix socket peers have no address; only TRUST_PROXY covers them
+	const trusted = peer ? isTrustedProxy(config, peer) : config.TRUST_PROXY;
+	const realIp = req.headers['x-real-ip'];
+	if (trusted && typeof realIp === 'string' && net.isIP(realIp.trim())) {
+		return unmapIpv4(realIp.trim());
+	}
+	return unmapIpv4(req.ip);
+}
@@ -0,0 +1,48 @@
+/**
+ * Source of time for code whose behaviour depends on it (retention cutoffs,
+ * analytics windows, Idempotency-Key expiry, uptime), so a script can pin
+ * it with FakeClock instead of waiting on the real one.
+ */
+export interface Clock {
+	/** Wall-clock time. */
+	now(): Date;
+	/** Milliseconds on a monotonic timeline starting at process start. */
+	monotonic(): number;
+}
+
+/** The real clock; what the server uses unless told otherwise. */
+export const systemClock: Clock = {
+	now: () => new Date(),
+	monotonic: () => performance.now(),
+};
+
+/**
+ * A clock that only moves when told to: `advance` moves both timelines,
+ * `set` jumps the wall clock alone (like an NTP correction would).
+ */
+export class FakeClock implements Clock {
+	private wallMs: number;
+	private monotonicMs = 0;
+
+	constructor(start: Date | number = 0) {
+		this.wallMs = typeof start === 'number' ? start : start.getTime();
+	}
+
+	now() {
+		return new Date(this.wallMs);
+	}
+
+	monotonic() {
+		return this.monotonicMs;
+	}
+
+	advance(ms: number) {
+		if (ms < 0) throw new RangeError('a clock can only advance');
+		this.wallMs += ms;
+		this.monotonicMs += ms;
+	}
+
+	set(time: Date | number) {
+		this.wallMs = typeof time === 'number' ? time : time.getTime();
+	}
+}
@@ -0,0 +1,92 @@
+type Status = 'PASSED' | 'FAILED' | 'SKIPPED' | 'ERROR';
+
+export type ComparableResult = {
+	status: Status;
+	durationMs: number | null;
+	message: string | null;
+	testCase: {
+		id: string;
+		externalId: string;
+		name: string;
+		suiteName: string | null;
+	};
+};
+
+export type ComparedCase = {
+	testCaseId: string;
+	externalId: string;
+	name: string;
+	suiteName: string | null;
+	baseStatus: Status | null;
+	headStatus: Status | null;
+	message: string | null;
+};
+
+export type RunComparison = {
+	newlyFailing: ComparedCase[];
+	newlyPassing: ComparedCase[];
+	added: ComparedCase[];
+	removed: ComparedCase[];
+	unchangedCount: number;
+};
+
+const isFailing = (status: Status) => status === 'FAILED' || status === 'ERROR';
+
+// Cases are matched by suite + name (not externalId), so renaming a
+// reporter's id scheme does not show every test as added and removed
+const caseKey = (r: ComparableResult) =>
+	`${r.testCase.suiteName ?? ''}\u0000${r.testCase.name}`;
+
+function toCase(
+	r: ComparableResult,
+	base: ComparableResult | undefined,
+	head: ComparableResult | undefined,
+): ComparedCase {
+	return {
+		testCaseId: r.testCase.id,
+		externalId: r.testCase.externalId,
+		name: r.testCase.name,
+		suiteName: r.testCase.suiteName,
+		baseStatus: base?.status ?? null,
+		headStatus: head?.status ?? null,
+		message: head?.message ?? base?.message ?? null,
+	};
+}
+
+/**
+ * Diff two runs' results. `base` is the reference (e.g. the last green run),
+ * `head` the run being inspected. Either side may be empty.
+ */
+export function compareRuns(
+	base: ComparableResult[],
+	head: ComparableResult[],
+): RunComparison {
+	const baseByKey = new Map(base.map((r) => [caseKey(r), r]));
+	const headKeys = new Set<string>();
+	const out: RunComparison = {
+		newlyFailing: [],
+		newlyPassing: [],
+		added: [],
+		removed: [],
+		unchangedCount: 0,
+	};
+
+	for (const h of head) {
+		const key = caseKey(h);
+		headKeys.add(key);
+		const b = baseByKey.get(key);
+
+		if (!b) out.added.push(toCase(h, undefined, h));
+		else if (!isFailing(b.status) && isFailing(h.status)) {
+			out.newlyFailing.push(toCase(h, b, h));
+		} else if (isFailing(b.status) && h.status === 'PASSED') {
+			out.newlyPassing.push(toCase(h, b, h));
+		} else out.unchangedCount++;
+	}
+
+	for (const b of base) {
+		if (!headKeys.has(caseKey(b))) out.removed.push(toCase(b, b, undefined));
+	}
+
+	return out;
+}
@@ -0,0 +1,25 @@
+/**
+ * Opaque keyset cursor: the (createdAt, id) of the last row of a page,
+ * base64url-encoded. Paging by this pair (instead of an offset or the id
+ * alone) keeps pages stable while new rows are inserted.
+ */
+export type Cursor = { createdAt: Date; id: string };
+
+export function encodeCursor(row: Cursor): string {
+	return Buffer.from(`${row.createdAt.toISOString()}|${row.id}`).toString(
+		'base64url',
+	);
+}
+
+/** null when the value is not a cursor produced by encodeCursor. */
+export function decodeCursor(value: string): Cursor | null {
+	if (!/^[A-Za-z0-9_-]+$/.test(value)) return null;
+	const decoded = Buffer.from(value, 'base64url').toString('utf8');
+	const sep = decoded.indexOf('|');
+	if (sep === -1) return null;
+
+	const createdAt = new Date(decoded.slice(0, sep));
+	const id = decoded.slice(sep + 1);
+	if (Number.isNaN(createdAt.getTime()) || !id) return null;
+	return { createdAt, id };
+}
@@ -0,0 +1,53 @@
+import { retryWithBackoff } from './retry';
+
+/**
+ * Prisma codes for a lost or unreachable server: P1001 can't reach it,
+ * P1002 timed out reaching it, P1017 it closed the connection (e.g. a
+ * pooled connection left over from before a Postgres restart).
+ */
+const CONNECTION_ERROR_CODES = new Set(['P1001', 'P1002', 'P1017']);
+
+/**
+ * True for connection-level failures worth one retry. Query errors
+ * (constraint violations, bad SQL, pool timeouts) are not: retrying them
+ * gives the same answer or adds load.
+ */
+export function isTransientDbError(err: unknown) {
+	if (!err || typeof err !== 'object') return false;
+	const { code, errorCode } = err as { code?: unknown; errorCode?: unknown };
+	return (
+		CONNECTION_ERROR_CODES.has(String(code)) ||
+		CONNECTION_ERROR_CODES.has(String(errorCode))
+	);
+}
+
+export type DbRetryOptions = {
+	delayMs: number;
+	onRetry?: (info: { method: string; err: unknown }) => void;
+};
+
+/**
+ * Wrap every method of `target` so a transient connection error is retried
+ * once after `delayMs`; any other error (or a second failure) is thrown as
+ * is. Only for calls outside a transaction: a broken transaction can't be
+ * resumed by repeating one statement.
+ */
+export function withDbRetry<T extends object>(
+	target: T,
+	opts: DbRetryOptions,
+): T {
+	return new Proxy(target, {
+		get(obj, prop, receiver) {
+			const value = Reflect.get(obj, prop, receiver);
+			if (typeof value !== 'function') return value;
+			return (...args: unknown[]) =>
+				retryWithBackoff(() => Promise.resolve(value.apply(obj, args)), {
+					attempts: 2,
+					initialDelayMs: opts.delayMs,
+					maxDelayMs: opts.delayMs,
+					shouldRetry: isTransientDbError,
+					onRetry: ({ err }) => opts.onRetry?.({ method: String(prop), err }),
+				});
+		},
+	});
+}
@@ -0,0 +1,13 @@
+import type { FastifyRequest } from 'fastify';
+
+/**
+ * Timeout for work done on `req`'s behalf (a transaction): `capMs` cut to
+ * what is left before the request's deadline, so the work can't outlive
+ * the request (capMs 0 = no cap). A deadline that already passed leaves
+ * 1 ms, not 0 (which means "no limit" to most timeouts).
+ */
+export function requestBudgetMs(req: FastifyRequest, capMs: number) {
+	if (req.deadline == null) return capMs;
+	const left = Math.ceil(req.deadline - req.server.clock.monotonic());
+	return Math.max(1, capMs > 0 ? Math.min(capMs, left) : left);
+}
@@ -0,0 +1,121 @@
+import fs from 'node:fs';
+import { configPrefix } from './config';
+
+const KEY_PATTERN = /^[A-Za-z_][A-Za-z0-9_]*$/;
+
+export class EnvFileError extends Error {
+	readonly filePath: string;
+	readonly line: number;
+
+	constructor(filePath: string, line: number, reason: string) {
+		super(`${filePath}:${line}: ${reason}`);
+		this.name = 'EnvFileError';
+		this.filePath = filePath;
+		this.line = line;
+	}
+}
+
+function findClosingQuote(value: string, quote: string) {
+	for (let i = 1; i < value.length; i++) {
+		if (quote === '"' && value[i] === '\\') {
+			i++;
+			continue;
+		}
+		if (value[i] === quote) return i;
+	}
+	return -1;
+}
+
+function unescapeDoubleQuoted(value: string) {
+	return value.replace(/\\([nrt"\\])/g, (_m, ch: string) =>
+		ch === 'n' ? '\n' : ch === 'r' ? '\r' : ch === 't' ? '\t' : ch,
+	);
+}
+
+/**
+ * Parse .env contents. Supports:
+ * - KEY=value (optional leading `export `)
+ * - blank lines and lines starting with `#`
+ * - "double" or 'single' quoted values (spaces and `#` kept verbatim)
+ * - trailing ` # comment` after unquoted or quoted values
+ *
+ * Anything else is rejected with the offending line number.
+ */
+export function parseEnvFile(
+	contents: string,
+	filePath = '.env',
+): Record<string, string> {
+	const out: Record<string, string> = {};
+	const lines = contents.split(/\r?\n/);
+
+	lines.forEach((rawLine, index) => {
+		const lineNo = index + 1;
+		const line = rawLine.trim();
+		if (!line || line.startsWith('#')) return;
+
+		const body = line.startsWith('export ') ? line.slice(7).trimStart() : line;
+		const eq = body.indexOf('=');
+		if (eq <= 0) {
+			throw new EnvFileError(filePath, lineNo, 'expected KEY=value');
+		}
+
+		const key = body.slice(0, eq).trim();
+		if (!KEY_PATTERN.test(key)) {
+			throw new EnvFileError(filePath, lineNo, `invalid key "${key}"`);
+		}
+
+		let value = body.slice(eq + 1).trim();
+		const quote = value[0];
+
+		if (quote === '"' || quote === "'") {
+			const end = findClosingQuote(value, quote);
+			if (end === -1) {
+				throw new EnvFileError(filePath, lineNo, `unterminated ${quote} quote`);
+			}
+			const rest = value.slice(end + 1).trim();
+			if (rest && !rest.startsWith('#')) {
+				throw new EnvFileError(
+					filePath,
+					lineNo,
+					'unexpected characters after closing quote',
+				);
+			}
+			value = value.slice(1, end);
+			if (quote === '"') value = unescapeDoubleQuoted(value);
+		} else {
+			const comment = value.search(/\s#/);
+			if (comment !== -1) value = value.slice(0, comment).trimEnd();
+		}
+
+		out[key] = value;
+	});
+
+	return out;
+}
+
+/**
+ * Read and parse an env file. A missing file is not an error (returns {}),
+ * a malformed one throws EnvFileError.
+ */
+export function readEnvFile(filePath: string): Record<string, string> {
+	let contents: string;
+	try {
+		contents = fs.readFileSync(filePath, 'utf8');
+	} catch (err) {
+		if ((err as NodeJS.ErrnoException).code === 'ENOENT') return {};
+		throw err;
+	}
+	return parseEnvFile(contents, filePath);
+}
+
+/**
+ * Raw env for config loading: values from the env file (TESTHUB_ENV_FILE,
+ * or <CONFIG_PREFIX>_ENV_FILE; default ./.env) overlaid by the real process
+ * env, which always wins.
+ */
+export function loadRawEnv(
+	env: NodeJS.ProcessEnv = process.env,
+): Record<string, string | undefined> {
+	const filePath = env[`${configPrefix(env)}_ENV_FILE`] || '.env';
+	return { ...readEnvFile(filePath), ...env };
+}
@@ -0,0 +1,68 @@
+import crypto from 'node:crypto';
+
+/**
+ * Weak ETag of a JSON response body: the same content always gets the same
+ * tag, and any change (status, counts, labels) a different one. Weak because
+ * the bytes on the wire vary with compression.
+ */
+export function jsonEtag(body: unknown) {
+	const hash = crypto
+		.createHash('sha256')
+		.update(JSON.stringify(body))
+		.digest('base64url')
+		.slice(0, 27);
+	return `W/"${hash}"`;
+}
+
+/**
+ * Whether an If-None-Match header matches `etag` (weak comparison, so W/
+ * prefixes are ignored); `*` matches anything.
+ */
+export function etagMatches(header: string | undefined, etag: string) {
+	if (!header) return false;
+	const opaque = (tag: string) => tag.trim().replace(/^W\//, '');
+	return header
+		.split(',')
+		.some((tag) => tag.trim() === '*' || opaque(tag) === opaque(etag));
+}
+
+/**
+ * Last-Modified / If-Modified-Since value for `date`. HTTP dates have
+ * one-second precision, so the milliseconds are dropped.
+ */
+export function httpDate(date: Date) {
+	return date.toUTCString();
+}
+
+/**
+ * Whether a conditional GET can get a 304. If-None-Match decides when the
+ * request has it (RFC 9110 ignores If-Modified-Since then); otherwise
+ * If-Modified-Since is compared with `lastModified` to the second.
+ */
+export function notModified(
+	headers: { 'if-none-match'?: string; 'if-modified-since'?: string },
+	validators: { etag: string; lastModified?: Date | null },
+) {
+	if (headers['if-none-match']) {
+		return etagMatches(headers['if-none-match'], validators.etag);
+	}
+	const since = headers['if-modified-since'];
+	if (!since || !validators.lastModified) return false;
+	const sinceMs = Date.parse(since);
+	if (Number.isNaN(sinceMs)) return false;
+	return Math.floor(validators.lastModified.getTime() / 1000) * 1000 <= sinceMs;
+}
+
+/**
+ * Cache-Control for a public response cached for `maxAgeMs`, served stale
+ * for another `staleMs` while a cache revalidates. 0 means revalidate
+ * every time.
+ */
+export function publicCacheControl(maxAgeMs: number, staleMs = 0) {
+	const maxAge = Math.floor(maxAgeMs / 1000);
+	if (maxAge === 0) return 'public, no-cache';
+	const stale = Math.floor(staleMs / 1000);
+	return stale
+		? `public, max-age=${maxAge}, stale-while-revalidate=${stale}`
+		: `public, max-age=${maxAge}`;
+}
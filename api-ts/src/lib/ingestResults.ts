@@ -0,0 +1,107 @@
+import type { Prisma } from '@prisma/client';
+import { truncateOutput } from './testOutput';
+
+export type IngestResult = {
+	externalId: string;
+	name: string;
+	status: 'PASSED' | 'FAILED' | 'SKIPPED' | 'ERROR';
+	durationMs?: number;
+	message?: string;
+	stacktrace?: string;
+	stdout?: string;
+	stderr?: string;
+	filePath?: string;
+	suiteName?: string;
+	tags?: string[];
+	meta?: Record<string, unknown>;
+};
+
+export type ResultCounts = {
+	total: number;
+	passed: number;
+	failed: number;
+	skipped: number;
+	error: number;
+};
+
+/**
+ * Upsert each result's TestCase, insert its TestResult and add the batch to
+ * the run's counters (runs can be appended to in several batches). Captured
+ * stdout/stderr over `maxOutputBytes` each is cut (see truncateOutput).
+ * Call inside a transaction.
+ */
+export async function ingestResults(
+	tx: Prisma.TransactionClient,
+	projectId: string,
+	runId: string,
+	results: IngestResult[],
+	opts: { maxOutputBytes: number },
+): Promise<ResultCounts> {
+	let passed = 0,
+		failed = 0,
+		skipped = 0,
+		error = 0;
+
+	for (const r of results) {
+		const tc = await tx.testCase.upsert({
+			where: {
+				projectId_externalId: {
+					projectId,
+					externalId: r.externalId,
+				},
+			},
+			update: {
+				name: r.name,
+				filePath: r.filePath,
+				suiteName: r.suiteName,
+				...(r.tags ? { tags: r.tags } : {}),
+			},
+			create: {
+				projectId,
+				externalId: r.externalId,
+				name: r.name,
+				filePath: r.filePath,
+				suiteName: r.suiteName,
+				tags: r.tags ?? [],
+			},
+			select: { id: true },
+		});
+
+		const stdout = truncateOutput(r.stdout, opts.maxOutputBytes);
+		const stderr = truncateOutput(r.stderr, opts.maxOutputBytes);
+		await tx.testResult.create({
+			data: {
+				runId,
+				testCaseId: tc.id,
+				status: r.status,
+				durationMs: r.durationMs,
+				message: r.message,
+				stacktrace: r.stacktrace,
+				stdout: stdout.text,
+				stderr: stderr.text,
+				outputTruncated: stdout.truncated || stderr.truncated,
+				meta: (r.meta ?? undefined) as Prisma.InputJsonValue | undefined,
+			},
+		});
+
+		if (r.status === 'PASSED') passed++;
+		else if (r.status === 'FAILED') failed++;
+		else if (r.status === 'SKIPPED') skipped++;
+		else error++;
+	}
+
+	const total = passed + failed + skipped + error;
+
+	await tx.testRun.update({
+		where: { id: runId },
+		data: {
+			totalCount: { increment: total },
+			passedCount: { increment: passed },
+			failedCount: { increment: failed },
+			skippedCount: { increment: skipped },
+			errorCount: { increment: error },
+		},
+	});
+
+	return { total, passed, failed, skipped, error };
+}
@@ -0,0 +1,57 @@
+import type { FastifyRequest } from 'fastify';
+import type { z } from 'zod';
+
+const JSON_CONTENT_TYPE = /^application\/(?:[\w.+-]+\+)?json\s*(?:;|$)/i;
+
+/** Zod issues as { path: "results.0.status", message } for `errors`. */
+function issueList(error: z.ZodError) {
+	return error.issues.map((issue) => ({
+		path: issue.path.join('.'),
+		message: issue.message,
+	}));
+}
+
+/**
+ * Decode and validate a JSON request body, for handlers that would
+ * otherwise repeat the same checks:
+ * - the body must be sent as application/json (415 otherwise);
+ * - a missing body is a 400, unless `optional` (then undefined);
+ * - schema errors are a 400 listing every issue. Body schemas are
+ *   z.strictObject, so unknown fields are schema errors too.
+ * Size limits (413), malformed JSON and trailing garbage (400) are
+ * rejected by Fastify's parser (BODY_LIMIT_BYTES) before the handler runs.
+ */
+export function parseJsonBody<T extends z.ZodType>(
+	req: FastifyRequest,
+	schema: T,
+): z.infer<T>;
+export function parseJsonBody<T extends z.ZodType>(
+	req: FastifyRequest,
+	schema: T,
+	opts: { optional: true },
+): z.infer<T> | undefined;
+export function parseJsonBody<T extends z.ZodType>(
+	req: FastifyRequest,
+	schema: T,
+	opts: { optional?: boolean } = {},
+): z.infer<T> | undefined {
+	const { httpErrors } = req.server;
+	if (req.body == null) {
+		if (opts.optional) return undefined;
+		throw httpErrors.badRequest('Request body is required (JSON)');
+	}
+	const contentType = req.headers['content-type'] ?? '';
+	if (!JSON_CONTENT_TYPE.test(contentType)) {
+		throw httpErrors.unsupportedMediaType(
+			'Expected Content-Type: application/json',
+		);
+	}
+
+	const parsed = schema.safeParse(req.body);
+	if (!parsed.success) {
+		throw httpErrors.badRequest('Invalid request body', {
+			errors: issueList(parsed.error),
+		});
+	}
+	return parsed.data;
+}
@@ -0,0 +1,162 @@
+import type { IngestResult } from './ingestResults';
+import { parseXml, XmlParseError, type XmlElement } from './xml';
+
+export class JUnitParseError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'JUnitParseError';
+	}
+}
+
+export type JUnitReport = {
+	results: IngestResult[];
+	suiteCount: number;
+	durationMs: number | undefined;
+};
+
+/** JUnit `time` is in (fractional) seconds. */
+function parseSeconds(value: string | undefined): number | undefined {
+	if (value == null || value.trim() === '') return undefined;
+	const seconds = Number(value.replace(/,/g, ''));
+	if (!Number.isFinite(seconds) || seconds < 0) return undefined;
+	return Math.round(seconds * 1000);
+}
+
+function textOf(el: XmlElement | undefined): string | undefined {
+	const text = el?.text.trim();
+	return text ? text : undefined;
+}
+
+/** `<system-out>`/`<system-err>` of a case or suite. */
+type CapturedOutput = { stdout?: string; stderr?: string };
+
+function outputOf(el: XmlElement): CapturedOutput {
+	const child = (tag: string) => el.children.find((c) => c.name === tag);
+	return {
+		stdout: textOf(child('system-out')),
+		stderr: textOf(child('system-err')),
+	};
+}
+
+function toResult(
+	tc: XmlElement,
+	suite: XmlElement,
+	suiteOutput: CapturedOutput,
+): IngestResult {
+	const name = tc.attrs.name?.trim();
+	if (!name) {
+		throw new JUnitParseError(
+			`<testcase> on line ${tc.line} has no name attribute`,
+		);
+	}
+	const classname = tc.attrs.classname?.trim();
+	const child = (tag: string) => tc.children.find((c) => c.name === tag);
+
+	// A case can carry several outcome elements; failure beats error beats skipped
+	const failure = child('failure');
+	const error = child('error');
+	const skipped = child('skipped');
+	const outcome = failure ?? error ?? skipped;
+
+	// Some runners capture output per suite, not per case: a failure gets
+	// the suite's so it can be read next to it; a passing case doesn't
+	// need it
+	const output = outputOf(tc);
+	if (failure ?? error) {
+		output.stdout ??= suiteOutput.stdout;
+		output.stderr ??= suiteOutput.stderr;
+	}
+
+	return {
+		externalId: classname ? `${classname}.${name}` : name,
+		name,
+		status: failure
+			? 'FAILED'
+			: error
+				? 'ERROR'
+				: skipped
+					? 'SKIPPED'
+					: 'PASSED',
+		durationMs: parseSeconds(tc.attrs.time),
+		message: outcome?.attrs.message || undefined,
+		stacktrace: outcome === skipped ? undefined : textOf(outcome),
+		stdout: output.stdout,
+		stderr: output.stderr,
+		filePath: tc.attrs.file || suite.attrs.file || undefined,
+		suiteName: suite.attrs.name || classname || undefined,
+	};
+}
+
+/**
+ * Parse a JUnit XML report (`<testsuites>` or a single `<testsuite>`, nested
+ * suites allowed) into ingest results. Test cases are identified by
+ * `classname.name`; a case reported twice keeps its last result. A failed
+ * or errored case without `<system-out>`/`<system-err>` of its own takes
+ * those of the nearest suite that has them.
+ */
+export function parseJUnitXml(xml: string): JUnitReport {
+	let root: XmlElement;
+	try {
+		root = parseXml(xml);
+	} catch (err) {
+		if (err instanceof XmlParseError) {
+			throw new JUnitParseError(`malformed XML: ${err.message}`);
+		}
+		throw err;
+	}
+
+	if (root.name !== 'testsuites' && root.name !== 'testsuite') {
+		throw new JUnitParseError(
+			`expected <testsuites> or <testsuite> root element, got <${root.name}>`,
+		);
+	}
+
+	const byId = new Map<string, IngestResult>();
+	let suiteCount = 0;
+	let suiteDurationMs: number | undefined;
+
+	const walk = (
+		suite: XmlElement,
+		depth: number,
+		parentOutput: CapturedOutput,
+	) => {
+		suiteCount++;
+		const own = outputOf(suite);
+		const output = {
+			stdout: own.stdout ?? parentOutput.stdout,
+			stderr: own.stderr ?? parentOutput.stderr,
+		};
+		const time = parseSeconds(suite.attrs.time);
+		if (depth === 0 && time != null) {
+			suiteDurationMs = (suiteDurationMs ?? 0) + time;
+		}
+		for (const child of suite.children) {
+			if (child.name === 'testsuite') walk(child, depth + 1, output);
+			else if (child.name === 'testcase') {
+				const result = toResult(child, suite, output);
+				byId.delete(result.externalId);
+				byId.set(result.externalId, result);
+			}
+		}
+	};
+
+	if (root.name === 'testsuite') walk(root, 0, {});
+	else {
+		for (const child of root.children) {
+			if (child.name === 'testsuite') walk(child, 0, {});
+		}
+	}
+
+	const results = [...byId.values()];
+	const rootTime =
+		root.name === 'testsuites' ? parseSeconds(root.attrs.time) : undefined;
+	const caseTime = results.some((r) => r.durationMs != null)
+		? results.reduce((sum, r) => sum + (r.durationMs ?? 0), 0)
+		: undefined;
+
+	return {
+		results,
+		suiteCount,
+		durationMs: rootTime ?? suiteDurationMs ?? caseTime,
+	};
+}
@@ -0,0 +1,145 @@
+import type { RunDetails } from '../repositories/types';
+import { escapeXmlAttr, escapeXmlText } from './xml';
+
+export type ExportedResult = {
+	status: 'PASSED' | 'FAILED' | 'SKIPPED' | 'ERROR';
+	durationMs: number | null;
+	message: string | null;
+	stacktrace: string | null;
+	stdout: string | null;
+	stderr: string | null;
+	testCase: {
+		externalId: string;
+		name: string;
+		filePath: string | null;
+		suiteName: string | null;
+	};
+};
+
+// Suite for results ingested without one (JSON batches)
+const DEFAULT_SUITE = 'default';
+
+/** Milliseconds as JUnit `time` seconds (exact back to the millisecond). */
+function seconds(ms: number) {
+	return (ms / 1000).toFixed(3);
+}
+
+function attrs(values: Record<string, string | number | null | undefined>) {
+	return Object.entries(values)
+		.filter(([, value]) => value != null)
+		.map(([key, value]) => ` ${key}="${escapeXmlAttr(String(value))}"`)
+		.join('');
+}
+
+/**
+ * The JUnit classname of a case: what the ingester put in front of the name
+ * in `classname.name` ids. Other ids (from JSON batches) have none.
+ */
+function classnameOf(testCase: ExportedResult['testCase']) {
+	const { externalId, name } = testCase;
+	return externalId.length > name.length + 1 &&
+		externalId.endsWith(`.${name}`)
+		? externalId.slice(0, -name.length - 1)
+		: undefined;
+}
+
+function testcase(result: ExportedResult) {
+	const { testCase } = result;
+	const open = `    <testcase${attrs({
+		name: testCase.name,
+		classname: classnameOf(testCase),
+		file: testCase.filePath,
+		time: result.durationMs == null ? null : seconds(result.durationMs),
+	})}`;
+
+	const body: string[] = [];
+	const outcome =
+		result.status === 'FAILED'
+			? 'failure'
+			: result.status === 'ERROR'
+				? 'error'
+				: result.status === 'SKIPPED'
+					? 'skipped'
+					: null;
+	if (outcome) {
+		const tag = `<${outcome}${attrs({ message: result.message })}`;
+		// Skipped cases keep only the reason (as the ingester reads them)
+		body.push(
+			result.stacktrace && outcome !== 'skipped'
+				? `      ${tag}>${escapeXmlText(result.stacktrace)}</${outcome}>`
+				: `      ${tag}/>`,
+		);
+	}
+	if (result.stdout) {
+		body.push(`      <system-out>${escapeXmlText(result.stdout)}</system-out>`);
+	}
+	if (result.stderr) {
+		body.push(`      <system-err>${escapeXmlText(result.stderr)}</system-err>`);
+	}
+	return body.length
+		? [`${open}>`, ...body, '    </testcase>'].join('\n')
+		: `${open}/>`;
+}
+
+function counts(results: ExportedResult[]) {
+	const count = (status: ExportedResult['status']) =>
+		results.filter((r) => r.status === status).length;
+	const timed = results.filter((r) => r.durationMs != null);
+	return {
+		tests: results.length,
+		failures: count('FAILED'),
+		errors: count('ERROR'),
+		skipped: count('SKIPPED'),
+		time: timed.length
+			? seconds(timed.reduce((sum, r) => sum + (r.durationMs ?? 0), 0))
+			: null,
+	};
+}
+
+/**
+ * Serialize a run as a JUnit XML report: one `<testsuite>` per suite name
+ * (in the order suites first appear in `results`), cases with their
+ * classname, file, time, outcome and captured output. Nested suites were
+ * flattened on ingest and are exported flat. Ingesting the output again
+ * gives the same cases, statuses, messages and timings.
+ */
+export function runToJUnitXml(run: RunDetails, results: ExportedResult[]) {
+	const suites = new Map<string, ExportedResult[]>();
+	for (const result of results) {
+		const name = result.testCase.suiteName ?? DEFAULT_SUITE;
+		const suite = suites.get(name);
+		if (suite) suite.push(result);
+		else suites.set(name, [result]);
+	}
+
+	// JUnit timestamps are local ISO 8601 without a zone; ours are UTC
+	const timestamp = (run.startedAt ?? run.createdAt)
+		.toISOString()
+		.slice(0, 19);
+	const total = counts(results);
+	const lines = [
+		'<?xml version="1.0" encoding="UTF-8"?>',
+		`<testsuites${attrs({
+			id: run.id,
+			name: run.source,
+			...total,
+			// The run's own duration (parallel suites) over the sum of cases
+			time: run.durationMs == null ? total.time : seconds(run.durationMs),
+		})}>`,
+	];
+	let id = 0;
+	for (const [name, suiteResults] of suites) {
+		lines.push(
+			`  <testsuite${attrs({
+				name,
+				id: id++,
+				timestamp,
+				...counts(suiteResults),
+			})}>`,
+			...suiteResults.map(testcase),
+			'  </testsuite>',
+		);
+	}
+	lines.push('</testsuites>', '');
+	return lines.join('\n');
+}
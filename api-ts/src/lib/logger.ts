@@ -0,0 +1,342 @@
+import fs from 'node:fs';
+import { once } from 'node:events';
+import { Writable } from 'node:stream';
+import type { FastifyBaseLogger, FastifyServerOptions } from 'fastify';
+import type { AppConfig } from './config';
+
+export type LogFormat = 'json' | 'text';
+
+// Fields already rendered in the text prefix (or not useful locally)
+const TEXT_OMIT_KEYS = new Set(['level', 'ts', 'msg', 'pid', 'hostname', 'v']);
+
+function formatTextValue(value: unknown) {
+	if (typeof value === 'string') {
+		return /\s/.test(value) ? JSON.stringify(value) : value;
+	}
+	return JSON.stringify(value);
+}
+
+/**
+ * Render one JSON log line as
+ *   2026-01-01T12:00:00.000Z INFO  message key=value ...
+ * Error stacks are printed on the following lines.
+ */
+export function formatTextLine(line: string): string {
+	let entry: Record<string, unknown>;
+	try {
+		entry = JSON.parse(line);
+	} catch {
+		return line;
+	}
+
+	const level = String(entry.level ?? 'info').toUpperCase().padEnd(5);
+	const parts = [String(entry.ts ?? ''), level, String(entry.msg ?? '')];
+	let stack: string | null = null;
+
+	for (const [key, value] of Object.entries(entry)) {
+		if (TEXT_OMIT_KEYS.has(key) || value === undefined) continue;
+		if (
+			key === 'err' &&
+			value &&
+			typeof value === 'object' &&
+			'stack' in value &&
+			typeof value.stack === 'string'
+		) {
+			stack = value.stack;
+			continue;
+		}
+		parts.push(`${key}=${formatTextValue(value)}`);
+	}
+
+	const out = parts.filter(Boolean).join(' ');
+	return stack ? `${out}\n${stack}` : out;
+}
+
+/**
+ * Writable that turns pino's JSON lines into human-readable text.
+ * Each input line is written with a single write() so concurrent
+ * requests never interleave partial lines.
+ */
+export function createTextLogStream(
+	out: NodeJS.WritableStream = process.stdout,
+): Writable {
+	let pending = '';
+	return new Writable({
+		write(chunk, _encoding, callback) {
+			pending += chunk.toString();
+			let nl = pending.indexOf('\n');
+			while (nl !== -1) {
+				const line = pending.slice(0, nl);
+				pending = pending.slice(nl + 1);
+				if (line) out.write(`${formatTextLine(line)}\n`);
+				nl = pending.indexOf('\n');
+			}
+			callback();
+		},
+	});
+}
+
+export const REDACTED = '***';
+
+// Field names (any depth, any case) whose values never reach the log
+export const DEFAULT_REDACT_KEYS = [
+	'password',
+	'passwordhash',
+	'authorization',
+	'cookie',
+	'set-cookie',
+	'x-api-key',
+	'api_key',
+	'apikey',
+	'token',
+	'secret',
+	'client_secret',
+];
+
+const REDACT_MAX_DEPTH = 8;
+
+function isPlainObject(value: unknown): value is Record<string, unknown> {
+	if (!value || typeof value !== 'object') return false;
+	const proto = Object.getPrototypeOf(value);
+	return proto === Object.prototype || proto === null;
+}
+
+/**
+ * Copy of `value` with every field whose lowercased name is in `keys`
+ * replaced by "***". Walks plain objects and arrays only; errors, dates and
+ * class instances are left to pino's serializers.
+ */
+export function redactFields<T>(value: T, keys: ReadonlySet<string>): T {
+	const walk = (v: unknown, depth: number): unknown => {
+		if (depth > REDACT_MAX_DEPTH) return v;
+		if (Array.isArray(v)) return v.map((item) => walk(item, depth + 1));
+		if (!isPlainObject(v)) return v;
+		const out: Record<string, unknown> = {};
+		for (const [key, field] of Object.entries(v)) {
+			out[key] = keys.has(key.toLowerCase())
+				? REDACTED
+				: walk(field, depth + 1);
+		}
+		return out;
+	};
+	return walk(value, 0) as T;
+}
+
+/** DEFAULT_REDACT_KEYS plus LOG_REDACT_KEYS, lowercased. */
+export function logRedactKeys(config: Pick<AppConfig, 'LOG_REDACT_KEYS'>) {
+	return new Set(
+		[...DEFAULT_REDACT_KEYS, ...config.LOG_REDACT_KEYS].map((key) =>
+			key.toLowerCase(),
+		),
+	);
+}
+
+type LoggerConfig = Pick<
+	AppConfig,
+	'LOG_FORMAT' | 'LOG_LEVEL' | 'LOG_FILE' | 'LOG_REDACT_KEYS'
+>;
+
+export class LogFileError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'LogFileError';
+	}
+}
+
+/**
+ * Fail startup on a LOG_FILE that can't be opened for append (missing
+ * directory, no permission), before anything is logged to it.
+ */
+export function checkLogFile(config: Pick<AppConfig, 'LOG_FILE'>) {
+	if (!config.LOG_FILE) return;
+	try {
+		fs.closeSync(fs.openSync(config.LOG_FILE, 'a'));
+	} catch (err) {
+		const reason =
+			(err as NodeJS.ErrnoException).code === 'ENOENT'
+				? 'directory does not exist'
+				: (err as Error).message;
+		throw new LogFileError(
+			`LOG_FILE is invalid: ${config.LOG_FILE}: ${reason}`,
+		);
+	}
+}
+
+/**
+ * Append-only log file that can be reopened at the same path, so external
+ * rotation (logrotate renaming the file) gets a fresh file instead of the
+ * logger writing to the renamed one forever. If the file fails (EIO,
+ * ENOSPC, removed directory), that is reported once on stderr and lines go
+ * to stderr until a reopen succeeds; the process is not brought down.
+ */
+export class ReopenableFileStream extends Writable {
+	readonly path: string;
+	private file: fs.WriteStream;
+	private failed = false;
+
+	constructor(path: string) {
+		super();
+		this.path = path;
+		this.file = this.open();
+	}
+
+	private open() {
+		const file = fs.createWriteStream(this.path, { flags: 'a' });
+		file.on('error', (err) => this.fail(file, err));
+		return file;
+	}
+
+	private fail(file: fs.WriteStream, err: Error) {
+		if (file !== this.file || this.failed) return;
+		this.failed = true;
+		process.stderr.write(
+			`log file ${this.path} failed (${err.message}); logging to stderr until it is reopened\n`,
+		);
+	}
+
+	_write(
+		chunk: Buffer,
+		_encoding: BufferEncoding,
+		callback: (err?: Error | null) => void,
+	) {
+		if (this.failed) {
+			process.stderr.write(chunk, () => callback());
+			return;
+		}
+		const file = this.file;
+		file.write(chunk, (err) => {
+			if (!err) return callback();
+			this.fail(file, err);
+			process.stderr.write(chunk, () => callback());
+		});
+	}
+
+	_final(callback: () => void) {
+		if (this.file.destroyed) return callback();
+		this.file.end(callback);
+	}
+
+	/**
+	 * Open `path` again and switch to it once open. Writes keep going to the
+	 * old file until then, and the old file is ended (not destroyed), so
+	 * queued lines are flushed before it closes. If the open fails, the old
+	 * file stays in use and the error is thrown.
+	 */
+	async reopen() {
+		const next = fs.createWriteStream(this.path, { flags: 'a' });
+		await once(next, 'open');
+		next.on('error', (err) => this.fail(next, err));
+		const previous = this.file;
+		this.file = next;
+		this.failed = false;
+		if (!previous.destroyed) previous.end();
+	}
+
+	/**
+	 * Resolves once every line written so far has reached the file. Safe to
+	 * call any number of times, and after the stream has ended.
+	 */
+	flush() {
+		if (this.writableEnded || this.destroyed) return Promise.resolve();
+		return new Promise<void>((resolve, reject) => {
+			// Queued behind the pending lines, so its callback fires after them
+			this.write(Buffer.alloc(0), (err) => (err ? reject(err) : resolve()));
+		});
+	}
+}
+
+// Every LOG_FILE destination, for reopenLogFiles
+const logFiles = new Set<ReopenableFileStream>();
+
+/** LOG_FILE (opened for append, see reopenLogFiles) or stdout. */
+export function openLogDestination(
+	config: Pick<AppConfig, 'LOG_FILE'>,
+): NodeJS.WritableStream {
+	if (!config.LOG_FILE) return process.stdout;
+	const file = new ReopenableFileStream(config.LOG_FILE);
+	logFiles.add(file);
+	file.once('close', () => logFiles.delete(file));
+	return file;
+}
+
+/**
+ * Reopen the LOG_FILE destinations after log rotation (SIGHUP, see the
+ * configReload plugin). A no-op when logging to stdout.
+ */
+export async function reopenLogFiles() {
+	await Promise.all([...logFiles].map((file) => file.reopen()));
+}
+
+/**
+ * Wait until everything logged so far is written out; call it last before
+ * exiting. A no-op for stdout, which Node writes synchronously to files and
+ * pipes. Repeated calls are fine: each one covers the lines logged before it.
+ */
+export async function flushLogs() {
+	await Promise.all([...logFiles].map((file) => file.flush()));
+}
+
+/**
+ * Fastify/pino logger options. Every entry is one JSON object per line with
+ * a string level and an RFC 3339 `ts`:
+ *   {"level":"info","ts":"2026-01-01T12:00:00.000Z","msg":"..."}
+ * In text mode the same entries are re-rendered for local readability.
+ * Sensitive fields (DEFAULT_REDACT_KEYS plus LOG_REDACT_KEYS) are masked.
+ *
+ * `destination` defaults to LOG_FILE/stdout; pass any writable (e.g. a
+ * PassThrough collecting lines) to capture output instead.
+ */
+export function buildLoggerOptions(
+	config: LoggerConfig,
+	destination: NodeJS.WritableStream = openLogDestination(config),
+): FastifyServerOptions['logger'] {
+	const format = config.LOG_FORMAT;
+	const redactKeys = logRedactKeys(config);
+
+	return {
+		level: config.LOG_LEVEL,
+		timestamp: () => `,"ts":"${new Date().toISOString()}"`,
+		formatters: {
+			level: (label: string) => ({ level: label }),
+			// Fields of each call and of child logger bindings
+			log: (fields: Record<string, unknown>) =>
+				redactFields(fields, redactKeys),
+			bindings: (bindings: Record<string, unknown>) =>
+				redactFields(bindings, redactKeys),
+		},
+		stream:
+			format === 'text' ? createTextLogStream(destination) : destination,
+	};
+}
+
+let exitProcess: (code: number) => void = (code) => process.exit(code);
+
+/** Swap the exit function (e.g. in a script that must assert the code). */
+export function setExitHandler(fn: (code: number) => void) {
+	exitProcess = fn;
+}
+
+// How long fatalExit waits for the log to be written before exiting anyway
+// (a LOG_FILE on a stuck disk must not keep a failed process alive)
+const FATAL_FLUSH_TIMEOUT_MS = 2_000;
+
+/**
+ * Log at fatal level, flush the log (up to FATAL_FLUSH_TIMEOUT_MS) and exit
+ * with code 1. This bypasses graceful shutdown (onClose hooks do not run),
+ * so use it only where there is none to do: startup failures before the
+ * server is serving traffic, or a graceful shutdown that itself failed.
+ */
+export async function fatalExit(
+	logger: FastifyBaseLogger,
+	err: unknown,
+	msg: string,
+): Promise<void> {
+	logger.fatal({ err }, msg);
+	await Promise.race([
+		flushLogs().catch(() => undefined),
+		new Promise<void>((resolve) =>
+			setTimeout(resolve, FATAL_FLUSH_TIMEOUT_MS).unref(),
+		),
+	]);
+	exitProcess(1);
+}
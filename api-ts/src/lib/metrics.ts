@@ -0,0 +1,179 @@
+type Labels = Record<string, string>;
+
+function labelKey(labels: Labels) {
+	return JSON.stringify(
+		Object.entries(labels).sort(([a], [b]) => (a < b ? -1 : 1)),
+	);
+}
+
+function escapeLabelValue(value: string) {
+	return value
+		.replace(/\\/g, '\\\\')
+		.replace(/\n/g, '\\n')
+		.replace(/"/g, '\\"');
+}
+
+function formatLabels(labels: Labels) {
+	const entries = Object.entries(labels);
+	if (!entries.length) return '';
+	const pairs = entries.map(([k, v]) => `${k}="${escapeLabelValue(v)}"`);
+	return `{${pairs.join(',')}}`;
+}
+
+interface Metric {
+	render(): string;
+}
+
+/** One series of a metric read on each scrape. */
+export type Sample = { labels: Labels; value: number };
+
+function renderCollected(name: string, collected: number | Sample[]) {
+	if (typeof collected === 'number') return `${name} ${collected}\n`;
+	return collected
+		.map(({ labels, value }) => `${name}${formatLabels(labels)} ${value}\n`)
+		.join('');
+}
+
+function header(name: string, help: string, type: string) {
+	return `# HELP ${name} ${help}\n# TYPE ${name} ${type}\n`;
+}
+
+/**
+ * Counter, incremented directly or read on each scrape (one value, or one
+ * Sample per series).
+ */
+export class Counter implements Metric {
+	readonly name: string;
+	readonly help: string;
+	private readonly values = new Map<
+		string,
+		{ labels: Labels; value: number }
+	>();
+	private readonly collect?: () => number | Sample[];
+
+	constructor(name: string, help: string, collect?: () => number | Sample[]) {
+		this.name = name;
+		this.help = help;
+		this.collect = collect;
+	}
+
+	inc(labels: Labels = {}, by = 1) {
+		const key = labelKey(labels);
+		const entry = this.values.get(key);
+		if (entry) entry.value += by;
+		else this.values.set(key, { labels, value: by });
+	}
+
+	render() {
+		let out = header(this.name, this.help, 'counter');
+		if (this.collect) return out + renderCollected(this.name, this.collect());
+		for (const { labels, value } of this.values.values()) {
+			out += `${this.name}${formatLabels(labels)} ${value}\n`;
+		}
+		return out;
+	}
+}
+
+/**
+ * Gauge whose value is either set directly or read on each scrape (one
+ * value, or one Sample per series).
+ */
+export class Gauge implements Metric {
+	readonly name: string;
+	readonly help: string;
+	private value = 0;
+	private readonly collect?: () => number | Sample[];
+
+	constructor(name: string, help: string, collect?: () => number | Sample[]) {
+		this.name = name;
+		this.help = help;
+		this.collect = collect;
+	}
+
+	inc(by = 1) {
+		this.value += by;
+	}
+
+	dec(by = 1) {
+		this.value -= by;
+	}
+
+	render() {
+		const value = this.collect ? this.collect() : this.value;
+		return (
+			header(this.name, this.help, 'gauge') + renderCollected(this.name, value)
+		);
+	}
+}
+
+type HistogramSeries = {
+	labels: Labels;
+	counts: number[];
+	sum: number;
+	count: number;
+};
+
+export class Histogram implements Metric {
+	readonly name: string;
+	readonly help: string;
+	readonly buckets: number[];
+	private readonly series = new Map<string, HistogramSeries>();
+
+	constructor(name: string, help: string, buckets: number[]) {
+		this.name = name;
+		this.help = help;
+		this.buckets = [...buckets].sort((a, b) => a - b);
+	}
+
+	observe(labels: Labels, value: number) {
+		const key = labelKey(labels);
+		const series = this.series.get(key) ?? {
+			labels,
+			counts: this.buckets.map(() => 0),
+			sum: 0,
+			count: 0,
+		};
+		this.series.set(key, series);
+
+		this.buckets.forEach((le, i) => {
+			if (value <= le) series.counts[i] += 1;
+		});
+		series.sum += value;
+		series.count += 1;
+	}
+
+	render() {
+		let out = header(this.name, this.help, 'histogram');
+		for (const { labels, counts, sum, count } of this.series.values()) {
+			this.buckets.forEach((le, i) => {
+				const bucketLabels = formatLabels({ ...labels, le: String(le) });
+				out += `${this.name}_bucket${bucketLabels} ${counts[i]}\n`;
+			});
+			const infLabels = formatLabels({ ...labels, le: '+Inf' });
+			out += `${this.name}_bucket${infLabels} ${count}\n`;
+			out += `${this.name}_sum${formatLabels(labels)} ${sum}\n`;
+			out += `${this.name}_count${formatLabels(labels)} ${count}\n`;
+		}
+		return out;
+	}
+}
+
+/**
+ * Minimal Prometheus registry (text exposition format 0.0.4). Small on
+ * purpose: counters, gauges and histograms are all the API needs.
+ */
+export class MetricsRegistry {
+	private readonly metrics: Metric[] = [];
+
+	register<M extends Metric>(metric: M): M {
+		this.metrics.push(metric);
+		return metric;
+	}
+
+	render(): string {
+		return this.metrics.map((m) => m.render()).join('');
+	}
+}
+
+export const PROMETHEUS_CONTENT_TYPE =
+	'text/plain; version=0.0.4; charset=utf-8';
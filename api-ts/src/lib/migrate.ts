@@ -0,0 +1,38 @@
+import { spawn } from 'node:child_process';
+import type { FastifyBaseLogger } from 'fastify';
+
+/**
+ * Apply pending Prisma migrations (prisma/migrations) in order via
+ * `prisma migrate deploy`. Prisma tracks applied versions in
+ * `_prisma_migrations`, so this is a no-op when the schema is up to date.
+ * The resolved DATABASE_URL is passed through, so TESTHUB_DB_* parts work
+ * here too.
+ */
+export function runMigrations(
+	databaseUrl: string,
+	log: Pick<FastifyBaseLogger, 'info' | 'error'>,
+): Promise<void> {
+	log.info('applying database migrations (prisma migrate deploy)');
+
+	return new Promise((resolve, reject) => {
+		const child = spawn('prisma', ['migrate', 'deploy'], {
+			env: { ...process.env, DATABASE_URL: databaseUrl },
+			stdio: 'inherit',
+			shell: process.platform === 'win32',
+		});
+
+		child.on('error', reject);
+		child.on('exit', (code, signal) => {
+			if (code === 0) {
+				log.info('database migrations up to date');
+				resolve();
+				return;
+			}
+			reject(
+				new Error(
+					`prisma migrate deploy failed (${signal ? `signal ${signal}` : `exit code ${code}`})`,
+				),
+			);
+		});
+	});
+}
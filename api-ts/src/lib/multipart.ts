@@ -0,0 +1,236 @@
+import { PassThrough, type Readable } from 'node:stream';
+
+const MAX_PART_HEADER_BYTES = 16 * 1024;
+
+export class MultipartError extends Error {
+	readonly statusCode: number;
+
+	constructor(message: string, statusCode = 400) {
+		super(message);
+		this.name = 'MultipartError';
+		this.statusCode = statusCode;
+	}
+}
+
+export type FilePart = {
+	fieldName: string;
+	filename: string;
+	/** Lowercased, without parameters; application/octet-stream if unset. */
+	contentType: string;
+};
+
+/** Boundary of a multipart/form-data Content-Type, or null. */
+export function multipartBoundary(contentType: string | undefined) {
+	if (!contentType || !/^multipart\/form-data\b/i.test(contentType)) {
+		return null;
+	}
+	const match = /;\s*boundary=(?:"([^"]{1,70})"|([^\s;]{1,70}))/i.exec(
+		contentType,
+	);
+	return match ? (match[1] ?? match[2]) : null;
+}
+
+function parsePartHeaders(raw: string) {
+	const headers: Record<string, string> = {};
+	for (const line of raw.split('\r\n')) {
+		const colon = line.indexOf(':');
+		if (colon <= 0) continue;
+		headers[line.slice(0, colon).trim().toLowerCase()] = line
+			.slice(colon + 1)
+			.trim();
+	}
+
+	const disposition = headers['content-disposition'] ?? '';
+	const param = (key: string) =>
+		new RegExp(`;\\s*${key}="([^"]*)"`, 'i').exec(disposition)?.[1] ??
+		new RegExp(`;\\s*${key}=([^;\\s]+)`, 'i').exec(disposition)?.[1];
+
+	return {
+		name: param('name') ?? '',
+		filename: param('filename'),
+		contentType: (headers['content-type'] ?? 'application/octet-stream')
+			.split(';')[0]
+			.trim()
+			.toLowerCase(),
+	};
+}
+
+/**
+ * Stream the first file part of a multipart/form-data body to `onFile`
+ * without buffering it; other parts are read and discarded. Part bytes are
+ * written to `onFile`'s stream with backpressure, so a slow consumer slows
+ * the upload instead of growing memory. If `onFile` fails, the rest of the
+ * body is still drained (so the response can be sent) and its error is
+ * rethrown.
+ */
+export async function readMultipartFile<T>(
+	source: AsyncIterable<Buffer>,
+	boundary: string,
+	opts: { maxTotalBytes: number },
+	onFile: (part: FilePart, body: Readable) => Promise<T>,
+): Promise<T> {
+	const [result] = await readMultipartFiles(
+		source,
+		boundary,
+		{ ...opts, maxFiles: 1, extraFiles: 'skip' },
+		onFile,
+	);
+	return result;
+}
+
+/**
+ * Like readMultipartFile, but `onFile` is called for every file part, in
+ * body order; results come back in the same order. More than `maxFiles`
+ * file parts are a 400 (or skipped with `extraFiles: 'skip'`).
+ */
+export async function readMultipartFiles<T>(
+	source: AsyncIterable<Buffer>,
+	boundary: string,
+	opts: {
+		maxTotalBytes: number;
+		maxFiles: number;
+		extraFiles?: 'reject' | 'skip';
+	},
+	onFile: (part: FilePart, body: Readable) => Promise<T>,
+): Promise<T[]> {
+	const dashBoundary = Buffer.from(`--${boundary}`);
+	const delimiter = Buffer.from(`\r\n--${boundary}`);
+
+	let buf = Buffer.alloc(0);
+	let total = 0;
+	let state: 'preamble' | 'afterBoundary' | 'headers' | 'body' | 'done' =
+		'preamble';
+	let file: PassThrough | null = null;
+	let fileParts = 0;
+	const results: Promise<T>[] = [];
+
+	const write = async (data: Buffer) => {
+		if (!file || !data.length) return;
+		// Consumer gave up (error): keep parsing, stop forwarding
+		if (file.destroyed) {
+			file = null;
+			return;
+		}
+		if (file.write(data)) return;
+		const target = file;
+		await new Promise<void>((resolve) => {
+			target.once('drain', resolve);
+			target.once('close', resolve);
+		});
+		if (target.destroyed) file = null;
+	};
+
+	const advance = async () => {
+		for (;;) {
+			if (state === 'preamble') {
+				const idx = buf.indexOf(dashBoundary);
+				if (idx === -1) {
+					const keep = Math.max(0, buf.length - dashBoundary.length);
+					buf = buf.subarray(keep);
+					return;
+				}
+				buf = buf.subarray(idx + dashBoundary.length);
+				state = 'afterBoundary';
+			} else if (state === 'afterBoundary') {
+				if (buf.length < 2) return;
+				if (buf[0] === 0x2d && buf[1] === 0x2d) {
+					state = 'done';
+					return;
+				}
+				const eol = buf.indexOf('\r\n');
+				if (eol === -1) return;
+				// Only transport padding may precede the line break
+				if (buf.subarray(0, eol).toString('latin1').trim()) {
+					throw new MultipartError('malformed multipart boundary');
+				}
+				buf = buf.subarray(eol + 2);
+				state = 'headers';
+			} else if (state === 'headers') {
+				const end = buf.indexOf('\r\n\r\n');
+				if (end === -1) {
+					if (buf.length > MAX_PART_HEADER_BYTES) {
+						throw new MultipartError('multipart part headers too large');
+					}
+					return;
+				}
+				const headers = parsePartHeaders(
+					buf.subarray(0, end).toString('utf8'),
+				);
+				buf = buf.subarray(end + 4);
+				state = 'body';
+
+				const wanted =
+					headers.filename != null && ++fileParts <= opts.maxFiles;
+				if (fileParts > opts.maxFiles && opts.extraFiles !== 'skip') {
+					throw new MultipartError(
+						`too many files (at most ${opts.maxFiles} per upload)`,
+					);
+				}
+				if (wanted) {
+					const body = new PassThrough();
+					// Errors reach onFile's reader; don't crash if it never listens
+					body.on('error', () => undefined);
+					file = body;
+					const result = Promise.resolve()
+						.then(() =>
+							onFile(
+								{
+									fieldName: headers.name,
+									filename: headers.filename ?? '',
+									contentType: headers.contentType,
+								},
+								body,
+							),
+						)
+						.catch((err) => {
+							body.destroy();
+							throw err;
+						});
+					// Observed below; avoid an unhandled rejection meanwhile
+					result.catch(() => undefined);
+					results.push(result);
+				}
+			} else if (state === 'body') {
+				const idx = buf.indexOf(delimiter);
+				if (idx === -1) {
+					// Keep a tail that could be the start of the delimiter
+					const safe = buf.length - (delimiter.length - 1);
+					if (safe > 0) {
+						await write(buf.subarray(0, safe));
+						buf = buf.subarray(safe);
+					}
+					return;
+				}
+				await write(buf.subarray(0, idx));
+				file?.end();
+				file = null;
+				buf = buf.subarray(idx + delimiter.length);
+				state = 'afterBoundary';
+			} else {
+				return;
+			}
+		}
+	};
+
+	try {
+		for await (const chunk of source) {
+			total += chunk.length;
+			if (total > opts.maxTotalBytes) {
+				throw new MultipartError('upload too large', 413);
+			}
+			if (state === 'done') continue; // epilogue
+			buf = buf.length ? Buffer.concat([buf, chunk]) : chunk;
+			await advance();
+		}
+		if (state !== 'done') {
+			throw new MultipartError('unexpected end of multipart body');
+		}
+	} catch (err) {
+		const pending = file as PassThrough | null;
+		pending?.destroy(err as Error);
+		throw err;
+	}
+
+	if (!results.length) throw new MultipartError('no file part in upload');
+	return Promise.all(results);
+}
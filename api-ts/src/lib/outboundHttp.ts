@@ -0,0 +1,327 @@
+import dns from 'node:dns';
+import http from 'node:http';
+import https from 'node:https';
+import net from 'node:net';
+import tls from 'node:tls';
+import { parseAddressList, unmapIpv4 } from './clientIp';
+import type { AppConfig } from './config';
+
+export type ProxySettings = {
+	/** TESTHUB_OUTBOUND_PROXY: used for every target when set. */
+	override?: string;
+	httpProxy?: string;
+	httpsProxy?: string;
+	noProxy: string[];
+};
+
+type ProxyConfig = Pick<
+	AppConfig,
+	| 'TESTHUB_OUTBOUND_PROXY'
+	| 'HTTP_PROXY'
+	| 'HTTPS_PROXY'
+	| 'NO_PROXY'
+	| 'http_proxy'
+	| 'https_proxy'
+	| 'no_proxy'
+>;
+
+/** The proxy settings of a config; upper-case names win over lower-case. */
+export function proxySettings(config: ProxyConfig): ProxySettings {
+	return {
+		override: config.TESTHUB_OUTBOUND_PROXY,
+		httpProxy: config.HTTP_PROXY ?? config.http_proxy,
+		httpsProxy: config.HTTPS_PROXY ?? config.https_proxy,
+		noProxy: config.NO_PROXY.length ? config.NO_PROXY : config.no_proxy,
+	};
+}
+
+/** "[::1]" -> "::1" (URL keeps the brackets, sockets don't want them). */
+function bareHost(hostname: string) {
+	return hostname.startsWith('[') ? hostname.slice(1, -1) : hostname;
+}
+
+function defaultPort(url: URL) {
+	return url.port || (url.protocol === 'https:' ? '443' : '80');
+}
+
+/**
+ * Whether `url` is excluded from proxying by NO_PROXY entries, as curl
+ * reads them: "*" matches everything, "example.com" and ".example.com"
+ * match the domain and its subdomains, an IP matches itself, and an entry
+ * with ":port" only matches that port.
+ */
+export function bypassesProxy(url: URL, noProxy: string[]) {
+	const host = bareHost(url.hostname).toLowerCase();
+	const port = defaultPort(url);
+	return noProxy.some((raw) => {
+		let entry = raw.trim().toLowerCase();
+		if (entry === '*') return true;
+
+		const portMatch = /^(.*[^:]):(\d+)$/.exec(entry);
+		if (portMatch && !net.isIPv6(entry)) {
+			if (portMatch[2] !== port) return false;
+			entry = portMatch[1];
+		}
+		entry = bareHost(entry);
+		if (net.isIP(entry)) return entry === host;
+
+		const domain = entry.replace(/^\*?\./, '');
+		return host === domain || host.endsWith(`.${domain}`);
+	});
+}
+
+/** The proxy for `url` (null = connect directly). */
+export function proxyFor(url: URL, settings: ProxySettings): URL | null {
+	if (bypassesProxy(url, settings.noProxy)) return null;
+	const proxy =
+		settings.override ??
+		(url.protocol === 'https:' ? settings.httpsProxy : settings.httpProxy);
+	return proxy ? new URL(proxy) : null;
+}
+
+// Loopback, link-local (cloud metadata lives at 169.254.169.254), private
+// (RFC 1918, CGNAT, IPv6 ULA) and unspecified addresses: a request there
+// reaches this host or the network it runs in, not the internet
+const INTERNAL_NETWORKS = parseAddressList([
+	'0.0.0.0/8',
+	'10.0.0.0/8',
+	'100.64.0.0/10',
+	'127.0.0.0/8',
+	'169.254.0.0/16',
+	'172.16.0.0/12',
+	'192.168.0.0/16',
+	'::/128',
+	'::1/128',
+	'fc00::/7',
+	'fe80::/10',
+])!;
+
+function inList(list: net.BlockList, address: string) {
+	const ip = unmapIpv4(address);
+	const family = net.isIP(ip);
+	return !!family && list.check(ip, family === 4 ? 'ipv4' : 'ipv6');
+}
+
+const INTERNAL = 'a loopback, link-local or private address';
+
+/** A request target that resolves to an internal address. */
+export class InternalAddressError extends Error {
+	readonly code = 'ERR_INTERNAL_ADDRESS';
+
+	constructor(host: string, address: string) {
+		super(
+			host === address
+				? `${host} is ${INTERNAL}`
+				: `${host} resolves to ${address}, ${INTERNAL}`,
+		);
+	}
+}
+
+function proxyAuthorization(proxy: URL): Record<string, string> {
+	if (!proxy.username) return {};
+	const user = decodeURIComponent(proxy.username);
+	const password = decodeURIComponent(proxy.password);
+	const credentials = Buffer.from(`${user}:${password}`).toString('base64');
+	return { 'proxy-authorization': `Basic ${credentials}` };
+}
+
+export type OutboundRequest = {
+	method: string;
+	headers: Record<string, string>;
+	body?: string;
+	/** Overrides the client's timeout for this request. */
+	timeoutMs?: number;
+	/** Aborts the request before its timeout (e.g. req.abortSignal). */
+	signal?: AbortSignal;
+};
+
+export type OutboundResponse = { status: number };
+
+type LookupCallback = (
+	err: NodeJS.ErrnoException | null,
+	address: string | dns.LookupAddress[],
+	family?: number,
+) => void;
+
+/**
+ * HTTP client for requests the server makes to the outside (webhook
+ * deliveries). Each target goes through the configured proxy unless
+ * NO_PROXY excludes it: plain HTTP as an absolute-URI request to the proxy,
+ * HTTPS through a CONNECT tunnel (TLS is end to end). Redirects are not
+ * followed. Every request, tunnel setup included, is bounded by
+ * `timeoutMs`, and by the caller's signal if it passes one. The response
+ * body is discarded; only the status is kept.
+ * Idle keep-alive sockets are unref'd by the agents, so nothing needs
+ * closing at shutdown.
+ *
+ * Targets on internal addresses (INTERNAL_NETWORKS) are refused with an
+ * InternalAddressError unless in `allowedNetworks`. Direct connections are
+ * checked on the addresses DNS returned for the connection itself, so a
+ * name can't pass the check and then resolve elsewhere; through a proxy,
+ * which resolves on its own, the name is checked just before sending.
+ */
+export class OutboundHttpClient {
+	readonly timeoutMs: number;
+	readonly proxy: ProxySettings;
+	private readonly allowedNetworks: net.BlockList;
+	private readonly httpAgent = new http.Agent({ keepAlive: true });
+	private readonly httpsAgent = new https.Agent({ keepAlive: true });
+
+	constructor(opts: {
+		timeoutMs: number;
+		proxy: ProxySettings;
+		/** IPs/CIDRs exempt from the internal address check. */
+		allowedNetworks?: string[];
+	}) {
+		this.timeoutMs = opts.timeoutMs;
+		this.proxy = opts.proxy;
+		this.allowedNetworks =
+			parseAddressList(opts.allowedNetworks ?? []) ?? new net.BlockList();
+	}
+
+	/** The proxy a request to `url` would use (null = direct). */
+	proxyFor(url: string | URL) {
+		return proxyFor(new URL(url), this.proxy);
+	}
+
+	/** Whether requests to `address` are refused. */
+	isBlockedAddress(address: string) {
+		return (
+			inList(INTERNAL_NETWORKS, address) &&
+			!inList(this.allowedNetworks, address)
+		);
+	}
+
+	/**
+	 * Resolve `url`'s host and throw an InternalAddressError if any address
+	 * is refused. A name that doesn't resolve passes: requests to it fail
+	 * anyway, and it is checked again when one is sent.
+	 */
+	async checkTarget(url: string | URL) {
+		const host = bareHost(new URL(url).hostname);
+		if (net.isIP(host)) {
+			if (this.isBlockedAddress(host)) {
+				throw new InternalAddressError(host, host);
+			}
+			return;
+		}
+		const addresses = await dns.promises
+			.lookup(host, { all: true })
+			.catch(() => []);
+		const blocked = addresses.find(({ address }) =>
+			this.isBlockedAddress(address),
+		);
+		if (blocked) throw new InternalAddressError(host, blocked.address);
+	}
+
+	/** dns.lookup for direct connections, failing on refused addresses. */
+	private readonly lookup = (
+		hostname: string,
+		options: dns.LookupOptions,
+		callback: LookupCallback,
+	) => {
+		dns.lookup(hostname, { ...options, all: true }, (err, addresses) => {
+			if (err) return callback(err, []);
+			const blocked = addresses.find(({ address }) =>
+				this.isBlockedAddress(address),
+			);
+			if (blocked) {
+				const err = new InternalAddressError(hostname, blocked.address);
+				return callback(err, []);
+			}
+			if (options.all) return callback(null, addresses);
+			callback(null, addresses[0].address, addresses[0].family);
+		});
+	};
+
+	async request(
+		url: string,
+		req: OutboundRequest,
+	): Promise<OutboundResponse> {
+		const target = new URL(url);
+		if (target.protocol !== 'http:' && target.protocol !== 'https:') {
+			throw new Error(`unsupported URL scheme ${target.protocol}`);
+		}
+		const timeout = AbortSignal.timeout(req.timeoutMs ?? this.timeoutMs);
+		const signal = req.signal
+			? AbortSignal.any([timeout, req.signal])
+			: timeout;
+		const proxy = this.proxyFor(target);
+		// IP literals never reach the lookup; a proxy resolves names itself
+		if (proxy || net.isIP(bareHost(target.hostname))) {
+			await this.checkTarget(target);
+		}
+
+		let outgoing: http.ClientRequest;
+		if (!proxy) {
+			const secure = target.protocol === 'https:';
+			outgoing = (secure ? https : http).request(target, {
+				method: req.method,
+				headers: req.headers,
+				agent: secure ? this.httpsAgent : this.httpAgent,
+				lookup: this.lookup as net.LookupFunction,
+				signal,
+			});
+		} else if (target.protocol === 'http:') {
+			// Proxies take the absolute URI as the request target
+			outgoing = http.request({
+				host: bareHost(proxy.hostname),
+				port: defaultPort(proxy),
+				method: req.method,
+				path: target.href,
+				headers: {
+					...req.headers,
+					host: target.host,
+					...proxyAuthorization(proxy),
+				},
+				signal,
+			});
+		} else {
+			const socket = await this.tunnel(proxy, target, signal);
+			outgoing = https.request(target, {
+				method: req.method,
+				headers: req.headers,
+				agent: false,
+				signal,
+				createConnection: () =>
+					tls.connect({ socket, servername: bareHost(target.hostname) }),
+			});
+		}
+
+		return new Promise<OutboundResponse>((resolve, reject) => {
+			outgoing.once('error', reject);
+			outgoing.once('response', (res) => {
+				// Drain the body so the connection can be reused
+				res.resume();
+				res.once('end', () => resolve({ status: res.statusCode ?? 0 }));
+				res.once('error', reject);
+			});
+			outgoing.end(req.body);
+		});
+	}
+
+	/** A socket to `target` through `proxy` (HTTP CONNECT). */
+	private tunnel(proxy: URL, target: URL, signal: AbortSignal) {
+		const authority = `${target.hostname}:${defaultPort(target)}`;
+		return new Promise<net.Socket>((resolve, reject) => {
+			const connect = http.request({
+				host: bareHost(proxy.hostname),
+				port: defaultPort(proxy),
+				method: 'CONNECT',
+				path: authority,
+				headers: { host: authority, ...proxyAuthorization(proxy) },
+				agent: false,
+				signal,
+			});
+			connect.once('error', reject);
+			connect.once('connect', (res, socket) => {
+				if (res.statusCode === 200) return resolve(socket);
+				socket.destroy();
+				reject(
+					new Error(`proxy refused CONNECT ${authority}: ${res.statusCode}`),
+				);
+			});
+			connect.end();
+		});
+	}
+}
@@ -0,0 +1,102 @@
+/** One connection pool at the last sample. */
+export type PoolStats = {
+	/** Connections the pool holds, busy or idle. */
+	open: number;
+	/** Connections checked out by a query. */
+	busy: number;
+	idle: number;
+	/** Queries waiting for a connection right now. */
+	waiting: number;
+	/** Connections handed out since start. */
+	acquires: number;
+	/** Total time queries spent waiting for a connection. */
+	waitSeconds: number;
+};
+
+type MetricEntry<T> = { key: string; value: T };
+
+/** The parts of Prisma's `$metrics.json()` read here. */
+export type PrismaMetrics = {
+	counters: MetricEntry<number>[];
+	gauges: MetricEntry<number>[];
+	histograms: MetricEntry<{ sum: number; count: number }>[];
+};
+
+/** Anything with Prisma's metrics API (the `metrics` preview feature). */
+export type MetricsSource = { $metrics: { json(): Promise<PrismaMetrics> } };
+
+/** Pool figures out of one Prisma metrics snapshot (missing keys are 0). */
+export function poolStats(metrics: PrismaMetrics): PoolStats {
+	const gauge = (key: string) =>
+		metrics.gauges.find((m) => m.key === key)?.value ?? 0;
+	// Every query waits for a connection, most for 0 ms: the count is the
+	// number of acquires and the sum the time spent waiting
+	const wait = metrics.histograms.find(
+		(m) => m.key === 'prisma_client_queries_wait_histogram_ms',
+	)?.value;
+	return {
+		open: gauge('prisma_pool_connections_open'),
+		busy: gauge('prisma_pool_connections_busy'),
+		idle: gauge('prisma_pool_connections_idle'),
+		waiting: gauge('prisma_client_queries_wait'),
+		acquires: wait?.count ?? 0,
+		waitSeconds: (wait?.sum ?? 0) / 1000,
+	};
+}
+
+/**
+ * Samples the connection pools every `intervalMs` for /metrics: Prisma's
+ * metrics API is async and a scrape renders synchronously, so gauges read
+ * the last sample (at most one interval old). A failed sample keeps the
+ * previous one; the first failure in a row goes to `onError`. Call close()
+ * on shutdown, before the pools disconnect.
+ */
+export class PoolStatsSampler {
+	private readonly stats = new Map<string, PoolStats>();
+	private readonly failing = new Set<string>();
+	private readonly pools: Record<string, MetricsSource>;
+	private readonly onError: (err: unknown, pool: string) => void;
+	private readonly timer: NodeJS.Timeout;
+	private sampling: Promise<void> | null = null;
+
+	constructor(
+		pools: Record<string, MetricsSource>,
+		intervalMs: number,
+		onError: (err: unknown, pool: string) => void,
+	) {
+		this.pools = pools;
+		this.onError = onError;
+		this.timer = setInterval(() => this.sample(), intervalMs);
+		this.timer.unref();
+		this.sample();
+	}
+
+	/** The last sample of every pool, by pool name. */
+	current(): ReadonlyMap<string, PoolStats> {
+		return this.stats;
+	}
+
+	/** Take a sample now unless one is still running. */
+	sample() {
+		this.sampling ??= Promise.all(
+			Object.entries(this.pools).map(async ([name, client]) => {
+				try {
+					this.stats.set(name, poolStats(await client.$metrics.json()));
+					this.failing.delete(name);
+				} catch (err) {
+					if (!this.failing.has(name)) this.onError(err, name);
+					this.failing.add(name);
+				}
+			}),
+		).then(() => {
+			this.sampling = null;
+		});
+		return this.sampling;
+	}
+
+	/** Stop sampling; resolves once a sample in progress has finished. */
+	async close() {
+		clearInterval(this.timer);
+		await this.sampling;
+	}
+}
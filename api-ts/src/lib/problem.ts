@@ -0,0 +1,117 @@
+import { STATUS_CODES } from 'node:http';
+import type { FastifyError, FastifyReply, FastifyRequest } from 'fastify';
+import { isProduction } from './config';
+
+export const PROBLEM_CONTENT_TYPE = 'application/problem+json';
+
+/**
+ * RFC 7807 problem details. `type` is always about:blank, so `title` is the
+ * status phrase and `detail` carries the specific message. Extra members
+ * (e.g. `errors` for validation failures) are allowed by the RFC.
+ */
+export type Problem = {
+	type: string;
+	title: string;
+	status: number;
+	detail: string;
+	instance?: string;
+	[extension: string]: unknown;
+};
+
+export function problem(
+	status: number,
+	detail: string,
+	extensions: Record<string, unknown> = {},
+): Problem {
+	return {
+		type: 'about:blank',
+		title: STATUS_CODES[status] ?? 'Error',
+		status,
+		detail,
+		...extensions,
+	};
+}
+
+/**
+ * application/problem+json, unless the Accept header lists application/json
+ * but not problem+json (then the same body goes out as plain JSON).
+ */
+export function problemContentType(accept: string | undefined) {
+	if (!accept) return PROBLEM_CONTENT_TYPE;
+	const types = accept
+		.split(',')
+		.map((part) => part.split(';', 1)[0].trim().toLowerCase());
+	if (types.includes(PROBLEM_CONTENT_TYPE)) return PROBLEM_CONTENT_TYPE;
+	return types.includes('application/json')
+		? 'application/json'
+		: PROBLEM_CONTENT_TYPE;
+}
+
+/**
+ * Send an error response as problem details. Every error body (central
+ * error handler, 404/405, timeouts) goes through here; handlers throw
+ * `app.httpErrors.*` and reach it via the error handler.
+ */
+export function sendProblem(
+	reply: FastifyReply,
+	status: number,
+	detail: string,
+	extensions: Record<string, unknown> = {},
+) {
+	const { request } = reply;
+	return reply
+		.code(status)
+		.type(problemContentType(request.headers.accept))
+		.send(
+			problem(status, detail, {
+				instance: request.url.split('?', 1)[0],
+				...extensions,
+			}),
+		);
+}
+
+/**
+ * The app's error handler, and so the recovery path for anything a hook or
+ * handler throws: a 4xx keeps its message (validation details as
+ * `errors`); a 5xx is logged with its stack and, in production, answered
+ * with a bare "internal server error" so internals never reach clients.
+ */
+export function handleError(
+	err: FastifyError,
+	req: FastifyRequest,
+	reply: FastifyReply,
+) {
+	const anyErr = err as any;
+
+	const statusCode =
+		typeof anyErr.statusCode === 'number' && anyErr.statusCode >= 400
+			? anyErr.statusCode
+			: 500;
+
+	if (statusCode >= 500) {
+		// Full error + stack goes to the log only
+		req.log.error({ err }, 'unhandled error');
+
+		// Never echo internal messages/details to clients in production
+		if (isProduction(req.server.config)) {
+			return sendProblem(reply, statusCode, 'internal server error');
+		}
+	}
+
+	const details =
+		anyErr.cause ?? anyErr.errors ?? anyErr.validation ?? undefined;
+
+	const message =
+		typeof anyErr.message === 'string' && anyErr.message
+			? anyErr.message
+			: statusCode >= 500
+				? 'Internal Server Error'
+				: 'Bad Request';
+
+	return sendProblem(
+		reply,
+		statusCode,
+		message,
+		details ? { errors: details } : {},
+	);
+}
@@ -0,0 +1,53 @@
+import { createApiKey } from './apiKey';
+
+export const TOKEN_SCOPES = ['ingest', 'read'] as const;
+export type TokenScope = (typeof TOKEN_SCOPES)[number];
+
+// Marks a presented key as a project token rather than an org API key
+export const PROJECT_TOKEN_PREFIX = 'tht_';
+
+// Writes a CI token may make: uploading runs, results and artifacts
+const INGEST_ROUTES = new Set([
+	'POST /projects/:projectId/runs',
+	'POST /projects/:projectId/runs/batch',
+	'POST /projects/:projectId/runs/:runId/results/batch',
+	'POST /projects/:projectId/runs/:runId/cases',
+	'POST /projects/:projectId/runs/:runId/complete',
+	'POST /projects/:projectId/runs/:runId/artifacts',
+]);
+
+// Project settings a token can't read (and so can't escalate with)
+const PRIVATE_ROUTES = /^\/projects\/:projectId\/(?:tokens|webhooks)(?:\/|$)/;
+
+export function isProjectTokenPrefix(prefix: string) {
+	return prefix.startsWith(PROJECT_TOKEN_PREFIX);
+}
+
+/**
+ * A new project token, "tht_<prefix>.<secret>": same shape and hashing as
+ * an API key (see createApiKey), so the same headers and parser carry it.
+ */
+export function createProjectToken() {
+	const key = createApiKey();
+	return {
+		plainText: `${PROJECT_TOKEN_PREFIX}${key.plainText}`,
+		prefix: `${PROJECT_TOKEN_PREFIX}${key.prefix}`,
+		hash: key.hash,
+	};
+}
+
+/**
+ * Scope a project token needs for `method` on `route` (the route pattern
+ * without its /v1 prefix), or null when tokens may not call it at all:
+ * anything outside /projects/:projectId, project settings, and writes
+ * other than ingestion.
+ */
+export function requiredTokenScope(
+	method: string,
+	route: string,
+): TokenScope | null {
+	if (!/^\/projects\/:projectId(?:\/|$)/.test(route)) return null;
+	if (PRIVATE_ROUTES.test(route)) return null;
+	if (method === 'GET' || method === 'HEAD') return 'read';
+	return INGEST_ROUTES.has(`${method} ${route}`) ? 'ingest' : null;
+}
@@ -0,0 +1,68 @@
+import type { Prisma, PrismaClient } from '@prisma/client';
+
+// setTimeout's maximum, for "no limit": Prisma's default transaction
+// timeout (5s) would cut long reads short
+const MAX_TX_TIMEOUT_MS = 2 ** 31 - 1;
+
+/**
+ * A query cancelled because its signal aborted (client gone, request timed
+ * out). 499 is nginx's "client closed request": below 500, so the error
+ * handler neither logs it as a failure nor hides it, and nobody is left to
+ * read the response anyway.
+ */
+export class QueryCanceledError extends Error {
+	readonly statusCode = 499;
+
+	constructor(reason: unknown) {
+		super(
+			`query canceled: ${reason instanceof Error ? reason.message : String(reason)}`,
+		);
+		this.name = 'QueryCanceledError';
+	}
+}
+
+/**
+ * Run `query` (Prisma calls on `tx`) so that aborting `signal` stops it in
+ * Postgres too, not just in Node. Prisma can't cancel a query, so the work
+ * runs in a transaction pinned to one connection, and on abort
+ * pg_cancel_backend is sent for that connection's backend from another
+ * connection of the pool. Meant for expensive reads with req.abortSignal;
+ * `timeoutMs` bounds the transaction (0 = no limit).
+ */
+export async function cancellableQuery<T>(
+	client: PrismaClient,
+	signal: AbortSignal,
+	query: (tx: Prisma.TransactionClient) => Promise<T>,
+	opts: { timeoutMs: number },
+): Promise<T> {
+	if (signal.aborted) throw new QueryCanceledError(signal.reason);
+
+	return client.$transaction(
+		async (tx) => {
+			const [{ pid }] = await tx.$queryRaw<Array<{ pid: number }>>`
+				SELECT pg_backend_pid() AS pid
+			`;
+			let cancelling: Promise<unknown> | null = null;
+			const cancel = () => {
+				cancelling = client.$queryRaw`SELECT pg_cancel_backend(${pid}::int)`
+					// Nothing to do if it fails: the query just runs to the end
+					.catch(() => undefined);
+			};
+			signal.addEventListener('abort', cancel, { once: true });
+			try {
+				// Aborted while the connection was being set up
+				if (signal.aborted) throw new QueryCanceledError(signal.reason);
+				return await query(tx);
+			} catch (err) {
+				if (signal.aborted) throw new QueryCanceledError(signal.reason);
+				throw err;
+			} finally {
+				signal.removeEventListener('abort', cancel);
+				// Keep the connection until the cancel is in, so it can't hit the
+				// next query run on it
+				await cancelling;
+			}
+		},
+		{ timeout: opts.timeoutMs || MAX_TX_TIMEOUT_MS },
+	);
+}
@@ -0,0 +1,98 @@
+import type { FastifyBaseLogger } from 'fastify';
+import { REDACTED } from './logger';
+
+export const MAX_LOGGED_SQL = 2000;
+export const MAX_LOGGED_ARGS = 20;
+export const MAX_LOGGED_ARG_LENGTH = 64;
+
+// Levels at which every query is logged
+const QUERY_LOG_LEVELS = new Set(['debug', 'trace']);
+
+// Any argument of a query on these tables may be a credential or a lookup
+// key for one (session ids are the cookie value, webhooks hold signing
+// secrets)
+const CREDENTIAL_TABLES =
+	/"(Session|ApiKey|ProjectToken|EmailVerificationToken|PasswordResetToken|Webhook)"/;
+
+// Argument values that look like secrets wherever they appear: password
+// hashes, "<prefix>.<secret>" API keys and JWTs, and long hex/base64 tokens
+const SECRET_VALUES = [
+	/^\$(?:argon2|2[aby]\$)/,
+	/^[0-9a-f]{32,}$/i,
+	/^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]{16,}(?:\.[A-Za-z0-9_-]+)?$/,
+	/^(?=.*\d)(?=.*[A-Za-z])[A-Za-z0-9+/_-]{32,}={0,2}$/,
+];
+
+/** True for a value masked in query logs (see SECRET_VALUES). */
+export function looksLikeSecret(value: string) {
+	return SECRET_VALUES.some((pattern) => pattern.test(value));
+}
+
+function truncate(value: string, max: number) {
+	return value.length > max ? `${value.slice(0, max)}...` : value;
+}
+
+/**
+ * Query arguments safe to log: at most MAX_LOGGED_ARGS of them, strings cut
+ * to MAX_LOGGED_ARG_LENGTH, secret-looking strings (or all arguments of a
+ * credential table query) replaced by "***". `params` is the JSON array
+ * Prisma's query event carries; anything unparsable is dropped.
+ */
+export function loggableQueryArgs(sql: string, params: string): unknown[] {
+	let args: unknown;
+	try {
+		args = JSON.parse(params);
+	} catch {
+		return [];
+	}
+	if (!Array.isArray(args)) return [];
+
+	const redactAll = CREDENTIAL_TABLES.test(sql);
+	const shown = args.slice(0, MAX_LOGGED_ARGS).map((arg) => {
+		if (redactAll) return REDACTED;
+		if (typeof arg === 'string') {
+			return looksLikeSecret(arg)
+				? REDACTED
+				: truncate(arg, MAX_LOGGED_ARG_LENGTH);
+		}
+		// Arrays/objects (e.g. ANY($1) lists) are summarized, not walked
+		return arg !== null && typeof arg === 'object' ? '[...]' : arg;
+	});
+	if (args.length > MAX_LOGGED_ARGS) {
+		shown.push(`(${args.length - MAX_LOGGED_ARGS} more)`);
+	}
+	return shown;
+}
+
+export type QueryEvent = {
+	query: string;
+	params: string;
+	duration: number;
+};
+
+/**
+ * Log one executed query: at debug level normally, at warn when it took
+ * `slowMs` or longer (0 = never), so slow queries show up at any
+ * LOG_LEVEL. The level is checked per query, so a LOG_LEVEL change via
+ * SIGHUP applies at once.
+ */
+export function logQuery(
+	log: FastifyBaseLogger,
+	event: QueryEvent,
+	opts: { slowMs: number; target: string },
+) {
+	const slow = opts.slowMs > 0 && event.duration >= opts.slowMs;
+	if (!slow && !QUERY_LOG_LEVELS.has(log.level)) return;
+
+	const fields = {
+		target: opts.target,
+		sql: truncate(event.query, MAX_LOGGED_SQL),
+		args: loggableQueryArgs(event.query, event.params),
+		durationMs: event.duration,
+	};
+	if (slow) {
+		log.warn({ ...fields, thresholdMs: opts.slowMs }, 'slow database query');
+	} else {
+		log.debug(fields, 'database query');
+	}
+}
@@ -0,0 +1,71 @@
+type Bucket = { tokens: number; updatedAt: number };
+
+export type RateLimitResult =
+	| { allowed: true }
+	| { allowed: false; retryAfterSeconds: number };
+
+/**
+ * In-memory token bucket per key (e.g. client IP): each key may burst up to
+ * `burst` requests, refilled at `ratePerSecond`. Idle buckets are dropped by
+ * sweep() once they would be full again, so a flood of unique keys only
+ * costs memory for ~burst/rate seconds.
+ */
+export class TokenBucketLimiter {
+	readonly ratePerSecond: number;
+	readonly burst: number;
+	private readonly buckets = new Map<string, Bucket>();
+	private readonly now: () => number;
+
+	constructor(
+		ratePerSecond: number,
+		burst: number,
+		now: () => number = () => performance.now(),
+	) {
+		this.ratePerSecond = ratePerSecond;
+		this.burst = burst;
+		this.now = now;
+	}
+
+	private refill(bucket: Bucket, now: number) {
+		const elapsedSeconds = (now - bucket.updatedAt) / 1000;
+		bucket.tokens = Math.min(
+			this.burst,
+			bucket.tokens + elapsedSeconds * this.ratePerSecond,
+		);
+		bucket.updatedAt = now;
+	}
+
+	take(key: string): RateLimitResult {
+		const now = this.now();
+		let bucket = this.buckets.get(key);
+		if (!bucket) {
+			bucket = { tokens: this.burst, updatedAt: now };
+			this.buckets.set(key, bucket);
+		} else {
+			this.refill(bucket, now);
+		}
+
+		if (bucket.tokens >= 1) {
+			bucket.tokens -= 1;
+			return { allowed: true };
+		}
+
+		return {
+			allowed: false,
+			retryAfterSeconds: Math.ceil((1 - bucket.tokens) / this.ratePerSecond),
+		};
+	}
+
+	/** Drop buckets that have refilled completely (idle keys). */
+	sweep() {
+		const now = this.now();
+		for (const [key, bucket] of this.buckets) {
+			this.refill(bucket, now);
+			if (bucket.tokens >= this.burst) this.buckets.delete(key);
+		}
+	}
+
+	get size() {
+		return this.buckets.size;
+	}
+}
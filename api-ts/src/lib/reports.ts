@@ -0,0 +1,76 @@
+import type { IngestResult } from './ingestResults';
+import { JUnitParseError, parseJUnitXml } from './junit';
+import { TapParseError, parseTap } from './tap';
+
+export const REPORT_FORMATS = ['junit', 'tap'] as const;
+export type ReportFormat = (typeof REPORT_FORMATS)[number];
+
+/** Request content types parsed as text and ingested as a report. */
+export const REPORT_CONTENT_TYPES: Record<string, ReportFormat | undefined> = {
+	'application/xml': 'junit',
+	'text/xml': 'junit',
+	'text/x-tap': 'tap',
+	'application/x-tap': 'tap',
+	// Generic text: the caller has to say which format (?format=)
+	'text/plain': undefined,
+};
+
+export type ParsedReport = {
+	results: IngestResult[];
+	/** <testsuite> elements for JUnit; a TAP stream counts as one suite. */
+	suiteCount: number;
+	durationMs: number | undefined;
+	warnings: string[];
+};
+
+export class ReportParseError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'ReportParseError';
+	}
+}
+
+/** Report format for a request: `?format=` wins over the content type. */
+export function reportFormat(
+	contentType: string | undefined,
+	explicit: ReportFormat | undefined,
+): ReportFormat | undefined {
+	if (explicit) return explicit;
+	const mediaType = (contentType ?? '').split(';')[0].trim().toLowerCase();
+	return REPORT_CONTENT_TYPES[mediaType];
+}
+
+const REPORT_EXTENSIONS: Record<string, ReportFormat> = {
+	'.xml': 'junit',
+	'.tap': 'tap',
+};
+
+/**
+ * Format of one uploaded report file: `?format=`, then the part's content
+ * type, then the file extension (multipart clients often send
+ * application/octet-stream).
+ */
+export function reportFileFormat(
+	contentType: string,
+	filename: string,
+	explicit: ReportFormat | undefined,
+): ReportFormat | undefined {
+	const byType = reportFormat(contentType, explicit);
+	if (byType) return byType;
+	const dot = filename.lastIndexOf('.');
+	return dot === -1
+		? undefined
+		: REPORT_EXTENSIONS[filename.slice(dot).toLowerCase()];
+}
+
+export function parseReport(format: ReportFormat, body: string): ParsedReport {
+	try {
+		if (format === 'tap') return { ...parseTap(body), suiteCount: 1 };
+		return { ...parseJUnitXml(body), warnings: [] };
+	} catch (err) {
+		if (err instanceof JUnitParseError || err instanceof TapParseError) {
+			throw new ReportParseError(err.message);
+		}
+		throw err;
+	}
+}
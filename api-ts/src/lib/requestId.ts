@@ -0,0 +1,21 @@
+import { randomUUID } from 'node:crypto';
+import type { IncomingMessage } from 'node:http';
+
+export const REQUEST_ID_HEADER = 'x-request-id';
+
+// Accept IDs from upstream proxies/services, but only sane ones: they end up
+// verbatim in logs and response headers.
+const INCOMING_ID_PATTERN = /^[A-Za-z0-9._:-]{1,128}$/;
+
+/**
+ * Fastify genReqId: reuse a well-formed incoming X-Request-ID so logs can be
+ * correlated across services, otherwise generate a random UUID (v4, 122
+ * random bits, so collisions are not a practical concern).
+ */
+export function genRequestId(req: IncomingMessage): string {
+	const incoming = req.headers[REQUEST_ID_HEADER];
+	if (typeof incoming === 'string' && INCOMING_ID_PATTERN.test(incoming)) {
+		return incoming;
+	}
+	return randomUUID();
+}
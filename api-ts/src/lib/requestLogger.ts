@@ -0,0 +1,48 @@
+import { AsyncLocalStorage } from 'node:async_hooks';
+import type { FastifyBaseLogger, FastifyRequest } from 'fastify';
+
+const requestStore = new AsyncLocalStorage<FastifyRequest>();
+
+let defaultLogger: FastifyBaseLogger | null = null;
+
+const noop = () => {};
+
+// Used when no app logger was registered yet (scripts, early startup)
+const silentLogger: FastifyBaseLogger = {
+	level: 'silent',
+	fatal: noop,
+	error: noop,
+	warn: noop,
+	info: noop,
+	debug: noop,
+	trace: noop,
+	silent: noop,
+	child: () => silentLogger,
+};
+
+/**
+ * Run `fn` (the rest of the request lifecycle) with `req` as the current
+ * request. The request itself is stored rather than its logger, so bindings
+ * added later via addLogBindings are still picked up.
+ */
+export function runWithRequest<T>(req: FastifyRequest, fn: () => T): T {
+	return requestStore.run(req, fn);
+}
+
+export function setDefaultLogger(logger: FastifyBaseLogger) {
+	defaultLogger = logger;
+}
+
+/** ID of the current request (X-Request-ID), or null outside a request. */
+export function getRequestId(): string | null {
+	return requestStore.getStore()?.id ?? null;
+}
+
+/**
+ * Logger for the current request (carries reqId, route, orgId, ...), or the
+ * app logger outside a request. Never throws, so lib helpers can call it
+ * without being handed `req`.
+ */
+export function getLogger(): FastifyBaseLogger {
+	return requestStore.getStore()?.log ?? defaultLogger ?? silentLogger;
+}
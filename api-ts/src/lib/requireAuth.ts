@@ -17,7 +17,7 @@ export function requireAuth(
 	req: FastifyRequest,
 ): asserts req is FastifyRequest & { ctx: { auth: AuthedContext } } {
 	// Log what we see coming in
-	req.log.info({ ctx: (req as any).ctx }, 'requireAuth called – current ctx');
+	req.log.debug({ ctx: (req as any).ctx }, 'requireAuth called – current ctx');
 
 	const ctx = (req as any).ctx?.auth as AuthContext | undefined;
 
@@ -30,12 +30,14 @@ export function requireAuth(
 	}
 
 	// Success path
-	req.log.info(
+	req.log.debug(
 		{
 			orgId: ctx.orgId,
 			userId: ctx.userId,
 			strategy: ctx.strategy,
 			apiKeyId: ctx.strategy === 'apiKey' ? ctx.apiKey.id : null,
+			projectTokenId:
+				ctx.strategy === 'projectToken' ? ctx.projectToken.id : null,
 			sessionId: ctx.strategy === 'session' ? ctx.session.id : null,
 		},
 		'requireAuth: success',
@@ -51,3 +53,20 @@ export function getAuth(req: FastifyRequest): AuthedContext {
 	// At this point the assert above holds
 	return (req as any).ctx.auth as AuthedContext;
 }
+
+/**
+ * Guard for endpoints meant for machines (CI ingestion): requires an API
+ * key or project token, a valid session cookie is not enough. Throws 401
+ * otherwise.
+ */
+export function requireApiKey(req: FastifyRequest): AuthedContext {
+	const auth = getAuth(req);
+	if (auth.strategy === 'session') {
+		req.log.warn(
+			{ strategy: auth.strategy, reasonCode: 'api_key_required' },
+			'requireApiKey: rejected non-API-key auth',
+		);
+		throw req.server.httpErrors.unauthorized('API key required');
+	}
+	return auth;
+}
@@ -1,25 +1,7 @@
 import type { FastifyInstance } from 'fastify';
+import type { RunDetails } from '../repositories/types';
 
-export type RequiredRun = {
-	id: string;
-	projectId: string;
-	status: 'QUEUED' | 'RUNNING' | 'COMPLETED' | 'FAILED' | 'CANCELED';
-	createdAt: Date;
-
-	source: string | null;
-	branch: string | null;
-	commitSha: string | null;
-
-	startedAt: Date | null;
-	finishedAt: Date | null;
-	durationMs: number | null;
-
-	totalCount: number;
-	passedCount: number;
-	failedCount: number;
-	skippedCount: number;
-	errorCount: number;
-};
+export type RequiredRun = RunDetails;
 
 /**
  * Fetch a run that belongs to a given project.
@@ -30,29 +12,7 @@ export async function requireRun(
 	projectId: string,
 	runId: string
 ): Promise<RequiredRun> {
-	const run = await app.prisma.testRun.findFirst({
-		where: { id: runId, projectId },
-		select: {
-			id: true,
-			projectId: true,
-			status: true,
-			createdAt: true,
-
-			source: true,
-			branch: true,
-			commitSha: true,
-
-			startedAt: true,
-			finishedAt: true,
-			durationMs: true,
-
-			totalCount: true,
-			passedCount: true,
-			failedCount: true,
-			skippedCount: true,
-			errorCount: true,
-		},
-	});
+	const run = await app.repos.runs.get(projectId, runId);
 
 	if (!run) {
 		throw app.httpErrors.notFound('Run not found');
@@ -0,0 +1,43 @@
+import { setTimeout as delay } from 'node:timers/promises';
+
+export type RetryOptions = {
+	/** Total attempts, including the first one. */
+	attempts: number;
+	initialDelayMs: number;
+	maxDelayMs: number;
+	/** Errors for which this returns false are rethrown without retrying. */
+	shouldRetry?: (err: unknown) => boolean;
+	/** Called before waiting for the next attempt. */
+	onRetry?: (info: { attempt: number; delayMs: number; err: unknown }) => void;
+	/** Once aborted, no further attempt is made (the last error is rethrown). */
+	signal?: AbortSignal;
+};
+
+// Cut short when `signal` aborts
+const sleep = (ms: number, signal?: AbortSignal) =>
+	delay(ms, undefined, { signal }).catch(() => undefined);
+
+/**
+ * Run `fn` until it resolves, doubling the delay between attempts up to
+ * maxDelayMs. Rethrows the last error once the attempt budget is used up.
+ */
+export async function retryWithBackoff<T>(
+	fn: (attempt: number) => Promise<T>,
+	opts: RetryOptions,
+): Promise<T> {
+	let delayMs = opts.initialDelayMs;
+
+	for (let attempt = 1; ; attempt++) {
+		try {
+			return await fn(attempt);
+		} catch (err) {
+			if (attempt >= opts.attempts) throw err;
+			if (opts.shouldRetry && !opts.shouldRetry(err)) throw err;
+			if (opts.signal?.aborted) throw err;
+			opts.onRetry?.({ attempt, delayMs, err });
+			await sleep(delayMs, opts.signal);
+			if (opts.signal?.aborted) throw err;
+			delayMs = Math.min(delayMs * 2, opts.maxDelayMs);
+		}
+	}
+}
@@ -0,0 +1,92 @@
+import type { IncomingHttpHeaders } from 'node:http';
+
+/**
+ * Where a run executed, for telling environment-specific failures apart
+ * ("only fails on macOS"). All optional; os and arch are lowercased so
+ * "macOS" and "macos" group together.
+ */
+export type RunEnvironment = {
+	os?: string;
+	arch?: string;
+	/** CI runner label or machine name, e.g. "ubuntu-22.04" or "gpu-2". */
+	runner?: string;
+	/** Language/runtime version, e.g. "go1.22.3" or "node 22.4". */
+	runtime?: string;
+};
+
+export const ENVIRONMENT_KEYS = ['os', 'arch', 'runner', 'runtime'] as const;
+
+export type EnvironmentKey = (typeof ENVIRONMENT_KEYS)[number];
+
+// Header form for report uploads, whose body is the report itself
+export const ENVIRONMENT_HEADER_PREFIX = 'x-testhub-env-';
+
+const LOWERCASED = new Set<EnvironmentKey>(['os', 'arch']);
+
+// Printable, no control characters; long enough for verbose runner names
+const ENVIRONMENT_VALUE = /^[\x20-\x7e]{1,128}$/;
+
+export class EnvironmentError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'EnvironmentError';
+	}
+}
+
+export function isEnvironmentKey(key: string): key is EnvironmentKey {
+	return (ENVIRONMENT_KEYS as readonly string[]).includes(key);
+}
+
+function parseValue(key: EnvironmentKey, value: unknown) {
+	const text = typeof value === 'string' ? value.trim() : '';
+	if (!ENVIRONMENT_VALUE.test(text)) {
+		throw new EnvironmentError(
+			`Invalid environment ${key} (1-128 printable ASCII characters)`,
+		);
+	}
+	return LOWERCASED.has(key) ? text.toLowerCase() : text;
+}
+
+/**
+ * Validate an `environment` from the body merged with `X-Testhub-Env-Os`,
+ * `-Arch`, `-Runner` and `-Runtime` headers (body wins). Undefined when
+ * neither has any; throws EnvironmentError on an unknown key or a bad
+ * value.
+ */
+export function collectRunEnvironment(
+	body: Record<string, unknown> | undefined,
+	headers: IncomingHttpHeaders,
+): RunEnvironment | undefined {
+	const environment: RunEnvironment = {};
+	for (const key of ENVIRONMENT_KEYS) {
+		const header = headers[`${ENVIRONMENT_HEADER_PREFIX}${key}`];
+		const value = Array.isArray(header) ? header[0] : header;
+		if (value != null) environment[key] = parseValue(key, value);
+	}
+	for (const [key, value] of Object.entries(body ?? {})) {
+		if (!isEnvironmentKey(key)) {
+			throw new EnvironmentError(
+				`Unknown environment key "${key.slice(0, 80)}" ` +
+					`(one of ${ENVIRONMENT_KEYS.join(', ')})`,
+			);
+		}
+		environment[key] = parseValue(key, value);
+	}
+	return Object.keys(environment).length ? environment : undefined;
+}
+
+/** `?environment=key:value` (repeatable) into AND-ed key/value pairs. */
+export function parseEnvironmentFilters(raw: string | string[] | undefined) {
+	const values = raw == null ? [] : Array.isArray(raw) ? raw : [raw];
+	return values.map((entry) => {
+		const colon = entry.indexOf(':');
+		const key = colon > 0 ? entry.slice(0, colon) : '';
+		if (!isEnvironmentKey(key)) {
+			throw new EnvironmentError(
+				`Invalid environment filter "${entry.slice(0, 80)}" ` +
+					`(use key:value with a key of ${ENVIRONMENT_KEYS.join(', ')})`,
+			);
+		}
+		return { key, value: parseValue(key, entry.slice(colon + 1)) };
+	});
+}
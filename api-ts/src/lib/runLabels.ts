@@ -0,0 +1,84 @@
+import type { IncomingHttpHeaders } from 'node:http';
+
+export type RunLabels = Record<string, string>;
+
+export const MAX_RUN_LABELS = 32;
+export const LABEL_HEADER_PREFIX = 'x-testhub-label-';
+
+// Keys are lowercase (header names arrive lowercased); both stay URL- and
+// header-safe so `?label=key:value` needs no escaping in practice
+const LABEL_KEY = /^[a-z0-9](?:[a-z0-9._-]{0,61}[a-z0-9])?$/;
+const LABEL_VALUE = /^[A-Za-z0-9._:/@+=-]{1,128}$/;
+
+export class LabelError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'LabelError';
+	}
+}
+
+function checkLabel(key: string, value: unknown) {
+	if (!LABEL_KEY.test(key)) {
+		throw new LabelError(
+			`Invalid label key "${key.slice(0, 80)}" ` +
+				'(1-63 chars of a-z, 0-9, ".", "_", "-"; alphanumeric at both ends)',
+		);
+	}
+	if (typeof value !== 'string' || !LABEL_VALUE.test(value)) {
+		throw new LabelError(
+			`Invalid value for label "${key}" ` +
+				'(1-128 chars of A-Z, a-z, 0-9 and ._:/@+=-)',
+		);
+	}
+}
+
+/**
+ * Validate labels from a request body merged with `X-Testhub-Label-<key>`
+ * headers (body wins on conflicts). Throws LabelError on a bad key/value or
+ * more than MAX_RUN_LABELS labels.
+ */
+export function collectLabels(
+	body: Record<string, unknown> | undefined,
+	headers: IncomingHttpHeaders,
+): RunLabels {
+	const labels: RunLabels = {};
+	for (const [name, value] of Object.entries(headers)) {
+		if (!name.startsWith(LABEL_HEADER_PREFIX)) continue;
+		const key = name.slice(LABEL_HEADER_PREFIX.length);
+		const text = Array.isArray(value) ? value.join(',') : value;
+		checkLabel(key, text?.trim());
+		labels[key] = text!.trim();
+	}
+	for (const [key, value] of Object.entries(body ?? {})) {
+		checkLabel(key, value);
+		labels[key] = value as string;
+	}
+
+	const count = Object.keys(labels).length;
+	if (count > MAX_RUN_LABELS) {
+		throw new LabelError(
+			`Too many labels (${count}); a run can have at most ${MAX_RUN_LABELS}`,
+		);
+	}
+	return labels;
+}
+
+/** `?label=key:value` (repeatable) into AND-ed key/value pairs. */
+export function parseLabelFilters(raw: string | string[] | undefined) {
+	const values = raw == null ? [] : Array.isArray(raw) ? raw : [raw];
+	return values.map((entry) => {
+		const colon = entry.indexOf(':');
+		if (colon <= 0) {
+			throw new LabelError(`Invalid label filter "${entry}" (use key:value)`);
+		}
+		const key = entry.slice(0, colon);
+		const value = entry.slice(colon + 1);
+		checkLabel(key, value);
+		return { key, value };
+	});
+}
+
+/** Label rows (RunLabel) as a key -> value map. */
+export function labelMap(rows: { key: string; value: string }[]): RunLabels {
+	return Object.fromEntries(rows.map((row) => [row.key, row.value]));
+}
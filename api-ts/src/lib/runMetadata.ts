@@ -0,0 +1,93 @@
+import type { IncomingHttpHeaders } from 'node:http';
+
+/** VCS/CI details of a run (all optional). */
+export type RunMetadata = {
+	commitSha?: string;
+	branch?: string;
+	ciBuildUrl?: string;
+};
+
+// Header fallbacks for CI steps that can't easily change the body/query
+export const METADATA_HEADERS = {
+	commitSha: 'x-testhub-commit',
+	branch: 'x-testhub-branch',
+	ciBuildUrl: 'x-testhub-build-url',
+} as const;
+
+// Abbreviated (git's 7-char default) up to a full SHA-256 object name
+const COMMIT_SHA = /^[0-9a-f]{7,64}$/i;
+const MAX_BRANCH_LENGTH = 255;
+const MAX_BUILD_URL_LENGTH = 2048;
+
+export class RunMetadataError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'RunMetadataError';
+	}
+}
+
+/** Lowercased commit SHA; throws RunMetadataError unless 7-64 hex chars. */
+export function parseCommitSha(value: string) {
+	const sha = value.trim();
+	if (!COMMIT_SHA.test(sha)) {
+		throw new RunMetadataError(
+			`Invalid commitSha "${sha.slice(0, 80)}" (7-64 hex characters)`,
+		);
+	}
+	return sha.toLowerCase();
+}
+
+function parseBranch(value: string) {
+	const branch = value.trim();
+	if (!branch || branch.length > MAX_BRANCH_LENGTH) {
+		throw new RunMetadataError(
+			`Invalid branch (1-${MAX_BRANCH_LENGTH} characters)`,
+		);
+	}
+	return branch;
+}
+
+function parseBuildUrl(value: string) {
+	const text = value.trim();
+	let url: URL | null = null;
+	try {
+		url = new URL(text);
+	} catch {
+		// reported below
+	}
+	if (
+		!url ||
+		(url.protocol !== 'http:' && url.protocol !== 'https:') ||
+		text.length > MAX_BUILD_URL_LENGTH
+	) {
+		throw new RunMetadataError(
+			`Invalid ciBuildUrl "${text.slice(0, 80)}" (an http(s) URL)`,
+		);
+	}
+	return text;
+}
+
+const PARSERS = {
+	commitSha: parseCommitSha,
+	branch: parseBranch,
+	ciBuildUrl: parseBuildUrl,
+};
+
+/**
+ * Validate commitSha / branch / ciBuildUrl from the body (or query) with
+ * `X-Testhub-Commit`, `X-Testhub-Branch` and `X-Testhub-Build-Url` as
+ * fallbacks (body wins). Throws RunMetadataError on an invalid value.
+ */
+export function collectRunMetadata(
+	fields: RunMetadata,
+	headers: IncomingHttpHeaders,
+): RunMetadata {
+	const metadata: RunMetadata = {};
+	for (const key of Object.keys(PARSERS) as (keyof RunMetadata)[]) {
+		const header = headers[METADATA_HEADERS[key]];
+		const value =
+			fields[key] ?? (Array.isArray(header) ? header[0] : header);
+		if (value != null) metadata[key] = PARSERS[key](value);
+	}
+	return metadata;
+}
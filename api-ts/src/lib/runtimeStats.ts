@@ -0,0 +1,85 @@
+import {
+	type IntervalHistogram,
+	PerformanceObserver,
+	monitorEventLoopDelay,
+} from 'node:perf_hooks';
+import v8 from 'node:v8';
+
+/**
+ * GET /debug/stats body. Keys are part of the admin API: add new ones,
+ * never rename or drop. Sizes are bytes, times nanoseconds.
+ */
+export type RuntimeSnapshot = {
+	uptime_seconds: number;
+	/** Handles/requests keeping the event loop alive (sockets, timers...). */
+	active_resources: number;
+	/** V8 heap in use. */
+	heap_alloc: number;
+	heap_total: number;
+	heap_limit: number;
+	rss: number;
+	/** Buffers and other memory held outside the V8 heap. */
+	external: number;
+	gc_count: number;
+	/** Sum of all GC pauses since start. */
+	gc_pause_ns: number;
+	gc_last_pause_ns: number;
+	event_loop_delay_p99_ns: number;
+};
+
+/**
+ * Runtime counters for /metrics and /debug/stats. GC pauses come from
+ * `gc` performance entries and event loop delay from a sampling
+ * histogram, both recorded by V8/libuv as they happen, so reading them
+ * costs a few property lookups and no collection or heap walk of its own.
+ * Call close() on shutdown.
+ */
+export class RuntimeStats {
+	gcCount = 0;
+	gcPauseNs = 0;
+	gcLastPauseNs = 0;
+	private readonly gcObserver: PerformanceObserver;
+	private readonly loopDelay: IntervalHistogram;
+
+	constructor() {
+		this.gcObserver = new PerformanceObserver((list) => {
+			for (const entry of list.getEntries()) {
+				const ns = Math.round(entry.duration * 1e6);
+				this.gcCount++;
+				this.gcPauseNs += ns;
+				this.gcLastPauseNs = ns;
+			}
+		});
+		this.gcObserver.observe({ entryTypes: ['gc'] });
+		this.loopDelay = monitorEventLoopDelay({ resolution: 20 });
+		this.loopDelay.enable();
+	}
+
+	/** 99th percentile event loop delay since start, in nanoseconds. */
+	eventLoopDelayP99Ns() {
+		return this.loopDelay.percentile(99);
+	}
+
+	/** All values read at once, before anything is serialized. */
+	snapshot(): RuntimeSnapshot {
+		const heap = v8.getHeapStatistics();
+		return {
+			uptime_seconds: process.uptime(),
+			active_resources: process.getActiveResourcesInfo().length,
+			heap_alloc: heap.used_heap_size,
+			heap_total: heap.total_heap_size,
+			heap_limit: heap.heap_size_limit,
+			rss: process.memoryUsage.rss(),
+			external: heap.external_memory,
+			gc_count: this.gcCount,
+			gc_pause_ns: this.gcPauseNs,
+			gc_last_pause_ns: this.gcLastPauseNs,
+			event_loop_delay_p99_ns: this.eventLoopDelayP99Ns(),
+		};
+	}
+
+	close() {
+		this.gcObserver.disconnect();
+		this.loopDelay.disable();
+	}
+}
@@ -0,0 +1,187 @@
+import { createHash, createHmac } from 'node:crypto';
+import http from 'node:http';
+import https from 'node:https';
+import type { Readable } from 'node:stream';
+
+export type S3Config = {
+	bucket: string;
+	region: string;
+	/** S3-compatible endpoint (MinIO, R2, ...); path-style URLs when set. */
+	endpoint?: string;
+	accessKeyId: string;
+	secretAccessKey: string;
+	sessionToken?: string;
+};
+
+const EMPTY_SHA256 = createHash('sha256').update('').digest('hex');
+
+const hmac = (key: string | Buffer, data: string) =>
+	createHmac('sha256', key).update(data).digest();
+
+// S3 keys are encoded per path segment (slashes kept)
+const encodeKey = (key: string) =>
+	key
+		.split('/')
+		.map((segment) =>
+			encodeURIComponent(segment).replace(
+				/[!'()*]/g,
+				(c) => `%${c.charCodeAt(0).toString(16).toUpperCase()}`,
+			),
+		)
+		.join('/');
+
+/**
+ * Minimal S3 object client (PUT/GET/DELETE) signed with AWS Signature V4.
+ * Bodies are streamed both ways; uploads need their size and SHA-256 up
+ * front (the caller has staged the file and knows both).
+ */
+export class S3Client {
+	private readonly config: S3Config;
+
+	constructor(config: S3Config) {
+		this.config = config;
+	}
+
+	private objectUrl(key: string) {
+		const { bucket, region, endpoint } = this.config;
+		const path = encodeKey(key);
+		return endpoint
+			? new URL(`${endpoint.replace(/\/+$/, '')}/${bucket}/${path}`)
+			: new URL(`https://${bucket}.s3.${region}.amazonaws.com/${path}`);
+	}
+
+	private sign(
+		method: string,
+		url: URL,
+		payloadSha256: string,
+		extra: Record<string, string> = {},
+	) {
+		const amzDate = new Date().toISOString().replace(/[-:]|\.\d{3}/g, '');
+		const dateStamp = amzDate.slice(0, 8);
+		const scope = `${dateStamp}/${this.config.region}/s3/aws4_request`;
+
+		const headers: Record<string, string> = {
+			...extra,
+			host: url.host,
+			'x-amz-content-sha256': payloadSha256,
+			'x-amz-date': amzDate,
+			...(this.config.sessionToken
+				? { 'x-amz-security-token': this.config.sessionToken }
+				: {}),
+		};
+		const names = Object.keys(headers)
+			.map((name) => name.toLowerCase())
+			.sort();
+		const lower = Object.fromEntries(
+			Object.entries(headers).map(([k, v]) => [k.toLowerCase(), v]),
+		);
+		const signedHeaders = names.join(';');
+		const canonicalRequest = [
+			method,
+			url.pathname,
+			'',
+			names.map((name) => `${name}:${lower[name].trim()}\n`).join(''),
+			signedHeaders,
+			payloadSha256,
+		].join('\n');
+		const stringToSign = [
+			'AWS4-HMAC-SHA256',
+			amzDate,
+			scope,
+			createHash('sha256').update(canonicalRequest).digest('hex'),
+		].join('\n');
+
+		let key: Buffer = hmac(`AWS4${this.config.secretAccessKey}`, dateStamp);
+		for (const part of [this.config.region, 's3', 'aws4_request']) {
+			key = hmac(key, part);
+		}
+		const signature = createHmac('sha256', key)
+			.update(stringToSign)
+			.digest('hex');
+
+		return {
+			...headers,
+			authorization:
+				`AWS4-HMAC-SHA256 Credential=${this.config.accessKeyId}/${scope}, ` +
+				`SignedHeaders=${signedHeaders}, Signature=${signature}`,
+		};
+	}
+
+	private request(
+		method: string,
+		key: string,
+		opts: {
+			body?: Readable;
+			payloadSha256?: string;
+			headers?: Record<string, string>;
+		} = {},
+	) {
+		const url = this.objectUrl(key);
+		const headers = this.sign(
+			method,
+			url,
+			opts.payloadSha256 ?? EMPTY_SHA256,
+			opts.headers,
+		);
+		const transport = url.protocol === 'http:' ? http : https;
+
+		return new Promise<http.IncomingMessage>((resolve, reject) => {
+			const req = transport.request(url, { method, headers }, resolve);
+			req.on('error', reject);
+			if (opts.body) {
+				opts.body.on('error', (err) => req.destroy(err));
+				opts.body.pipe(req);
+			} else {
+				req.end();
+			}
+		});
+	}
+
+	private async expectOk(res: http.IncomingMessage, action: string) {
+		if (res.statusCode && res.statusCode < 300) {
+			res.resume();
+			return;
+		}
+		let detail = '';
+		for await (const chunk of res) {
+			if (detail.length < 1024) detail += chunk;
+		}
+		throw new Error(`S3 ${action} failed: ${res.statusCode} ${detail.trim()}`);
+	}
+
+	async putObject(
+		key: string,
+		body: Readable,
+		meta: { size: number; sha256: string; contentType: string },
+	) {
+		const res = await this.request('PUT', key, {
+			body,
+			payloadSha256: meta.sha256,
+			headers: {
+				'content-length': String(meta.size),
+				'content-type': meta.contentType,
+			},
+		});
+		await this.expectOk(res, `PUT ${key}`);
+	}
+
+	/** Streaming body, or null when the object does not exist. */
+	async getObject(key: string): Promise<Readable | null> {
+		const res = await this.request('GET', key);
+		if (res.statusCode === 404) {
+			res.resume();
+			return null;
+		}
+		if (res.statusCode !== 200) await this.expectOk(res, `GET ${key}`);
+		return res;
+	}
+
+	async deleteObject(key: string) {
+		const res = await this.request('DELETE', key);
+		if (res.statusCode === 404) {
+			res.resume();
+			return;
+		}
+		await this.expectOk(res, `DELETE ${key}`);
+	}
+}
@@ -0,0 +1,15 @@
+import type { AppConfig } from './config';
+
+/**
+ * http.Server timeouts from config (all in ms, 0 = unbounded). Fastify sets
+ * these on the server it creates; headersTimeout is applied in main().
+ */
+export function serverTimeoutOptions(
+	config: Pick<AppConfig, 'READ_TIMEOUT' | 'WRITE_TIMEOUT' | 'IDLE_TIMEOUT'>,
+) {
+	return {
+		requestTimeout: config.READ_TIMEOUT,
+		connectionTimeout: config.WRITE_TIMEOUT,
+		keepAliveTimeout: config.IDLE_TIMEOUT,
+	};
+}
@@ -0,0 +1,220 @@
+import type { IngestResult } from './ingestResults';
+
+export class TapParseError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'TapParseError';
+	}
+}
+
+export type TapReport = {
+	results: IngestResult[];
+	durationMs: number | undefined;
+	/** Non-fatal problems (plan mismatches, bail outs, ...) for the run. */
+	warnings: string[];
+};
+
+const VERSION_LINE = /^TAP version (\d+)\s*$/i;
+const PLAN_LINE = /^1\.\.(\d+)\s*(?:#\s*(.*))?$/;
+const TEST_LINE = /^(not )?ok\b\s*(\d+)?\s*(.*)$/;
+const BAIL_OUT = /^Bail out!\s*(.*)$/i;
+
+/** Split "desc # DIRECTIVE reason" on the first unescaped `#`. */
+function splitDirective(rest: string) {
+	let hash = -1;
+	for (let i = 0; i < rest.length; i++) {
+		if (rest[i] === '\\') i++;
+		else if (rest[i] === '#') {
+			hash = i;
+			break;
+		}
+	}
+	const unescape = (s: string) => s.replace(/\\([\\#])/g, '$1').trim();
+	const description = unescape(hash === -1 ? rest : rest.slice(0, hash))
+		// "ok 1 - adds": the dash only separates number and description
+		.replace(/^-\s*/, '');
+	if (hash === -1) return { description };
+
+	const comment = rest.slice(hash + 1).trim();
+	const match = /^(skip|todo)\S*\s*(.*)$/i.exec(comment);
+	if (!match) return { description };
+	return {
+		description,
+		directive: match[1].toUpperCase() as 'SKIP' | 'TODO',
+		reason: unescape(match[2]) || undefined,
+	};
+}
+
+/** Top-level `key: value` scalars of a YAML diagnostics block. */
+function yamlScalar(block: string[], key: string) {
+	for (const line of block) {
+		const match = new RegExp(`^\\s{0,4}${key}:\\s*(.+)$`).exec(line);
+		if (match) return match[1].trim().replace(/^(['"])(.*)\1$/, '$2');
+	}
+	return undefined;
+}
+
+/**
+ * Parse TAP (version 13; 12 and 14 streams are read the same way) into
+ * ingest results. `ok` is PASSED and `not ok` FAILED; `# SKIP` is SKIPPED,
+ * and `# TODO` cases that fail are SKIPPED too (TODO failures are expected).
+ * YAML diagnostics after a test line supply its message, `duration_ms` and,
+ * for failures, the stack trace. Cases are keyed by description (or "test
+ * N" without one); a repeated description keeps its last result.
+ *
+ * Only input with no plan and no test lines at all is rejected; a missing,
+ * misplaced or unmet plan, out-of-sequence numbers and "Bail out!" become
+ * warnings.
+ */
+export function parseTap(text: string): TapReport {
+	const lines = text.replace(/\r\n?/g, '\n').split('\n');
+	const warnings: string[] = [];
+
+	let plan: number | undefined;
+	let planLine = 0;
+	let testLines = 0;
+	let lastNumber = 0;
+	let ignored = 0;
+	let bailedOut = false;
+	const byId = new Map<string, IngestResult>();
+	const numbers = new Set<number>();
+
+	// The YAML block belongs to the test line right before it
+	let current: IngestResult | null = null;
+	let yaml: string[] | null = null;
+
+	const finishYaml = () => {
+		if (!current || !yaml) return;
+		const message = yamlScalar(yaml, 'message');
+		if (message && !current.message) current.message = message;
+		const duration = Number(yamlScalar(yaml, 'duration_ms'));
+		if (Number.isFinite(duration) && duration >= 0) {
+			current.durationMs = Math.round(duration);
+		}
+		if (current.status === 'FAILED') current.stacktrace = yaml.join('\n');
+		yaml = null;
+	};
+
+	for (let i = 0; i < lines.length; i++) {
+		const raw = lines[i];
+		const lineNo = i + 1;
+
+		if (yaml) {
+			if (/^\s+\.\.\.\s*$/.test(raw)) finishYaml();
+			else yaml.push(raw);
+			continue;
+		}
+		if (current && /^\s+---\s*$/.test(raw)) {
+			yaml = [];
+			continue;
+		}
+		// Indented lines are subtests or diagnostics of a parent test
+		if (/^\s/.test(raw) || raw === '') continue;
+
+		const line = raw.trimEnd();
+		let match: RegExpExecArray | null;
+
+		if ((match = VERSION_LINE.exec(line))) {
+			if (lineNo !== 1) {
+				warnings.push(
+					`line ${lineNo}: version line must be the first line`,
+				);
+			} else if (!['12', '13', '14'].includes(match[1])) {
+				warnings.push(`unsupported TAP version ${match[1]}; parsed as 13`);
+			}
+		} else if ((match = PLAN_LINE.exec(line))) {
+			if (plan != null) {
+				warnings.push(`line ${lineNo}: duplicate plan ignored`);
+				continue;
+			}
+			plan = Number(match[1]);
+			planLine = lineNo;
+			// A plan belongs before the first or after the last test line
+			if (testLines > 0) {
+				const later = lines
+					.slice(i + 1)
+					.some((l) => TEST_LINE.test(l.trimEnd()));
+				if (later) {
+					warnings.push(
+						`line ${lineNo}: plan in the middle of the tests`,
+					);
+				}
+			}
+		} else if ((match = TEST_LINE.exec(line))) {
+			testLines++;
+			const passed = !match[1];
+			const number = match[2] ? Number(match[2]) : lastNumber + 1;
+			if (match[2] && number !== lastNumber + 1) {
+				warnings.push(
+					`line ${lineNo}: test ${number} out of sequence ` +
+						`(expected ${lastNumber + 1})`,
+				);
+			}
+			if (numbers.has(number)) {
+				warnings.push(`line ${lineNo}: test number ${number} repeated`);
+			}
+			numbers.add(number);
+			lastNumber = number;
+
+			const { description, directive, reason } = splitDirective(match[3]);
+			const name = description || `test ${number}`;
+			const status =
+				directive === 'SKIP'
+					? 'SKIPPED'
+					: passed
+						? 'PASSED'
+						: directive === 'TODO'
+							? 'SKIPPED'
+							: 'FAILED';
+
+			if (byId.has(name)) {
+				warnings.push(
+					`line ${lineNo}: "${name}" reported again; last result kept`,
+				);
+				byId.delete(name);
+			}
+			current = {
+				externalId: name,
+				name,
+				status,
+				message: directive
+					? [directive, reason].filter(Boolean).join(': ')
+					: undefined,
+			};
+			byId.set(name, current);
+			continue;
+		} else if ((match = BAIL_OUT.exec(line))) {
+			warnings.push(
+				`line ${lineNo}: bailed out${match[1] ? `: ${match[1]}` : ''}`,
+			);
+			bailedOut = true;
+			break;
+		} else if (!line.startsWith('#') && !line.startsWith('pragma ')) {
+			ignored++;
+		}
+		current = null;
+	}
+	finishYaml();
+
+	if (plan == null && testLines === 0) {
+		throw new TapParseError('no TAP plan or test lines found');
+	}
+
+	if (plan == null) {
+		warnings.push('no plan line (1..N)');
+	} else if (plan !== testLines && !bailedOut) {
+		warnings.push(
+			`plan on line ${planLine} expects ${plan} test(s), got ${testLines}`,
+		);
+	}
+	if (ignored > 0) {
+		warnings.push(`${ignored} unrecognized line(s) ignored`);
+	}
+
+	const results = [...byId.values()];
+	const durationMs = results.some((r) => r.durationMs != null)
+		? results.reduce((sum, r) => sum + (r.durationMs ?? 0), 0)
+		: undefined;
+
+	return { results, durationMs, warnings };
+}
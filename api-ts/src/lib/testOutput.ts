@@ -0,0 +1,21 @@
+/**
+ * Captured output (stdout/stderr) held to `maxBytes` of UTF-8. The end is
+ * kept: output leading up to a failure is what explains it. A cut text
+ * starts with a marker line saying how much was dropped.
+ */
+export function truncateOutput(
+	text: string | undefined,
+	maxBytes: number,
+): { text: string | undefined; truncated: boolean } {
+	if (text == null) return { text, truncated: false };
+	const bytes = Buffer.from(text, 'utf8');
+	if (bytes.length <= maxBytes) return { text, truncated: false };
+
+	let start = bytes.length - maxBytes;
+	// Don't start in the middle of a multi-byte character
+	while (start < bytes.length && (bytes[start] & 0xc0) === 0x80) start++;
+	return {
+		text: `[... ${start} bytes truncated ...]\n${bytes.toString('utf8', start)}`,
+		truncated: true,
+	};
+}
@@ -0,0 +1,25 @@
+export class TimeoutError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'TimeoutError';
+	}
+}
+
+/**
+ * Reject with TimeoutError if `promise` has not settled within `ms`.
+ * The underlying work is not cancelled; callers that can abort should.
+ */
+export function withTimeout<T>(
+	promise: PromiseLike<T>,
+	ms: number,
+	label: string,
+): Promise<T> {
+	let timer: NodeJS.Timeout | undefined;
+	const timeout = new Promise<never>((_resolve, reject) => {
+		timer = setTimeout(
+			() => reject(new TimeoutError(`${label} timed out after ${ms}ms`)),
+			ms,
+		);
+	});
+	return Promise.race([promise, timeout]).finally(() => clearTimeout(timer));
+}
@@ -0,0 +1,48 @@
+import fs from 'node:fs';
+import tls from 'node:tls';
+import type { AppConfig } from './config';
+
+export type TlsOptions = { cert: Buffer; key: Buffer };
+
+export class TlsConfigError extends Error {
+	constructor(message: string) {
+		super(message);
+		this.name = 'TlsConfigError';
+	}
+}
+
+function readPemFile(key: string, filePath: string) {
+	try {
+		return fs.readFileSync(filePath);
+	} catch (err) {
+		const reason =
+			(err as NodeJS.ErrnoException).code === 'ENOENT'
+				? 'file does not exist'
+				: (err as Error).message;
+		throw new TlsConfigError(`${key} is invalid: ${filePath}: ${reason}`);
+	}
+}
+
+/**
+ * Cert/key for in-process HTTPS, or null to serve plain HTTP.
+ * Both files are read and loaded as a pair up front, so a missing file or a
+ * mismatched key fails startup instead of the first handshake.
+ */
+export function loadTlsOptions(
+	config: Pick<AppConfig, 'TLS_CERT_FILE' | 'TLS_KEY_FILE'>,
+): TlsOptions | null {
+	if (!config.TLS_CERT_FILE || !config.TLS_KEY_FILE) return null;
+
+	const cert = readPemFile('TLS_CERT_FILE', config.TLS_CERT_FILE);
+	const key = readPemFile('TLS_KEY_FILE', config.TLS_KEY_FILE);
+
+	try {
+		tls.createSecureContext({ cert, key });
+	} catch (err) {
+		throw new TlsConfigError(
+			`TLS_CERT_FILE / TLS_KEY_FILE could not be loaded as a pair: ${(err as Error).message}`,
+		);
+	}
+
+	return { cert, key };
+}
@@ -0,0 +1,184 @@
+import { randomBytes } from 'node:crypto';
+import type { FastifyBaseLogger } from 'fastify';
+
+// W3C trace context: version-traceid-parentid-flags
+const TRACEPARENT_PATTERN = /^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$/;
+const INVALID_TRACE_ID = '0'.repeat(32);
+const INVALID_SPAN_ID = '0'.repeat(16);
+
+// OTLP enums
+const SPAN_KIND_SERVER = 2;
+const STATUS_CODE_ERROR = 2;
+
+export type TraceContext = { traceId: string; parentSpanId?: string };
+
+export type Span = {
+	traceId: string;
+	spanId: string;
+	parentSpanId?: string;
+	name: string;
+	startTimeUnixNano: bigint;
+	endTimeUnixNano?: bigint;
+	attributes: Record<string, string | number>;
+	error: boolean;
+};
+
+/** Parse an incoming `traceparent` header; null when absent or malformed. */
+export function parseTraceparent(header: unknown): TraceContext | null {
+	if (typeof header !== 'string') return null;
+	const match = TRACEPARENT_PATTERN.exec(header.trim().toLowerCase());
+	if (!match) return null;
+	const [, traceId, parentSpanId] = match;
+	if (traceId === INVALID_TRACE_ID || parentSpanId === INVALID_SPAN_ID) {
+		return null;
+	}
+	return { traceId, parentSpanId };
+}
+
+export function formatTraceparent(span: Pick<Span, 'traceId' | 'spanId'>) {
+	return `00-${span.traceId}-${span.spanId}-01`;
+}
+
+function nowUnixNano(): bigint {
+	const ms = performance.timeOrigin + performance.now();
+	return BigInt(Math.round(ms * 1e6));
+}
+
+/** Start a server span, continuing the incoming trace when there is one. */
+export function startServerSpan(
+	name: string,
+	parent: TraceContext | null,
+): Span {
+	return {
+		traceId: parent?.traceId ?? randomBytes(16).toString('hex'),
+		spanId: randomBytes(8).toString('hex'),
+		parentSpanId: parent?.parentSpanId,
+		name,
+		startTimeUnixNano: nowUnixNano(),
+		attributes: {},
+		error: false,
+	};
+}
+
+export function endSpan(span: Span) {
+	span.endTimeUnixNano = nowUnixNano();
+}
+
+function toOtlpAttribute([key, value]: [string, string | number]) {
+	return {
+		key,
+		value:
+			typeof value === 'number'
+				? { intValue: String(value) }
+				: { stringValue: value },
+	};
+}
+
+function toOtlpSpan(span: Span) {
+	return {
+		traceId: span.traceId,
+		spanId: span.spanId,
+		...(span.parentSpanId ? { parentSpanId: span.parentSpanId } : {}),
+		name: span.name,
+		kind: SPAN_KIND_SERVER,
+		startTimeUnixNano: String(span.startTimeUnixNano),
+		endTimeUnixNano: String(span.endTimeUnixNano ?? span.startTimeUnixNano),
+		attributes: Object.entries(span.attributes).map(toOtlpAttribute),
+		...(span.error ? { status: { code: STATUS_CODE_ERROR } } : {}),
+	};
+}
+
+export interface SpanExporter {
+	export(span: Span): void;
+	shutdown(): Promise<void>;
+}
+
+/** Used when no OTLP endpoint is configured: spans are dropped. */
+export const noopExporter: SpanExporter = {
+	export: () => {},
+	shutdown: async () => {},
+};
+
+const MAX_BATCH = 512;
+const MAX_QUEUE = 4096;
+
+/**
+ * Batches finished spans and POSTs them as OTLP/HTTP JSON to
+ * `<endpoint>/v1/traces`. Export failures are logged and the batch dropped;
+ * tracing never fails a request. shutdown() flushes what is queued.
+ */
+export class OtlpHttpExporter implements SpanExporter {
+	private queue: Span[] = [];
+	private readonly url: string;
+	private readonly serviceName: string;
+	private readonly log: Pick<FastifyBaseLogger, 'warn'>;
+	private readonly timer: NodeJS.Timeout;
+
+	constructor(opts: {
+		endpoint: string;
+		serviceName: string;
+		flushIntervalMs: number;
+		log: Pick<FastifyBaseLogger, 'warn'>;
+	}) {
+		this.url = `${opts.endpoint.replace(/\/+$/, '')}/v1/traces`;
+		this.serviceName = opts.serviceName;
+		this.log = opts.log;
+		this.timer = setInterval(() => void this.flush(), opts.flushIntervalMs);
+		this.timer.unref();
+	}
+
+	export(span: Span) {
+		// Collector down for a while: drop new spans rather than grow forever
+		if (this.queue.length >= MAX_QUEUE) return;
+		this.queue.push(span);
+		if (this.queue.length >= MAX_BATCH) void this.flush();
+	}
+
+	async flush() {
+		while (this.queue.length) {
+			const batch = this.queue.splice(0, MAX_BATCH);
+			const body = {
+				resourceSpans: [
+					{
+						resource: {
+							attributes: [
+								toOtlpAttribute(['service.name', this.serviceName]),
+							],
+						},
+						scopeSpans: [
+							{
+								scope: { name: 'testhub-api' },
+								spans: batch.map(toOtlpSpan),
+							},
+						],
+					},
+				],
+			};
+
+			try {
+				const res = await fetch(this.url, {
+					method: 'POST',
+					headers: { 'content-type': 'application/json' },
+					body: JSON.stringify(body),
+					signal: AbortSignal.timeout(10_000),
+				});
+				if (!res.ok) {
+					this.log.warn(
+						{ status: res.status, dropped: batch.length },
+						'OTLP trace export rejected',
+					);
+				}
+			} catch (err) {
+				this.log.warn(
+					{ err, dropped: batch.length },
+					'OTLP trace export failed',
+				);
+			}
+		}
+	}
+
+	async shutdown() {
+		clearInterval(this.timer);
+		await this.flush();
+	}
+}
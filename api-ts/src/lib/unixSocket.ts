@@ -0,0 +1,41 @@
+import fs from 'node:fs';
+import net from 'node:net';
+
+function isListening(socketPath: string): Promise<boolean> {
+	return new Promise((resolve) => {
+		const probe = net.connect(socketPath);
+		probe.once('connect', () => {
+			probe.destroy();
+			resolve(true);
+		});
+		probe.once('error', () => resolve(false));
+	});
+}
+
+/**
+ * Make `socketPath` bindable: a socket file left behind by a crashed run is
+ * removed, but one that still accepts connections (another instance) or a
+ * non-socket file is an error rather than being deleted.
+ */
+export async function prepareSocketPath(socketPath: string): Promise<void> {
+	let stat: fs.Stats;
+	try {
+		stat = fs.lstatSync(socketPath);
+	} catch (err) {
+		if ((err as NodeJS.ErrnoException).code === 'ENOENT') return;
+		throw err;
+	}
+
+	if (!stat.isSocket()) {
+		throw new Error(`${socketPath} exists and is not a socket`);
+	}
+	if (await isListening(socketPath)) {
+		throw new Error(`${socketPath} is in use by another process`);
+	}
+	fs.unlinkSync(socketPath);
+}
+
+/** Best-effort removal on shutdown (Node may already have unlinked it). */
+export function removeSocketPath(socketPath: string) {
+	fs.rmSync(socketPath, { force: true });
+}
@@ -0,0 +1,16 @@
+import { systemClock, type Clock } from './clock';
+
+/**
+ * Process start time (RFC 3339). performance.timeOrigin is taken when the
+ * Node process starts, before any module is loaded.
+ */
+export const startedAt = new Date(performance.timeOrigin).toISOString();
+
+/**
+ * Seconds since process start, with ms precision. The clock's monotonic
+ * time (performance.now() for the real one) is used, so wall-clock
+ * adjustments never make it jump or go negative.
+ */
+export function uptimeSeconds(clock: Clock = systemClock): number {
+	return Math.round(clock.monotonic()) / 1000;
+}
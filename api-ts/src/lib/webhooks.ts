@@ -0,0 +1,159 @@
+import { createHmac, randomBytes, randomUUID } from 'node:crypto';
+import type { FastifyBaseLogger } from 'fastify';
+import type { RunStatus } from '../repositories/types';
+import type { Clock } from './clock';
+import { InternalAddressError, type OutboundHttpClient } from './outboundHttp';
+import { retryWithBackoff } from './retry';
+
+export const WEBHOOK_EVENTS = [
+	'run.completed',
+	'run.failed',
+	'run.regressed',
+	'run.recovered',
+] as const;
+export type WebhookEvent = (typeof WEBHOOK_EVENTS)[number];
+
+/**
+ * The branch transition a finished run makes, given the status of the
+ * finished run before it on the same branch: run.regressed when a passing
+ * branch fails, run.recovered when a failing one passes, else null (no
+ * earlier run, or no change).
+ */
+export function transitionEvent(
+	previous: RunStatus | null,
+	current: RunStatus,
+): WebhookEvent | null {
+	if (previous === 'COMPLETED' && current === 'FAILED') return 'run.regressed';
+	if (previous === 'FAILED' && current === 'COMPLETED') return 'run.recovered';
+	return null;
+}
+
+export const SIGNATURE_HEADER = 'x-testhub-signature';
+export const TIMESTAMP_HEADER = 'x-testhub-timestamp';
+
+export type WebhookTarget = { id: string; url: string; secret: string };
+
+export type DeliveryOptions = {
+	attempts: number;
+	/** Carries the per-attempt timeout and the outbound proxy. */
+	http: OutboundHttpClient;
+	/** Stamps `createdAt` and each attempt's signed timestamp. */
+	clock: Clock;
+	log: FastifyBaseLogger;
+	/**
+	 * Ends the delivery, the attempt in flight and any retry, when it
+	 * aborts: req.abortSignal for a delivery made inside a request, so a
+	 * slow receiver can't hold it past its deadline.
+	 */
+	signal?: AbortSignal;
+};
+
+/** Shown to the subscriber once, at creation. */
+export function generateWebhookSecret() {
+	return `whsec_${randomBytes(24).toString('base64url')}`;
+}
+
+/**
+ * `sha256=<hex HMAC of "<timestamp>.<body>">`. Receivers recompute it with
+ * the shared secret and should reject stale timestamps (replays).
+ */
+export function signWebhook(secret: string, timestamp: string, body: string) {
+	const mac = createHmac('sha256', secret)
+		.update(`${timestamp}.${body}`)
+		.digest('hex');
+	return `sha256=${mac}`;
+}
+
+class DeliveryError extends Error {
+	readonly retryable: boolean;
+
+	constructor(message: string, retryable: boolean) {
+		super(message);
+		this.name = 'DeliveryError';
+		this.retryable = retryable;
+	}
+}
+
+/**
+ * POST one event to one subscriber. 5xx, 429, timeouts and network errors
+ * are retried with exponential backoff; other statuses are final, and so
+ * is an aborted `signal`. Never throws: a delivery that ultimately fails
+ * is logged and dropped.
+ */
+export async function deliverWebhook(
+	target: WebhookTarget,
+	event: WebhookEvent,
+	data: unknown,
+	opts: DeliveryOptions,
+): Promise<boolean> {
+	const deliveryId = randomUUID();
+	const body = JSON.stringify({
+		id: deliveryId,
+		event,
+		createdAt: opts.clock.now().toISOString(),
+		data,
+	});
+	const log = opts.log.child({ webhookId: target.id, deliveryId, event });
+
+	try {
+		await retryWithBackoff(
+			async () => {
+				const now = opts.clock.now().getTime();
+				const timestamp = String(Math.floor(now / 1000));
+				const signature = signWebhook(target.secret, timestamp, body);
+				let res: { status: number };
+				try {
+					res = await opts.http.request(target.url, {
+						method: 'POST',
+						headers: {
+							'content-type': 'application/json',
+							'user-agent': 'testhub-webhooks',
+							'x-testhub-event': event,
+							'x-testhub-delivery': deliveryId,
+							[TIMESTAMP_HEADER]: timestamp,
+							[SIGNATURE_HEADER]: signature,
+						},
+						body,
+						signal: opts.signal,
+					});
+				} catch (err) {
+					if (opts.signal?.aborted) {
+						const reason = opts.signal.reason;
+						throw new DeliveryError(
+							`canceled: ${reason instanceof Error ? reason.message : String(reason)}`,
+							false,
+						);
+					}
+					// An internal target stays internal; don't knock again
+					throw new DeliveryError(
+						err instanceof Error ? err.message : String(err),
+						!(err instanceof InternalAddressError),
+					);
+				}
+				if (res.status >= 200 && res.status < 300) return;
+				throw new DeliveryError(
+					`receiver responded ${res.status}`,
+					res.status >= 500 || res.status === 429,
+				);
+			},
+			{
+				attempts: opts.attempts,
+				initialDelayMs: 500,
+				maxDelayMs: 30_000,
+				shouldRetry: (err) => err instanceof DeliveryError && err.retryable,
+				signal: opts.signal,
+				onRetry: ({ attempt, delayMs, err }) => {
+					log.warn(
+						{ err, attempt, retryInMs: delayMs },
+						'webhook delivery failed, retrying',
+					);
+				},
+			},
+		);
+		log.info('webhook delivered');
+		return true;
+	} catch (err) {
+		log.error({ err, url: target.url }, 'webhook delivery failed');
+		return false;
+	}
+}
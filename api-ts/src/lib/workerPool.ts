@@ -0,0 +1,85 @@
+import type { FastifyBaseLogger } from 'fastify';
+
+type Job = { name: string; run: () => Promise<unknown> };
+
+/**
+ * In-process background jobs (webhook deliveries, queued report ingests)
+ * run `concurrency` at a time. The queue holds at most `maxQueued` jobs:
+ * tryEnqueue() refuses more instead of buffering without bound, so callers
+ * push back (503) or do the work themselves. Jobs are not persisted; a
+ * crash loses what was queued.
+ */
+export class WorkerPool {
+	readonly concurrency: number;
+	readonly maxQueued: number;
+	private readonly log: FastifyBaseLogger;
+	private readonly queue: Job[] = [];
+	private running = 0;
+	private closed = false;
+	private idle: (() => void)[] = [];
+
+	constructor(opts: {
+		concurrency: number;
+		maxQueued: number;
+		log: FastifyBaseLogger;
+	}) {
+		this.concurrency = opts.concurrency;
+		this.maxQueued = opts.maxQueued;
+		this.log = opts.log;
+	}
+
+	/** Jobs waiting for a worker. */
+	get queued() {
+		return this.queue.length;
+	}
+
+	/** Jobs being run. */
+	get active() {
+		return this.running;
+	}
+
+	/** Whether tryEnqueue would accept a job right now. */
+	hasCapacity() {
+		return !this.closed && this.queue.length < this.maxQueued;
+	}
+
+	/**
+	 * Queue `run`; false (nothing queued) when the queue is full or the pool
+	 * is draining. A job that throws is logged under `name`.
+	 */
+	tryEnqueue(name: string, run: () => Promise<unknown>) {
+		if (!this.hasCapacity()) return false;
+		this.queue.push({ name, run });
+		this.next();
+		return true;
+	}
+
+	/** Refuse new jobs and resolve once every queued and running job is done. */
+	drain() {
+		this.closed = true;
+		if (!this.running && !this.queue.length) return Promise.resolve();
+		return new Promise<void>((resolve) => this.idle.push(resolve));
+	}
+
+	private next() {
+		while (this.running < this.concurrency && this.queue.length) {
+			const job = this.queue.shift()!;
+			this.running++;
+			void this.execute(job);
+		}
+		if (!this.running && !this.queue.length) {
+			for (const resolve of this.idle.splice(0)) resolve();
+		}
+	}
+
+	private async execute(job: Job) {
+		try {
+			await job.run();
+		} catch (err) {
+			this.log.error({ err, job: job.name }, 'background job failed');
+		} finally {
+			this.running--;
+			this.next();
+		}
+	}
+}
@@ -0,0 +1,192 @@
+export type XmlElement = {
+	name: string;
+	attrs: Record<string, string>;
+	children: XmlElement[];
+	text: string;
+	line: number;
+};
+
+export class XmlParseError extends Error {
+	readonly line: number;
+
+	constructor(message: string, line: number) {
+		super(`line ${line}: ${message}`);
+		this.name = 'XmlParseError';
+		this.line = line;
+	}
+}
+
+const NAME = /[A-Za-z_:][\w.:-]*/y;
+const ATTR = /\s*([A-Za-z_:][\w.:-]*)\s*=\s*("([^"]*)"|'([^']*)')/y;
+const NAMED_ENTITIES: Record<string, string> = {
+	lt: '<',
+	gt: '>',
+	amp: '&',
+	quot: '"',
+	apos: "'",
+};
+
+/**
+ * Small non-validating XML parser (elements, attributes, text, CDATA) for
+ * test reports. Comments, processing instructions and DOCTYPE are skipped;
+ * only the predefined and numeric entities are decoded (no DTD expansion).
+ */
+export function parseXml(src: string): XmlElement {
+	let pos = 0;
+	let line = 1;
+	const stack: XmlElement[] = [];
+	let root: XmlElement | null = null;
+
+	const fail = (message: string): never => {
+		throw new XmlParseError(message, line);
+	};
+
+	const advance = (to: number) => {
+		for (let i = pos; i < to; i++) if (src.charCodeAt(i) === 10) line++;
+		pos = to;
+	};
+
+	const decode = (value: string) =>
+		value.replace(/&(#x[0-9a-fA-F]+|#\d+|\w+);?/g, (match, ref: string) => {
+			if (!match.endsWith(';')) fail(`unterminated entity "${match}"`);
+			if (ref.startsWith('#')) {
+				const code = ref.startsWith('#x')
+					? parseInt(ref.slice(2), 16)
+					: Number(ref.slice(1));
+				if (code > 0x10ffff) fail(`invalid character reference "${match}"`);
+				return String.fromCodePoint(code);
+			}
+			const named = NAMED_ENTITIES[ref];
+			if (named == null) fail(`unknown entity "&${ref};"`);
+			return named;
+		});
+
+	const appendText = (text: string) => {
+		const current = stack[stack.length - 1];
+		if (current) current.text += text;
+		else if (text.trim()) fail('text outside the root element');
+	};
+
+	const skipPast = (terminator: string, what: string) => {
+		const end = src.indexOf(terminator, pos);
+		if (end === -1) fail(`unterminated ${what}`);
+		const content = src.slice(pos, end);
+		advance(end + terminator.length);
+		return content;
+	};
+
+	while (pos < src.length) {
+		const lt = src.indexOf('<', pos);
+		if (lt === -1) {
+			appendText(decode(src.slice(pos)));
+			advance(src.length);
+			break;
+		}
+		if (lt > pos) {
+			appendText(decode(src.slice(pos, lt)));
+			advance(lt);
+		}
+
+		if (src.startsWith('<!--', pos)) {
+			advance(pos + 4);
+			skipPast('-->', 'comment');
+		} else if (src.startsWith('<![CDATA[', pos)) {
+			advance(pos + 9);
+			appendText(skipPast(']]>', 'CDATA section'));
+		} else if (src.startsWith('<?', pos)) {
+			advance(pos + 2);
+			skipPast('?>', 'processing instruction');
+		} else if (src.startsWith('<!DOCTYPE', pos)) {
+			advance(pos + 9);
+			const doctype = skipPast('>', 'DOCTYPE');
+			if (doctype.includes('[')) {
+				fail('DOCTYPE with internal subset is not supported');
+			}
+		} else if (src.startsWith('</', pos)) {
+			advance(pos + 2);
+			NAME.lastIndex = pos;
+			const match = NAME.exec(src);
+			if (!match) fail('malformed closing tag');
+			const name = match![0];
+			advance(pos + name.length);
+			const closing = skipPast('>', `closing tag </${name}>`);
+			if (closing.trim()) fail(`unexpected characters in closing tag </${name}>`);
+			const open = stack.pop();
+			if (!open) fail(`unexpected closing tag </${name}>`);
+			if (open!.name !== name) {
+				fail(
+					`expected </${open!.name}> (opened on line ${open!.line}) ` +
+						`but found </${name}>`,
+				);
+			}
+		} else {
+			advance(pos + 1);
+			NAME.lastIndex = pos;
+			const match = NAME.exec(src);
+			if (!match) fail('malformed tag');
+			const element: XmlElement = {
+				name: match![0],
+				attrs: {},
+				children: [],
+				text: '',
+				line,
+			};
+			advance(pos + element.name.length);
+
+			for (;;) {
+				ATTR.lastIndex = pos;
+				const attr = ATTR.exec(src);
+				if (!attr) break;
+				element.attrs[attr[1]] = decode(attr[3] ?? attr[4] ?? '');
+				advance(ATTR.lastIndex);
+			}
+
+			const rest = /\s*(\/?)>/y;
+			rest.lastIndex = pos;
+			const end = rest.exec(src);
+			if (!end) fail(`malformed attributes in <${element.name}>`);
+			advance(rest.lastIndex);
+
+			const parent = stack[stack.length - 1];
+			if (parent) parent.children.push(element);
+			else if (root) fail('more than one root element');
+			else root = element;
+
+			if (!end![1]) stack.push(element);
+		}
+	}
+
+	if (stack.length) {
+		const open = stack[stack.length - 1];
+		fail(`<${open.name}> opened on line ${open.line} is never closed`);
+	}
+	if (!root) fail('document has no root element');
+	return root!;
+}
+
+// Not allowed anywhere in XML 1.0, not even as character references
+// (e.g. the ESC of ANSI colours in captured output); lone surrogates too
+const INVALID_XML_CHARS =
+	/[\u0000-\u0008\u000B\u000C\u000E-\u001F\uFFFE\uFFFF]|[\uD800-\uDBFF](?![\uDC00-\uDFFF])|(?<![\uD800-\uDBFF])[\uDC00-\uDFFF]/g;
+
+/** Text content escaped for XML; invalid characters are dropped. */
+export function escapeXmlText(value: string) {
+	return value
+		.replace(INVALID_XML_CHARS, '')
+		.replace(/&/g, '&amp;')
+		.replace(/</g, '&lt;')
+		.replace(/>/g, '&gt;');
+}
+
+/**
+ * Attribute value escaped for a double-quoted attribute. Tabs and line
+ * breaks become character references so they survive attribute value
+ * normalization.
+ */
+export function escapeXmlAttr(value: string) {
+	return escapeXmlText(value)
+		.replace(/"/g, '&quot;')
+		.replace(/\t/g, '&#9;')
+		.replace(/\n/g, '&#10;')
+		.replace(/\r/g, '&#13;');
+}
@@ -0,0 +1,74 @@
+import http from 'node:http';
+import type { IncomingMessage } from 'node:http';
+import fp from 'fastify-plugin';
+import type { FastifyInstance, FastifyPluginAsync } from 'fastify';
+import { sendProblem } from '../lib/problem';
+
+// Requests that arrived on the admin listener
+const adminRequests = new WeakSet<IncomingMessage>();
+
+/** Paths served only by the admin listener when TESTHUB_ADMIN_PORT is set. */
+export function isAdminPath(path: string) {
+	return (
+		path === '/metrics' ||
+		path === '/health' ||
+		path === '/ready' ||
+		path === '/livez' ||
+		path === '/readyz' ||
+		path.startsWith('/debug/')
+	);
+}
+
+/**
+ * With TESTHUB_ADMIN_PORT set, split routes between the two listeners: admin
+ * paths (metrics, pprof, probes and their aliases) answer 404 on the public
+ * port, and the admin port serves nothing else. Both listeners share one Fastify instance,
+ * so hooks, auth and readiness state are the same. Without the port this
+ * plugin does nothing.
+ */
+export const adminListenerPlugin: FastifyPluginAsync = fp(async (app) => {
+	if (!app.config.TESTHUB_ADMIN_PORT) return;
+
+	app.addHook('onRequest', async (req, reply) => {
+		const path = req.url.split('?', 1)[0];
+		if (isAdminPath(path) !== adminRequests.has(req.raw)) {
+			return sendProblem(reply, 404, 'Not found');
+		}
+	});
+});
+
+/**
+ * Start the admin listener on TESTHUB_ADMIN_HOST:TESTHUB_ADMIN_PORT. Call
+ * after app.ready(); close it with closeAdminServer on shutdown.
+ */
+export async function startAdminServer(app: FastifyInstance) {
+	const server = http.createServer((req, res) => {
+		adminRequests.add(req);
+		app.routing(req, res);
+	});
+	// Same limits as the public server (see lib/serverTimeouts.ts)
+	server.requestTimeout = app.config.READ_TIMEOUT;
+	server.headersTimeout = app.config.HEADERS_TIMEOUT;
+	server.keepAliveTimeout = app.config.IDLE_TIMEOUT;
+	server.setTimeout(app.config.WRITE_TIMEOUT);
+
+	const host = app.config.TESTHUB_ADMIN_HOST;
+	const port = app.config.TESTHUB_ADMIN_PORT;
+	await new Promise<void>((resolve, reject) => {
+		server.once('error', reject);
+		server.listen(port, host, () => {
+			server.off('error', reject);
+			resolve();
+		});
+	});
+	app.log.info({ host, port }, 'admin listener started');
+	return server;
+}
+
+/** Stop accepting admin connections and wait for open requests. */
+export function closeAdminServer(server: http.Server) {
+	return new Promise<void>((resolve, reject) => {
+		server.close((err) => (err ? reject(err) : resolve()));
+		server.closeIdleConnections();
+	});
+}
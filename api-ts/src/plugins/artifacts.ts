@@ -0,0 +1,33 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import {
+	createArtifactStorage,
+	type ArtifactStorage,
+} from '../lib/artifactStorage';
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		artifactStorage: ArtifactStorage;
+		/**
+		 * Best-effort removal of stored blobs whose rows were deleted (run or
+		 * project deletes cascade in the DB only). Failures are logged.
+		 */
+		removeArtifactBlobs(storageKeys: string[]): Promise<void>;
+	}
+}
+
+export const artifactsPlugin: FastifyPluginAsync = fp(async (app) => {
+	const storage = createArtifactStorage(app.config);
+	app.decorate('artifactStorage', storage);
+	app.log.info({ storage: storage.kind }, 'artifact storage configured');
+
+	app.decorate('removeArtifactBlobs', async (storageKeys: string[]) => {
+		for (const key of storageKeys) {
+			try {
+				await storage.delete(key);
+			} catch (err) {
+				app.log.warn({ err, storageKey: key }, 'artifact blob delete failed');
+			}
+		}
+	});
+});
@@ -1,8 +1,118 @@
 import fp from 'fastify-plugin';
-import type { FastifyPluginAsync } from 'fastify';
-import { parseApiKey, sha256Hex, safeEqualHex } from '../lib/apiKey';
+import type {
+	FastifyPluginAsync,
+	FastifyReply,
+	FastifyRequest,
+} from 'fastify';
+import {
+	parseApiKey,
+	readPresentedApiKey,
+	sha256Hex,
+	safeEqualHex,
+} from '../lib/apiKey';
+import {
+	isProjectTokenPrefix,
+	requiredTokenScope,
+	type TokenScope,
+} from '../lib/projectTokens';
+import { API_VERSION_PREFIX } from '../routes/versions';
+import { addLogBindings } from './requestContext';
 
 export const authPlugin: FastifyPluginAsync = fp(async (app) => {
+	/**
+	 * Project token auth: the token must be live, its scopes must cover
+	 * the route (see requiredTokenScope) and the route's project must be
+	 * the token's. 401 for a bad token, 403 for a good one used elsewhere.
+	 */
+	async function authenticateProjectToken(
+		req: FastifyRequest,
+		reply: FastifyReply,
+		prefix: string,
+		presentedHash: string,
+		now: Date,
+	) {
+		const token = await app.prisma.projectToken.findUnique({
+			where: { prefix },
+			select: {
+				id: true,
+				prefix: true,
+				hash: true,
+				scopes: true,
+				revokedAt: true,
+				expiresAt: true,
+				projectId: true,
+				project: {
+					select: { orgId: true, org: { select: { id: true, slug: true } } },
+				},
+			},
+		});
+
+		if (!token) throw app.httpErrors.unauthorized('Invalid API key');
+		if (token.revokedAt) throw app.httpErrors.unauthorized('API key revoked');
+		if (token.expiresAt && token.expiresAt <= now) {
+			throw app.httpErrors.unauthorized('API key expired');
+		}
+		if (!safeEqualHex(token.hash, presentedHash)) {
+			throw app.httpErrors.unauthorized('Invalid API key');
+		}
+
+		const { orgId } = token.project;
+		const scopes = token.scopes as TokenScope[];
+		req.ctx.auth = {
+			isAuthenticated: true,
+			strategy: 'projectToken',
+			projectToken: {
+				id: token.id,
+				prefix: token.prefix,
+				projectId: token.projectId,
+				scopes,
+			},
+			orgId,
+			userId: null,
+		};
+		req.ctx.org = { id: token.project.org.id, slug: token.project.org.slug };
+		req.ctx.user = null;
+
+		addLogBindings(req, reply, { orgId, authStrategy: 'projectToken' });
+
+		// Unmatched routes are left to the 404 handler
+		const route = req.routeOptions.url;
+		if (route !== undefined) {
+			const needed = requiredTokenScope(
+				req.method,
+				route.replace(API_VERSION_PREFIX, ''),
+			);
+			if (!needed) {
+				throw app.httpErrors.forbidden(
+					'Project tokens cannot be used for this endpoint',
+				);
+			}
+			if (!scopes.includes(needed)) {
+				throw app.httpErrors.forbidden(`Token lacks the ${needed} scope`);
+			}
+
+			const { projectId } = req.params as { projectId: string };
+			const resolved = await app.repos.projects.resolve(orgId, projectId);
+			if (resolved?.project.id !== token.projectId) {
+				req.log.warn(
+					{ reasonCode: 'cross_project_token', projectTokenId: token.id },
+					'auth.token.forbidden',
+				);
+				throw app.httpErrors.forbidden('Token is not valid for this project');
+			}
+		}
+
+		// best-effort lastUsedAt
+		app.prisma.projectToken
+			.update({ where: { id: token.id }, data: { lastUsedAt: now } })
+			.catch((err: unknown) => {
+				req.log.warn(
+					{ err, projectTokenId: token.id },
+					'Failed to update ProjectToken.lastUsedAt',
+				);
+			});
+	}
+
 	app.addHook('onRequest', async (req, reply) => {
 		if (req.ctx.auth.isAuthenticated) return;
 
@@ -48,6 +158,11 @@ export const authPlugin: FastifyPluginAsync = fp(async (app) => {
 						? { id: session.user.id, email: session.user.email }
 						: { id: session.userId };
 
+					addLogBindings(req, reply, {
+						orgId: session.orgId,
+						authStrategy: 'session',
+					});
+
 					app.prisma.session
 						.update({ where: { id: session.id }, data: { lastSeenAt: now } })
 						.catch((err: unknown) => {
@@ -78,11 +193,7 @@ export const authPlugin: FastifyPluginAsync = fp(async (app) => {
 			}
 		}
 
-		const header = req.headers['x-api-key'];
-		if (header == null) return;
-
-		// Fastify headers can be string | string[] | undefined
-		const raw = Array.isArray(header) ? header[0] : header;
+		const raw = readPresentedApiKey(req.headers);
 		if (!raw) return;
 
 		const parsed = parseApiKey(raw);
@@ -94,6 +205,10 @@ export const authPlugin: FastifyPluginAsync = fp(async (app) => {
 		const presentedHash = sha256Hex(rawKey);
 		const now = new Date();
 
+		if (isProjectTokenPrefix(prefix)) {
+			return authenticateProjectToken(req, reply, prefix, presentedHash, now);
+		}
+
 		const apiKey = await app.prisma.apiKey.findUnique({
 			where: { prefix },
 			select: {
@@ -137,6 +252,8 @@ export const authPlugin: FastifyPluginAsync = fp(async (app) => {
 				? { id: apiKey.userId }
 				: null;
 
+		addLogBindings(req, reply, { orgId: apiKey.orgId, authStrategy: 'apiKey' });
+
 		// best-effort lastUsedAt
 		app.prisma.apiKey
 			.update({ where: { id: apiKey.id }, data: { lastUsedAt: now } })
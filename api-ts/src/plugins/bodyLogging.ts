@@ -0,0 +1,53 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync, FastifyRequest } from 'fastify';
+import { loggableBody } from '../lib/bodyLog';
+import { logRedactKeys } from '../lib/logger';
+
+// Levels at which bodies are logged (when REQUEST_LOG_BODIES is on)
+const BODY_LOG_LEVELS = new Set(['debug', 'trace']);
+
+/**
+ * With REQUEST_LOG_BODIES=true and LOG_LEVEL=debug, logs each request body
+ * ("request body", once Fastify has parsed it, before the handler) and
+ * response body ("response body", before compression) of paths not in
+ * REQUEST_LOG_SKIP_PATHS. Bodies are capped at REQUEST_LOG_BODY_MAX_BYTES
+ * and JSON has its sensitive fields masked (see lib/bodyLog.ts). Nothing
+ * is read that Fastify didn't already buffer: multipart uploads (left
+ * unparsed for their handlers) are skipped and streamed responses
+ * (artifact downloads, /docs assets) are logged as "[stream]".
+ *
+ * For debugging only: bodies can hold personal data and secrets the
+ * masking doesn't know about, and serializing them costs CPU on every
+ * request.
+ */
+export const bodyLoggingPlugin: FastifyPluginAsync = fp(async (app) => {
+	const redactKeys = logRedactKeys(app.config);
+
+	const enabled = (req: FastifyRequest) =>
+		app.config.REQUEST_LOG_BODIES &&
+		BODY_LOG_LEVELS.has(req.log.level) &&
+		!app.config.REQUEST_LOG_SKIP_PATHS.includes(req.url.split('?', 1)[0]);
+
+	app.addHook('preHandler', async (req) => {
+		if (!enabled(req)) return;
+		const body = loggableBody(req.body, req.headers['content-type'], {
+			maxBytes: app.config.REQUEST_LOG_BODY_MAX_BYTES,
+			redactKeys,
+		});
+		if (body !== undefined) req.log.debug({ body }, 'request body');
+	});
+
+	app.addHook('onSend', async (req, reply, payload) => {
+		// A HEAD response has the GET payload here but never sends it
+		if (!enabled(req) || req.method === 'HEAD') return payload;
+		const body = loggableBody(
+			payload,
+			String(reply.getHeader('content-type') ?? ''),
+			{ maxBytes: app.config.REQUEST_LOG_BODY_MAX_BYTES, redactKeys },
+		);
+		if (body !== undefined) {
+			req.log.debug({ statusCode: reply.statusCode, body }, 'response body');
+		}
+		return payload;
+	});
+});
@@ -0,0 +1,18 @@
+import fp from 'fastify-plugin';
+import type { Clock } from '../lib/clock';
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		/** Time for anything that must be testable (see lib/clock.ts). */
+		clock: Clock;
+	}
+}
+
+export type ClockPluginOptions = {
+	clock: Clock;
+};
+
+/** Exposes the clock buildApp was given (systemClock by default). */
+export const clockPlugin = fp<ClockPluginOptions>(async (app, opts) => {
+	app.decorate('clock', opts.clock);
+});
@@ -0,0 +1,63 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { promisify } from 'node:util';
+import zlib from 'node:zlib';
+
+const gzip = promisify(zlib.gzip);
+
+// Already compressed (or not worth compressing) content types
+const INCOMPRESSIBLE_TYPE = /^(image|video|audio|font)\/|^application\/(zip|gzip|x-gzip|x-bzip2|x-7z-compressed|octet-stream|pdf)\b/i;
+
+/** True when Accept-Encoding lists gzip (or *) without q=0. */
+export function acceptsGzip(header: string | string[] | undefined): boolean {
+	const value = Array.isArray(header) ? header.join(',') : (header ?? '');
+	return value.split(',').some((part) => {
+		const [coding, ...params] = part.trim().toLowerCase().split(';');
+		if (coding !== 'gzip' && coding !== '*') return false;
+		const q = params.find((p) => p.trim().startsWith('q='));
+		return !q || Number(q.trim().slice(2)) > 0;
+	});
+}
+
+function appendVary(current: unknown, value: string) {
+	const existing = current == null ? '' : String(current);
+	const values = existing.split(',').map((v) => v.trim().toLowerCase());
+	if (values.includes(value.toLowerCase())) return existing;
+	return existing ? `${existing}, ${value}` : value;
+}
+
+/**
+ * gzip string/Buffer response bodies of at least COMPRESSION_MIN_BYTES when
+ * the client accepts it. Streams (e.g. /docs assets), already-encoded
+ * responses and incompressible content types are sent as-is.
+ */
+export const compressionPlugin: FastifyPluginAsync = fp(async (app) => {
+	const { COMPRESSION_LEVEL, COMPRESSION_MIN_BYTES } = app.config;
+	if (COMPRESSION_LEVEL === 0) return;
+
+	app.addHook('onSend', async (req, reply, payload) => {
+		if (typeof payload !== 'string' && !Buffer.isBuffer(payload)) {
+			return payload;
+		}
+		if (reply.statusCode === 204 || reply.statusCode === 304) return payload;
+		if (reply.hasHeader('content-encoding')) return payload;
+
+		const contentType = String(reply.getHeader('content-type') ?? '');
+		if (INCOMPRESSIBLE_TYPE.test(contentType)) return payload;
+
+		const body = Buffer.isBuffer(payload) ? payload : Buffer.from(payload);
+		if (body.length < COMPRESSION_MIN_BYTES) return payload;
+
+		// The representation depends on Accept-Encoding from here on
+		reply.header(
+			'vary',
+			appendVary(reply.getHeader('vary'), 'Accept-Encoding'),
+		);
+		if (!acceptsGzip(req.headers['accept-encoding'])) return payload;
+
+		const compressed = await gzip(body, { level: COMPRESSION_LEVEL });
+		reply.header('content-encoding', 'gzip');
+		reply.removeHeader('content-length');
+		return compressed;
+	});
+});
@@ -0,0 +1,73 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import {
+	HOT_RELOAD_KEYS,
+	diffConfig,
+	loadConfig,
+	type AppConfig,
+} from '../lib/config';
+import { loadRawEnv } from '../lib/envFile';
+import { reopenLogFiles } from '../lib/logger';
+
+/**
+ * Re-read the env file on SIGHUP and apply hot-reloadable keys in place
+ * (handlers read app.config per request). Process env can't change under a
+ * running process, so in practice this picks up edits to .env /
+ * TESTHUB_ENV_FILE. Changed startup-only keys are logged, not applied.
+ * LOG_FILE is reopened first, so logrotate can send SIGHUP after rotating.
+ */
+export const configReloadPlugin: FastifyPluginAsync = fp(async (app) => {
+	const reload = () => {
+		let next: AppConfig;
+		try {
+			next = loadConfig(loadRawEnv());
+		} catch (err) {
+			app.log.error({ err }, 'config reload failed; keeping current config');
+			return;
+		}
+
+		const changed = diffConfig(app.config, next);
+		if (!changed.length) {
+			app.log.info('config reload: no changes');
+			return;
+		}
+
+		const applied = changed.filter((key) => HOT_RELOAD_KEYS.includes(key));
+		const restartRequired = changed.filter(
+			(key) => !HOT_RELOAD_KEYS.includes(key),
+		);
+
+		for (const key of applied) {
+			(app.config as Record<string, unknown>)[key] = next[key];
+		}
+		if (applied.includes('LOG_LEVEL')) {
+			app.log.level = next.LOG_LEVEL;
+		}
+
+		if (applied.length) {
+			app.log.info({ keys: applied }, 'config reload: applied');
+		}
+		if (restartRequired.length) {
+			app.log.warn(
+				{ keys: restartRequired },
+				'config reload: these keys changed but require a restart',
+			);
+		}
+	};
+
+	const onSighup = () => {
+		reopenLogFiles()
+			.catch((err) => {
+				app.log.error({ err }, 'log file reopen failed; keeping current file');
+			})
+			.finally(() => {
+				app.log.info('SIGHUP received, reloading config');
+				reload();
+			});
+	};
+
+	process.on('SIGHUP', onSighup);
+	app.addHook('onClose', async () => {
+		process.off('SIGHUP', onSighup);
+	});
+});
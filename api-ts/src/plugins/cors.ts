@@ -1,12 +1,23 @@
 import fp from 'fastify-plugin';
 import cors from '@fastify/cors';
 import type { FastifyPluginAsync } from 'fastify';
+import { REQUEST_ID_HEADER } from '../lib/requestId';
 
+/**
+ * CORS from config. Origins default to WEB_APP_URL; "*" (development only,
+ * enforced by loadConfig) reflects the request origin, so it still works
+ * with credentials. @fastify/cors answers OPTIONS preflights.
+ */
 export const corsPlugin: FastifyPluginAsync = fp(async (app) => {
+	const origins = app.config.TESTHUB_CORS_ALLOWED_ORIGINS.length
+		? app.config.TESTHUB_CORS_ALLOWED_ORIGINS
+		: [app.config.WEB_APP_URL]; // e.g. "http://localhost:5173"
+
 	await app.register(cors, {
-		origin: app.config.WEB_APP_URL, // e.g. "http://localhost:5173"
-		credentials: true,
-		methods: ['GET', 'POST', 'PUT', 'PATCH', 'DELETE', 'OPTIONS'],
-		allowedHeaders: ['content-type', 'x-api-key'],
+		origin: origins.includes('*') ? true : origins,
+		credentials: app.config.TESTHUB_CORS_ALLOW_CREDENTIALS,
+		methods: app.config.TESTHUB_CORS_ALLOWED_METHODS,
+		allowedHeaders: app.config.TESTHUB_CORS_ALLOWED_HEADERS,
+		exposedHeaders: [REQUEST_ID_HEADER, 'traceparent'],
 	});
 });
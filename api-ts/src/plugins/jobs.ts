@@ -0,0 +1,56 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { withTimeout } from '../lib/timeout';
+import { WorkerPool } from '../lib/workerPool';
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		/** Background job pool (see lib/workerPool.ts). */
+		jobs: WorkerPool;
+		/** Webhook delivery pool, kept apart from `jobs`. */
+		webhookJobs: WorkerPool;
+	}
+}
+
+/**
+ * Two pools: `jobs`, WORKER_POOL_SIZE workers over a queue of
+ * WORKER_QUEUE_SIZE, and `webhookJobs` (WEBHOOK_WORKER_POOL_SIZE /
+ * WEBHOOK_QUEUE_SIZE), so a backlog of deliveries never blocks ingests. On
+ * close both stop taking jobs and are drained for up to
+ * WORKER_DRAIN_TIMEOUT. Registered after prisma, so that happens before the
+ * DB pools close.
+ */
+export const jobsPlugin: FastifyPluginAsync = fp(async (app) => {
+	const pools = {
+		jobs: new WorkerPool({
+			concurrency: app.config.WORKER_POOL_SIZE,
+			maxQueued: app.config.WORKER_QUEUE_SIZE,
+			log: app.log,
+		}),
+		webhooks: new WorkerPool({
+			concurrency: app.config.WEBHOOK_WORKER_POOL_SIZE,
+			maxQueued: app.config.WEBHOOK_QUEUE_SIZE,
+			log: app.log,
+		}),
+	};
+	app.decorate('jobs', pools.jobs);
+	app.decorate('webhookJobs', pools.webhooks);
+
+	app.addHook('onClose', async () => {
+		const busy = Object.entries(pools).filter(
+			([, pool]) => pool.queued || pool.active,
+		);
+		if (!busy.length) return;
+		for (const [name, { queued, active }] of busy) {
+			app.log.info(
+				{ pool: name, queued, active },
+				'waiting for background jobs',
+			);
+		}
+		await withTimeout(
+			Promise.all(busy.map(([, pool]) => pool.drain())),
+			app.config.WORKER_DRAIN_TIMEOUT,
+			'background jobs',
+		).catch((err) => app.log.warn({ err }, 'abandoning background jobs'));
+	});
+});
@@ -0,0 +1,73 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { isAdminPath } from './adminListener';
+import { sendProblem } from '../lib/problem';
+
+// Methods that never write, so they keep working in maintenance mode
+const READ_METHODS = new Set(['GET', 'HEAD', 'OPTIONS']);
+
+export type MaintenanceState = {
+	enabled: boolean;
+	/** When maintenance mode was last switched on (null while off). */
+	since: Date | null;
+};
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		maintenance(): MaintenanceState;
+		/** Switch maintenance mode; `source` is logged ("SIGUSR1", "admin"). */
+		setMaintenance(enabled: boolean, source: string): MaintenanceState;
+	}
+}
+
+/**
+ * Maintenance mode, for schema migrations and the like: while on, every
+ * write (anything but GET/HEAD/OPTIONS) answers 503 with Retry-After
+ * (MAINTENANCE_RETRY_AFTER) and `error: "maintenance"`, and reads are
+ * served as usual. Probes and /debug/ paths are never blocked, so the pod
+ * stays live and ready and the switch stays reachable.
+ *
+ * Starts as MAINTENANCE_MODE; SIGUSR1 toggles it, and with
+ * TESTHUB_ADMIN_PORT set so does PUT /debug/maintenance.
+ */
+export const maintenancePlugin: FastifyPluginAsync = fp(async (app) => {
+	let state: MaintenanceState = {
+		enabled: app.config.MAINTENANCE_MODE,
+		since: app.config.MAINTENANCE_MODE ? app.clock.now() : null,
+	};
+	if (state.enabled) app.log.warn('maintenance mode on at startup');
+
+	app.decorate('maintenance', () => ({ ...state }));
+
+	app.decorate('setMaintenance', (enabled: boolean, source: string) => {
+		if (enabled !== state.enabled) {
+			state = { enabled, since: enabled ? app.clock.now() : null };
+			app.log.warn(
+				{ source },
+				enabled ? 'maintenance mode on' : 'maintenance mode off',
+			);
+		}
+		return { ...state };
+	});
+
+	app.addHook('onRequest', async (req, reply) => {
+		if (!state.enabled || READ_METHODS.has(req.method)) return;
+		if (isAdminPath(req.url.split('?', 1)[0])) return;
+
+		const retryAfter = Math.ceil(app.config.MAINTENANCE_RETRY_AFTER / 1000);
+		reply.header('retry-after', String(retryAfter));
+		return sendProblem(reply, 503, 'Writes are disabled for maintenance', {
+			error: 'maintenance',
+		});
+	});
+
+	// Node's default SIGUSR1 action (start the inspector) no longer runs
+	// once a listener is installed
+	const onSigusr1 = () => {
+		app.setMaintenance(!state.enabled, 'SIGUSR1');
+	};
+	process.on('SIGUSR1', onSigusr1);
+	app.addHook('onClose', async () => {
+		process.off('SIGUSR1', onSigusr1);
+	});
+});
@@ -0,0 +1,229 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import v8 from 'node:v8';
+import {
+	Counter,
+	Gauge,
+	Histogram,
+	MetricsRegistry,
+	PROMETHEUS_CONTENT_TYPE,
+} from '../lib/metrics';
+import { PoolStatsSampler, type PoolStats } from '../lib/poolStats';
+import { RuntimeStats } from '../lib/runtimeStats';
+import type { WorkerPool } from '../lib/workerPool';
+
+const DURATION_BUCKETS = [
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+];
+
+/**
+ * Prometheus metrics at GET /metrics (METRICS_ENABLED). Metric names are
+ * documented in docs/architecture.md. The `route` label is the route
+ * pattern (/v1/projects/:projectId), never the raw URL, so IDs don't create
+ * new series; unmatched requests share route="unmatched".
+ */
+export const metricsPlugin: FastifyPluginAsync = fp(async (app) => {
+	if (!app.config.METRICS_ENABLED) return;
+
+	const registry = new MetricsRegistry();
+
+	const requestsTotal = registry.register(
+		new Counter(
+			'http_requests_total',
+			'HTTP requests by method, route and status',
+		),
+	);
+	const requestDuration = registry.register(
+		new Histogram(
+			'http_request_duration_seconds',
+			'HTTP request latency by method and route',
+			DURATION_BUCKETS,
+		),
+	);
+	const inFlight = registry.register(
+		new Gauge(
+			'http_requests_in_flight',
+			'HTTP requests currently being served',
+		),
+	);
+
+	// Runtime
+	const runtime = new RuntimeStats();
+	app.addHook('onClose', async () => runtime.close());
+
+	registry.register(
+		new Counter('process_cpu_seconds_total', 'User + system CPU time', () => {
+			const { user, system } = process.cpuUsage();
+			return (user + system) / 1e6;
+		}),
+	);
+	registry.register(
+		new Gauge(
+			'process_resident_memory_bytes',
+			'Resident set size',
+			() => process.memoryUsage.rss(),
+		),
+	);
+	registry.register(
+		new Gauge(
+			'process_start_time_seconds',
+			'Process start time since the Unix epoch',
+			() => Math.round(performance.timeOrigin / 1000),
+		),
+	);
+	registry.register(
+		new Gauge(
+			'nodejs_heap_size_used_bytes',
+			'V8 heap in use',
+			() => v8.getHeapStatistics().used_heap_size,
+		),
+	);
+	registry.register(
+		new Gauge(
+			'nodejs_heap_size_total_bytes',
+			'V8 heap allocated',
+			() => v8.getHeapStatistics().total_heap_size,
+		),
+	);
+	registry.register(
+		new Gauge(
+			'nodejs_eventloop_lag_p99_seconds',
+			'99th percentile event loop delay',
+			() => runtime.eventLoopDelayP99Ns() / 1e9,
+		),
+	);
+	registry.register(
+		new Gauge(
+			'nodejs_active_resources',
+			'Handles and requests keeping the event loop alive',
+			() => process.getActiveResourcesInfo().length,
+		),
+	);
+	registry.register(
+		new Counter('nodejs_gc_runs_total', 'Garbage collections', () => {
+			return runtime.gcCount;
+		}),
+	);
+	registry.register(
+		new Counter(
+			'nodejs_gc_pause_seconds_total',
+			'Time spent paused in garbage collection',
+			() => runtime.gcPauseNs / 1e9,
+		),
+	);
+
+	// Background jobs, labelled pool="jobs" / "webhooks"
+	const jobPools = { jobs: app.jobs, webhooks: app.webhookJobs };
+	const perJobPool = (value: (pool: WorkerPool) => number) => () =>
+		Object.entries(jobPools).map(([pool, jobs]) => ({
+			labels: { pool },
+			value: value(jobs),
+		}));
+	registry.register(
+		new Gauge(
+			'background_jobs_queued',
+			'Background jobs waiting for a worker',
+			perJobPool((pool) => pool.queued),
+		),
+	);
+	registry.register(
+		new Gauge(
+			'background_jobs_running',
+			'Background jobs being run',
+			perJobPool((pool) => pool.active),
+		),
+	);
+
+	// DB connection pools, labelled pool="primary" / "replica"
+	const poolInterval = app.config.TESTHUB_DB_POOL_METRICS_INTERVAL;
+	if (poolInterval > 0) {
+		const sampler = new PoolStatsSampler(
+			{
+				primary: app.db.primary(),
+				...(app.db.hasReplica ? { replica: app.db.replica() } : {}),
+			},
+			poolInterval,
+			(err, pool) => app.log.warn({ err, pool }, 'pool stats sample failed'),
+		);
+		// Registered after prisma, so this runs before the pools disconnect
+		app.addHook('onClose', async () => sampler.close());
+
+		const perPool = (stat: keyof PoolStats) => () =>
+			[...sampler.current()].map(([pool, stats]) => ({
+				labels: { pool },
+				value: stats[stat],
+			}));
+		registry.register(
+			new Gauge(
+				'db_pool_connections_open',
+				'Connections held by the pool, busy or idle',
+				perPool('open'),
+			),
+		);
+		registry.register(
+			new Gauge(
+				'db_pool_connections_busy',
+				'Connections checked out by a query',
+				perPool('busy'),
+			),
+		);
+		registry.register(
+			new Gauge(
+				'db_pool_connections_idle',
+				'Open connections not in use',
+				perPool('idle'),
+			),
+		);
+		registry.register(
+			new Gauge(
+				'db_pool_waiting_queries',
+				'Queries waiting for a free connection',
+				perPool('waiting'),
+			),
+		);
+		registry.register(
+			new Counter(
+				'db_pool_acquires_total',
+				'Connections handed out to queries',
+				perPool('acquires'),
+			),
+		);
+		registry.register(
+			new Counter(
+				'db_pool_acquire_wait_seconds_total',
+				'Time queries spent waiting for a connection',
+				perPool('waitSeconds'),
+			),
+		);
+	}
+
+	registry.register(
+		new Gauge(
+			'maintenance_mode',
+			'1 while writes are disabled for maintenance',
+			() => (app.maintenance().enabled ? 1 : 0),
+		),
+	);
+
+	app.addHook('onRequest', async () => {
+		inFlight.inc();
+	});
+
+	app.addHook('onResponse', async (req, reply) => {
+		inFlight.dec();
+		const route = req.routeOptions.url ?? 'unmatched';
+		requestsTotal.inc({
+			method: req.method,
+			route,
+			status: String(reply.statusCode),
+		});
+		requestDuration.observe(
+			{ method: req.method, route },
+			reply.elapsedTime / 1000,
+		);
+	});
+
+	app.get('/metrics', async (_req, reply) => {
+		return reply.type(PROMETHEUS_CONTENT_TYPE).send(registry.render());
+	});
+});
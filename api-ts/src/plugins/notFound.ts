@@ -0,0 +1,55 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { sendProblem } from '../lib/problem';
+
+type RouteMatcher = { method: string; pattern: RegExp };
+
+function escapeRegExp(value: string) {
+	return value.replace(/[.+?^${}()|[\]\\]/g, '\\$&');
+}
+
+// /v1/projects/:projectId/runs -> ^/v1/projects/[^/]+/runs/?$
+function compileRoutePattern(url: string) {
+	const source = url
+		.split('/')
+		.map((segment) =>
+			segment.startsWith(':') ? '[^/]+' : escapeRegExp(segment),
+		)
+		.join('/');
+	return new RegExp(`^${source}/?$`);
+}
+
+/**
+ * Problem-details 404/405 (see lib/problem). Fastify answers a known path with
+ * an unregistered method as 404; here it becomes 405 with an Allow header.
+ * Must be registered before the routes so onRoute sees them all.
+ */
+export const notFoundPlugin: FastifyPluginAsync = fp(async (app) => {
+	const routes: RouteMatcher[] = [];
+
+	app.addHook('onRoute', (route) => {
+		// Wildcards (CORS preflight, /docs assets) would match every path
+		if (route.url.includes('*')) return;
+		const methods = Array.isArray(route.method) ? route.method : [route.method];
+		const pattern = compileRoutePattern(route.url);
+		for (const method of methods) {
+			routes.push({ method: String(method).toUpperCase(), pattern });
+		}
+	});
+
+	app.setNotFoundHandler(async (req, reply) => {
+		const path = req.url.split('?', 1)[0];
+		const allowed = [
+			...new Set(
+				routes.filter((r) => r.pattern.test(path)).map((r) => r.method),
+			),
+		];
+
+		if (allowed.length) {
+			reply.header('allow', allowed.join(', '));
+			return sendProblem(reply, 405, 'Method not allowed');
+		}
+
+		return sendProblem(reply, 404, 'Not found');
+	});
+});
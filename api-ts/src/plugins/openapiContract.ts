@@ -12,10 +12,21 @@ import { OpenAPIBackend } from 'openapi-backend';
 import Ajv from 'ajv';
 import addFormats from 'ajv-formats';
 
+import {
+	httpDate,
+	jsonEtag,
+	notModified,
+	publicCacheControl,
+} from '../lib/etag';
+import { startedAt } from '../lib/uptime';
+import { API_VERSION_PREFIX } from '../routes/versions';
+
 type OpenApiSpec = {
 	openapi: string;
 	info: unknown;
+	servers?: { url: string }[];
 	paths?: Record<string, Record<string, unknown>>;
+	[key: string]: unknown;
 };
 
 function normalizeFastifyRoute(url: string) {
@@ -33,6 +44,45 @@ const METHODS = new Set([
 	'HEAD',
 ]);
 
+/**
+ * The contract with its paths rebuilt from the registered routes
+ * ("GET /v1/projects/{projectId}"): documented operations are copied from
+ * the contract, undocumented ones get a stub so they still show up, and
+ * contract entries with no route are dropped. Routes outside the contract's
+ * base path (/health, /auth/...) get a root `servers` override.
+ */
+export function routeSpec(spec: OpenApiSpec, registered: Iterable<string>) {
+	const serverUrl = (spec.servers?.[0]?.url ?? '').replace(/\/$/, '');
+	const basePath = new URL(serverUrl, 'http://localhost').pathname.replace(
+		/\/$/,
+		'',
+	);
+	const rootUrl = serverUrl.slice(0, serverUrl.length - basePath.length);
+	const rootServers = [{ url: rootUrl || '/' }];
+
+	const paths: Record<string, Record<string, unknown>> = {};
+	for (const key of [...registered].sort()) {
+		const [method, url] = key.split(' ', 2);
+		const inBase = basePath && url.startsWith(`${basePath}/`);
+		const path = inBase ? url.slice(basePath.length) : url;
+		const documented = spec.paths?.[path];
+
+		const entry = (paths[path] ??= {});
+		if (!inBase) entry.servers = documented?.servers ?? rootServers;
+		if (documented?.parameters) entry.parameters = documented.parameters;
+		entry[method.toLowerCase()] = documented?.[method.toLowerCase()] ?? {
+			summary: `${method} ${url}`,
+			responses: { default: { description: 'Not documented in the contract' } },
+		};
+	}
+	return { ...spec, paths };
+}
+
+/** application/json and structured +json types (problem+json, ...). */
+function isJsonMediaType(mediaType: string) {
+	return mediaType === 'application/json' || mediaType.endsWith('+json');
+}
+
 function toPlainQuery(searchParams: URLSearchParams) {
 	// last-value-wins for duplicate keys (fine for v1)
 	const out: Record<string, string> = {};
@@ -84,6 +134,8 @@ export const openapiContractPlugin: FastifyPluginAsync = fp(async (app) => {
 		const url = normalizeFastifyRoute(route.url);
 		const methods = Array.isArray(route.method) ? route.method : [route.method];
 
+		// Wildcards are CORS preflight and the /docs assets
+		if (route.url.includes('*') || route.url.startsWith('/docs')) return;
 		for (const m of methods) {
 			const method = String(m).toUpperCase();
 			if (!METHODS.has(method)) continue;
@@ -92,6 +144,32 @@ export const openapiContractPlugin: FastifyPluginAsync = fp(async (app) => {
 		}
 	});
 
+	// Spec for the routes actually served; built once, after every route is
+	// registered, so it only changes with a restart
+	let served:
+		| { spec: ReturnType<typeof routeSpec>; etag: string }
+		| undefined;
+	app.get('/openapi.json', async (req, reply) => {
+		if (!served) {
+			const body = routeSpec(spec, registered);
+			served = { spec: body, etag: jsonEtag(body) };
+		}
+		const { etag } = served;
+		const lastModified = new Date(startedAt);
+		const maxAge = app.config.OPENAPI_CACHE_MAX_AGE;
+		reply
+			.header('cache-control', publicCacheControl(maxAge))
+			.header('etag', etag)
+			.header('last-modified', httpDate(lastModified))
+			// Set here too, not only when compression gzips the body, so a 304
+			// or a small response is cached under the same key
+			.header('vary', 'Accept-Encoding');
+		if (notModified(req.headers, { etag, lastModified })) {
+			return reply.code(304).send();
+		}
+		return served.spec;
+	});
+
 	// Request validation against OpenAPI (params/query/body)
 	// Note: we skip /docs + swagger assets.
 	app.addHook('preValidation', async (req) => {
@@ -104,7 +182,8 @@ export const openapiContractPlugin: FastifyPluginAsync = fp(async (app) => {
 		const fullUrl = new URL(req.url, 'http://localhost'); // base irrelevant
 		const requestObject = {
 			method,
-			path: fullUrl.pathname,
+			// Contract paths are relative to the /v1 server URL
+			path: fullUrl.pathname.replace(API_VERSION_PREFIX, '') || '/',
 			query: toPlainQuery(fullUrl.searchParams),
 			headers: req.headers as Record<string, any>,
 			body: req.body as any,
@@ -114,6 +193,25 @@ export const openapiContractPlugin: FastifyPluginAsync = fp(async (app) => {
 		const match = oas.matchOperation(requestObject as any);
 		if (!match || !(match as any).operation) return;
 
+		// OpenAPIBackend only validates JSON bodies. Other media types the
+		// operation declares (JUnit XML, TAP, multipart uploads) are checked
+		// by their routes; anything else is refused rather than let past
+		// the contract
+		const declared = (match as any).operation.requestBody?.content as
+			| Record<string, unknown>
+			| undefined;
+		const mediaType = req.headers['content-type']
+			?.split(';', 1)[0]
+			.trim()
+			.toLowerCase();
+		if (declared && mediaType && !isJsonMediaType(mediaType)) {
+			if (mediaType in declared) return;
+			throw app.httpErrors.unsupportedMediaType(
+				`Content-Type ${mediaType} is not accepted here ` +
+					`(expected ${Object.keys(declared).join(', ')})`,
+			);
+		}
+
 		const result = oas.validateRequest(requestObject as any);
 		if (result?.errors?.length) {
 			throw app.httpErrors.badRequest('OpenAPI request validation failed', {
@@ -1,19 +1,104 @@
 import fp from 'fastify-plugin';
+import type { FastifyBaseLogger } from 'fastify';
 import prismaPkg from '@prisma/client';
+import { withPoolParams } from '../lib/config';
+import { retryWithBackoff } from '../lib/retry';
+import { logQuery } from '../lib/queryLog';
 
 const { PrismaClient } = prismaPkg;
 
+/**
+ * Connection pools. `replica()` is the read replica when
+ * TESTHUB_DB_REPLICA_HOST is set and the primary otherwise; use it only for
+ * reads that tolerate replication lag.
+ */
+export type DbPools = {
+	primary(): PrismaClient;
+	replica(): PrismaClient;
+	readonly hasReplica: boolean;
+};
+
 declare module 'fastify' {
 	interface FastifyInstance {
+		/** Same client as `db.primary()`. */
 		prisma: PrismaClient;
+		db: DbPools;
+		/**
+		 * Disconnect all pools. Runs from onClose after requests drain; safe
+		 * to call again (e.g. when the shutdown timeout cuts the drain short).
+		 */
+		closeDbPools(): Promise<void>;
 	}
 }
 
+/**
+ * Disconnects `pools` (nulls skipped) on the first call; later calls,
+ * including ones made while that is still running, get the same promise.
+ */
+export function poolCloser(
+	pools: Array<{ $disconnect(): Promise<void> } | null>,
+	log: FastifyBaseLogger,
+) {
+	const open = pools.filter((pool) => pool !== null);
+	let closing: Promise<void> | null = null;
+	return () => {
+		closing ??= (async () => {
+			const startedAt = Date.now();
+			await Promise.all(open.map((pool) => pool.$disconnect()));
+			log.info(
+				{ pools: open.length, durationMs: Date.now() - startedAt },
+				'database pools closed',
+			);
+		})();
+		return closing;
+	};
+}
+
 export const prismaPlugin = fp(async (app) => {
-	// Create per Fastify instance
-	const prisma = new PrismaClient();
+	// Postgres may still be starting (compose, k8s); retry instead of
+	// crash-looping, then fail startup once the budget is used up.
+	async function connect(
+		url: string,
+		target: 'primary' | 'replica',
+	): Promise<PrismaClient> {
+		const client = new PrismaClient({
+			datasourceUrl: withPoolParams(url, app.config),
+			// Every query as an event, for logQuery (debug / slow queries)
+			log: [{ emit: 'event', level: 'query' }],
+		});
+		client.$on('query', (event) => {
+			logQuery(app.log, event, {
+				slowMs: app.config.TESTHUB_DB_SLOW_QUERY_THRESHOLD,
+				target,
+			});
+		});
+		await retryWithBackoff(
+			async (attempt) => {
+				app.log.info({ attempt, target }, 'connecting to database');
+				await client.$connect();
+				await client.$queryRaw`SELECT 1`;
+			},
+			{
+				attempts: app.config.TESTHUB_DB_CONNECT_ATTEMPTS,
+				initialDelayMs: 250,
+				maxDelayMs: app.config.TESTHUB_DB_CONNECT_BACKOFF_MAX,
+				onRetry: ({ attempt, delayMs, err }) => {
+					app.log.warn(
+						{ err, attempt, target, retryInMs: delayMs },
+						'database connection failed, retrying',
+					);
+				},
+			},
+		);
+		app.log.info({ target }, 'database connected');
+		return client;
+	}
 
-	await prisma.$connect();
+	// Create per Fastify instance
+	const prisma = await connect(app.config.DATABASE_URL, 'primary');
+	const replica = app.config.DATABASE_REPLICA_URL
+		? await connect(app.config.DATABASE_REPLICA_URL, 'replica')
+		: null;
 
 	const requiredTables = [
 		'User',
@@ -55,11 +140,25 @@ export const prismaPlugin = fp(async (app) => {
 	}
 
 	app.decorate('prisma', prisma);
+	app.decorate('db', {
+		primary: () => prisma,
+		replica: () => replica ?? prisma,
+		hasReplica: replica !== null,
+	});
+	app.addReadinessCheck({
+		name: 'db',
+		check: () => prisma.$queryRaw`SELECT 1`,
+	});
+	if (replica) {
+		app.addReadinessCheck({
+			name: 'db-replica',
+			check: () => replica.$queryRaw`SELECT 1`,
+		});
+	}
+
+	app.decorate('closeDbPools', poolCloser([prisma, replica], app.log));
 
-	app.addHook('onClose', (instance, done) => {
-		instance.prisma
-			.$disconnect()
-			.then(() => done())
-			.catch((err) => done(err));
+	app.addHook('onClose', async (instance) => {
+		await instance.closeDbPools();
 	});
 });
@@ -0,0 +1,53 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { TokenBucketLimiter } from '../lib/rateLimiter';
+import { clientIp } from '../lib/clientIp';
+
+const SWEEP_INTERVAL_MS = 60_000;
+
+/**
+ * Per-client-IP rate limit for every route (RATE_LIMIT_PER_SECOND /
+ * RATE_LIMIT_BURST, 0 per second disables it). clientIp() honours
+ * X-Forwarded-For / X-Real-IP only from trusted proxies, so clients can't
+ * spoof it. The limits are read per request, so a SIGHUP reload applies
+ * them (including turning the limit on or off); a change starts every
+ * client on a full bucket again.
+ */
+export const rateLimitPlugin: FastifyPluginAsync = fp(async (app) => {
+	if (app.config.RATE_LIMIT_PER_SECOND === 0) {
+		app.log.info('rate limiting disabled (RATE_LIMIT_PER_SECOND=0)');
+	}
+
+	let limiter: TokenBucketLimiter | null = null;
+	// The limiter for the current limits, rebuilt when a reload changed them
+	const currentLimiter = () => {
+		const { RATE_LIMIT_PER_SECOND: rate, RATE_LIMIT_BURST: burst } =
+			app.config;
+		if (rate === 0) return (limiter = null);
+		if (limiter?.ratePerSecond !== rate || limiter.burst !== burst) {
+			limiter = new TokenBucketLimiter(rate, burst);
+		}
+		return limiter;
+	};
+
+	const sweepTimer = setInterval(() => limiter?.sweep(), SWEEP_INTERVAL_MS);
+	sweepTimer.unref();
+	app.addHook('onClose', async () => {
+		clearInterval(sweepTimer);
+	});
+
+	app.addHook('onRequest', async (req, reply) => {
+		const active = currentLimiter();
+		if (!active) return;
+		const ip = clientIp(req);
+		const result = active.take(ip);
+		if (result.allowed) return;
+
+		req.log.warn(
+			{ ip, reasonCode: 'rate_limited' },
+			'request rate limited',
+		);
+		reply.header('retry-after', String(result.retryAfterSeconds));
+		throw app.httpErrors.tooManyRequests('Rate limit exceeded');
+	});
+});
@@ -0,0 +1,97 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { withTimeout } from '../lib/timeout';
+
+const DEFAULT_CHECK_TIMEOUT_MS = 2000;
+
+export type ReadinessCheck = {
+	name: string;
+	check: () => PromiseLike<unknown>;
+	timeoutMs?: number;
+};
+
+export type ReadinessCheckResult = {
+	name: string;
+	status: 'ok' | 'error';
+	durationMs: number;
+	error?: string;
+};
+
+export type ReadinessReport = {
+	ok: boolean;
+	status: 'ok' | 'unavailable';
+	checks: ReadinessCheckResult[];
+};
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		addReadinessCheck(check: ReadinessCheck): void;
+		runReadinessChecks(): Promise<ReadinessReport>;
+		/** Make /ready fail from now on (shutdown drain). */
+		markNotReady(): void;
+	}
+}
+
+async function runCheck(check: ReadinessCheck): Promise<ReadinessCheckResult> {
+	const started = performance.now();
+	const timeoutMs = check.timeoutMs ?? DEFAULT_CHECK_TIMEOUT_MS;
+	try {
+		await withTimeout(check.check(), timeoutMs, `${check.name} check`);
+		return {
+			name: check.name,
+			status: 'ok',
+			durationMs: Math.round(performance.now() - started),
+		};
+	} catch (err) {
+		return {
+			name: check.name,
+			status: 'error',
+			durationMs: Math.round(performance.now() - started),
+			error: err instanceof Error ? err.message : String(err),
+		};
+	}
+}
+
+/**
+ * Registry of dependency checks behind /ready.
+ * Plugins owning a dependency register a check (see prismaPlugin); all
+ * checks run in parallel, each with its own timeout, and any failure makes
+ * the whole report "unavailable". After markNotReady() the report is always
+ * unavailable, so load balancers stop routing before the server closes.
+ */
+export const readinessPlugin: FastifyPluginAsync = fp(async (app) => {
+	const checks: ReadinessCheck[] = [];
+	let shuttingDown = false;
+
+	app.decorate('markNotReady', () => {
+		shuttingDown = true;
+	});
+
+	app.decorate('addReadinessCheck', (check: ReadinessCheck) => {
+		if (checks.some((c) => c.name === check.name)) {
+			throw new Error(`Readiness check "${check.name}" already registered`);
+		}
+		checks.push(check);
+	});
+
+	app.decorate('runReadinessChecks', async (): Promise<ReadinessReport> => {
+		if (shuttingDown) {
+			return {
+				ok: false,
+				status: 'unavailable',
+				checks: [
+					{
+						name: 'shutdown',
+						status: 'error',
+						durationMs: 0,
+						error: 'server is shutting down',
+					},
+				],
+			};
+		}
+
+		const results = await Promise.all(checks.map(runCheck));
+		const ok = results.every((r) => r.status === 'ok');
+		return { ok, status: ok ? 'ok' : 'unavailable', checks: results };
+	});
+});
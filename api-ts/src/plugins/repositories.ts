@@ -0,0 +1,45 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import type { Prisma } from '@prisma/client';
+import { withDbRetry } from '../lib/dbRetry';
+import { createPrismaRepositories, withTx } from '../repositories/prisma';
+import type { Repositories } from '../repositories/types';
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		repos: Repositories;
+		/** See withTx in repositories/prisma. */
+		withTx<T>(
+			fn: (repos: Repositories, tx: Prisma.TransactionClient) => Promise<T>,
+			opts?: { timeoutMs?: number },
+		): Promise<T>;
+	}
+}
+
+// Long enough for a restarted Postgres to accept connections again
+const RETRY_DELAY_MS = 200;
+
+/**
+ * `app.repos` retries a call once when the connection was lost (Postgres
+ * restart, failover); `/ready` fails through the `db` check meanwhile.
+ * `withTx` repositories are not wrapped (see withDbRetry).
+ */
+export const repositoriesPlugin: FastifyPluginAsync = fp(async (app) => {
+	const repos = createPrismaRepositories(app.db.primary(), app.db.replica());
+	const retrying = <T extends object>(name: string, target: T) =>
+		withDbRetry(target, {
+			delayMs: RETRY_DELAY_MS,
+			onRetry: ({ method, err }) => {
+				app.log.warn(
+					{ err, call: `${name}.${method}`, retryInMs: RETRY_DELAY_MS },
+					'database connection lost, retrying',
+				);
+			},
+		});
+
+	app.decorate('repos', {
+		projects: retrying('projects', repos.projects),
+		runs: retrying('runs', repos.runs),
+	});
+	app.decorate('withTx', (fn, opts) => withTx(app.db.primary(), fn, opts));
+});
@@ -1,5 +1,12 @@
 import fp from 'fastify-plugin';
-import type { FastifyPluginAsync } from 'fastify';
+import type {
+	FastifyPluginAsync,
+	FastifyReply,
+	FastifyRequest,
+} from 'fastify';
+import type { TokenScope } from '../lib/projectTokens';
+import { REQUEST_ID_HEADER } from '../lib/requestId';
+import { runWithRequest, setDefaultLogger } from '../lib/requestLogger';
 
 export type AuthContext =
 	| {
@@ -16,6 +23,18 @@ export type AuthContext =
 			orgId: string;
 			userId: string | null;
 	  }
+	| {
+			isAuthenticated: true;
+			strategy: 'projectToken';
+			projectToken: {
+				id: string;
+				prefix: string;
+				projectId: string;
+				scopes: TokenScope[];
+			};
+			orgId: string;
+			userId: null;
+	  }
 	| {
 			isAuthenticated: true;
 			strategy: 'session';
@@ -48,8 +67,37 @@ declare module 'fastify' {
 	}
 }
 
+/**
+ * Merge fields into every subsequent log line of this request
+ * (req.log and reply.log, including the per-request access log line).
+ * The app-level logger is unaffected.
+ */
+export function addLogBindings(
+	req: FastifyRequest,
+	reply: FastifyReply,
+	bindings: Record<string, unknown>,
+) {
+	req.log = req.log.child(bindings);
+	reply.log = req.log;
+}
+
 export const requestContextPlugin: FastifyPluginAsync = fp(async (app) => {
-	app.addHook('onRequest', async (req) => {
+	setDefaultLogger(app.log);
+
+	// Make the request available to getLogger() for the rest of its lifecycle
+	app.addHook('onRequest', (req, _reply, done) => {
+		runWithRequest(req, done);
+	});
+
+	app.addHook('onRequest', async (req, reply) => {
+		// Echo the (incoming or generated) ID so clients can quote it
+		reply.header(REQUEST_ID_HEADER, req.id);
+
+		// Route pattern (e.g. /projects/:projectId/runs), not the raw URL
+		if (req.routeOptions.url) {
+			addLogBindings(req, reply, { route: req.routeOptions.url });
+		}
+
 		req.ctx = {
 			requestId: req.id,
 			user: null,
@@ -0,0 +1,56 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { clientIp } from '../lib/clientIp';
+
+/**
+ * Whether a successful request is in the sample. Hashes the request ID
+ * (FNV-1a) rather than counting, so the outcome depends only on the request
+ * and a given reqId is either always or never logged.
+ */
+export function inLogSample(reqId: string, rate: number) {
+	if (rate <= 1) return true;
+	let hash = 0x811c9dc5;
+	for (let i = 0; i < reqId.length; i++) {
+		hash ^= reqId.charCodeAt(i);
+		hash = Math.imul(hash, 0x01000193);
+	}
+	return (hash >>> 0) % rate === 0;
+}
+
+/**
+ * One access log line per request:
+ *   {"msg":"request completed","method":"GET","path":"/projects",
+ *    "statusCode":200,"bytes":512,"durationMs":4,"ip":"203.0.113.7", ...}
+ * Logged through req.log, so reqId/route/orgId bindings are included, and
+ * traceId/spanId when traces are exported (see tracingPlugin).
+ * Paths in REQUEST_LOG_SKIP_PATHS (probes by default) are not logged.
+ * With REQUEST_LOG_SAMPLE_RATE=N only 1 in N non-error requests is logged;
+ * 4xx/5xx always are.
+ */
+export const requestLoggingPlugin: FastifyPluginAsync = fp(async (app) => {
+	app.addHook('onResponse', async (req, reply) => {
+		const path = req.url.split('?', 1)[0];
+		if (app.config.REQUEST_LOG_SKIP_PATHS.includes(path)) return;
+		if (
+			reply.statusCode < 400 &&
+			!inLogSample(String(req.id), app.config.REQUEST_LOG_SAMPLE_RATE)
+		) {
+			return;
+		}
+
+		// Streamed responses have no content-length; report 0 rather than guess
+		const bytes = Number(reply.getHeader('content-length')) || 0;
+
+		req.log.info(
+			{
+				method: req.method,
+				path,
+				statusCode: reply.statusCode,
+				bytes,
+				durationMs: Math.round(reply.elapsedTime),
+				ip: clientIp(req),
+			},
+			'request completed',
+		);
+	});
+});
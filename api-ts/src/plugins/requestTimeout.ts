@@ -0,0 +1,68 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import { sendProblem } from '../lib/problem';
+
+declare module 'fastify' {
+	interface FastifyRequest {
+		/**
+		 * Aborted when the request times out (REQUEST_TIMEOUT) or the client
+		 * disconnects. Pass it to anything cancellable (fetch, long loops).
+		 */
+		abortSignal: AbortSignal;
+		/**
+		 * When the request times out, on app.clock.monotonic()'s scale; null
+		 * without a deadline (exempt path, or REQUEST_TIMEOUT=0).
+		 */
+		deadline: number | null;
+	}
+}
+
+/**
+ * Per-request deadline. When it passes, the handler's abortSignal is aborted
+ * and the client gets 503 "request timeout" via the central error handler.
+ * Paths (raw path or route pattern) in REQUEST_TIMEOUT_EXEMPT_PATHS, e.g.
+ * streaming endpoints, never time out; REQUEST_TIMEOUT=0 disables it.
+ */
+export const requestTimeoutPlugin: FastifyPluginAsync = fp(async (app) => {
+	const timers = new WeakMap<object, NodeJS.Timeout>();
+	const controllers = new WeakMap<object, AbortController>();
+
+	app.addHook('onRequest', async (req, reply) => {
+		const controller = new AbortController();
+		controllers.set(req, controller);
+		req.abortSignal = controller.signal;
+		req.deadline = null;
+
+		const timeoutMs = app.config.REQUEST_TIMEOUT;
+		const exempt = app.config.REQUEST_TIMEOUT_EXEMPT_PATHS;
+		const path = req.url.split('?', 1)[0];
+		if (
+			timeoutMs === 0 ||
+			exempt.includes(path) ||
+			exempt.includes(req.routeOptions.url ?? '')
+		) {
+			return;
+		}
+
+		req.deadline = app.clock.monotonic() + timeoutMs;
+		const timer = setTimeout(() => {
+			controller.abort(new Error('request timeout'));
+			if (reply.sent) return;
+			req.log.warn({ timeoutMs }, 'request timed out');
+			sendProblem(reply, 503, 'request timeout');
+		}, timeoutMs);
+		timers.set(req, timer);
+	});
+
+	app.addHook('onResponse', async (req) => {
+		clearTimeout(timers.get(req));
+	});
+
+	// Cancels the handler's DB work too where it runs through
+	// cancellableQuery (analytics, search)
+	app.addHook('onRequestAbort', async (req) => {
+		clearTimeout(timers.get(req));
+		req.log.info('request aborted by client');
+		controllers.get(req)?.abort(new Error('client disconnected'));
+	});
+});
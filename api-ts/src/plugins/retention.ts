@@ -0,0 +1,88 @@
+import fp from 'fastify-plugin';
+import type { FastifyInstance, FastifyPluginAsync } from 'fastify';
+
+/**
+ * Delete finished runs outside each project's retention policy, batch by
+ * batch, along with their artifact blobs, and sweep expired Idempotency-Key
+ * claims and quarantine entries. Stops between batches once `signal` fires. Returns the counts.
+ */
+export async function pruneRuns(app: FastifyInstance, signal: AbortSignal) {
+	const batchSize = app.config.RETENTION_BATCH_SIZE;
+	const now = app.clock.now();
+	const projects = await app.repos.projects.listWithRetention();
+
+	let prunedRuns = 0;
+	for (const { id, policy } of projects) {
+		while (!signal.aborted) {
+			const runIds = await app.repos.runs.pruneCandidates(
+				id,
+				policy,
+				batchSize,
+				now,
+			);
+			if (runIds.length === 0) break;
+
+			const artifactKeys = await app.repos.runs.deleteMany(runIds);
+			await app.removeArtifactBlobs(artifactKeys);
+			prunedRuns += runIds.length;
+			if (runIds.length < batchSize) break;
+		}
+	}
+	// Expired claims and quarantine entries are already ignored; this only
+	// keeps the tables small
+	const expiredIdempotencyKeys =
+		await app.repos.runs.deleteExpiredIdempotencyKeys(now);
+	const { count: expiredQuarantines } =
+		await app.prisma.quarantinedTest.deleteMany({
+			where: { expiresAt: { lte: now } },
+		});
+	return {
+		prunedRuns,
+		projects: projects.length,
+		expiredIdempotencyKeys,
+		expiredQuarantines,
+	};
+}
+
+/**
+ * Every RETENTION_INTERVAL ("0" disables), prune runs per project retention
+ * policy (see pruneRuns). Passes never overlap; on close the current pass
+ * is told to stop and awaited so it doesn't outlive the DB pools.
+ */
+export const retentionPlugin: FastifyPluginAsync = fp(async (app) => {
+	const interval = app.config.RETENTION_INTERVAL;
+	if (interval === 0) {
+		app.log.info('run retention disabled (RETENTION_INTERVAL=0)');
+		return;
+	}
+
+	const abort = new AbortController();
+	let running: Promise<void> | null = null;
+
+	const pass = async () => {
+		const started = Date.now();
+		try {
+			const result = await pruneRuns(app, abort.signal);
+			app.log.info(
+				{ ...result, durationMs: Date.now() - started },
+				'retention pass finished',
+			);
+		} catch (err) {
+			app.log.error({ err }, 'retention pass failed');
+		}
+	};
+
+	const timer = setInterval(() => {
+		if (running) return;
+		running = pass().finally(() => {
+			running = null;
+		});
+	}, interval);
+	timer.unref();
+
+	app.addHook('onClose', async () => {
+		clearInterval(timer);
+		abort.abort();
+		await running;
+	});
+});
@@ -0,0 +1,36 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+
+const STATIC_HEADERS: Record<string, string> = {
+	'x-content-type-options': 'nosniff',
+	'x-frame-options': 'DENY',
+	'referrer-policy': 'no-referrer',
+};
+
+/**
+ * Hardening headers on every response. Runs in onSend, after the handler,
+ * and never overwrites a header the handler set on purpose. HSTS is only
+ * sent over HTTPS (req.protocol honours X-Forwarded-Proto with TRUST_PROXY).
+ */
+export const securityHeadersPlugin: FastifyPluginAsync = fp(async (app) => {
+	const { HSTS_ENABLED, HSTS_MAX_AGE, HSTS_INCLUDE_SUBDOMAINS } = app.config;
+	const hsts = `max-age=${HSTS_MAX_AGE}${
+		HSTS_INCLUDE_SUBDOMAINS ? '; includeSubDomains' : ''
+	}`;
+
+	app.addHook('onSend', async (req, reply, payload) => {
+		for (const [name, value] of Object.entries(STATIC_HEADERS)) {
+			if (!reply.hasHeader(name)) reply.header(name, value);
+		}
+
+		if (
+			HSTS_ENABLED &&
+			req.protocol === 'https' &&
+			!reply.hasHeader('strict-transport-security')
+		) {
+			reply.header('strict-transport-security', hsts);
+		}
+
+		return payload;
+	});
+});
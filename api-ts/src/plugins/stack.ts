@@ -0,0 +1,188 @@
+import type {
+	FastifyInstance,
+	FastifyPluginAsync,
+	FastifyPluginCallback,
+} from 'fastify';
+import sensible from '@fastify/sensible';
+import cookie from '@fastify/cookie';
+import fp from 'fastify-plugin';
+import { systemClock, type Clock } from '../lib/clock';
+import type { AppConfig } from '../lib/config';
+import { envPlugin } from './env';
+import { clockPlugin } from './clock';
+import { configReloadPlugin } from './configReload';
+import { readinessPlugin } from './readiness';
+import { notFoundPlugin } from './notFound';
+import { adminListenerPlugin } from './adminListener';
+import { securityHeadersPlugin } from './securityHeaders';
+import { bodyLoggingPlugin } from './bodyLogging';
+import { compressionPlugin } from './compression';
+import { openapiContractPlugin } from './openapiContract';
+import { corsPlugin } from './cors';
+import { rateLimitPlugin } from './rateLimit';
+import { maintenancePlugin } from './maintenance';
+import { prismaPlugin } from './prisma';
+import { repositoriesPlugin } from './repositories';
+import { jobsPlugin } from './jobs';
+import { webhooksPlugin } from './webhooks';
+import { artifactsPlugin } from './artifacts';
+import { retentionPlugin } from './retention';
+import { requestContextPlugin } from './requestContext';
+import { tracingPlugin } from './tracing';
+import { requestLoggingPlugin } from './requestLogging';
+import { requestTimeoutPlugin } from './requestTimeout';
+import { metricsPlugin } from './metrics';
+import { authPlugin } from './auth';
+
+/**
+ * Cookie plugin must run AFTER envPlugin
+ * because it needs app.config.AUTH_COOKIE_SECRET
+ */
+const authCookiePlugin = fp(async (app) => {
+	await app.register(cookie, {
+		secret: app.config.AUTH_COOKIE_SECRET,
+		parseOptions: {
+			httpOnly: true,
+		},
+	});
+});
+
+/**
+ * One plugin in the app-wide stack. Plugins are registered in list order,
+ * and so are their hooks: an earlier entry's onRequest runs first and its
+ * onResponse also runs first.
+ */
+export type Middleware = {
+	name: string;
+	plugin: FastifyPluginAsync<any> | FastifyPluginCallback<any>;
+	opts?: Record<string, unknown>;
+	/** Entries that must come earlier (decorators or hooks this one uses). */
+	after?: string[];
+};
+
+/**
+ * The stack buildApp registers when none is passed. Error recovery is the
+ * app error handler, which wraps every entry regardless of position.
+ */
+export function defaultMiddleware(
+	config: AppConfig,
+	clock: Clock = systemClock,
+): Middleware[] {
+	return [
+		// Core / cross-cutting
+		{ name: 'env', plugin: envPlugin, opts: { config } },
+		{ name: 'clock', plugin: clockPlugin, opts: { clock } },
+		// Per request: context (request ID) first so every later hook, and
+		// every early reply (429, maintenance 503), has it; the access log
+		// needs the trace IDs from tracing
+		{ name: 'requestContext', plugin: requestContextPlugin },
+		{
+			name: 'tracing',
+			plugin: tracingPlugin,
+			after: ['env', 'requestContext'],
+		},
+		{
+			name: 'requestLogging',
+			plugin: requestLoggingPlugin,
+			after: ['env', 'requestContext', 'tracing'],
+		},
+		{ name: 'configReload', plugin: configReloadPlugin, after: ['env'] },
+		{ name: 'sensible', plugin: sensible },
+		{ name: 'readiness', plugin: readinessPlugin },
+		{ name: 'notFound', plugin: notFoundPlugin },
+		// Keeps admin paths off the public port when split
+		{ name: 'adminListener', plugin: adminListenerPlugin, after: ['env'] },
+		{ name: 'securityHeaders', plugin: securityHeadersPlugin, after: ['env'] },
+		// Before compression, so response bodies are logged uncompressed
+		{ name: 'bodyLogging', plugin: bodyLoggingPlugin, after: ['env'] },
+		{ name: 'compression', plugin: compressionPlugin, after: ['env'] },
+
+		// OpenAPI contract + /docs + request validation
+		{
+			name: 'openapiContract',
+			plugin: openapiContractPlugin,
+			after: ['sensible'],
+		},
+
+		// Needs WEB_APP_URL
+		{ name: 'cors', plugin: corsPlugin, after: ['env'] },
+		// So 429s still carry CORS headers
+		{ name: 'rateLimit', plugin: rateLimitPlugin, after: ['cors'] },
+		// Likewise for maintenance-mode 503s
+		{
+			name: 'maintenance',
+			plugin: maintenancePlugin,
+			after: ['env', 'clock', 'cors'],
+		},
+
+		// Cookie parsing/signing for session auth
+		{ name: 'authCookie', plugin: authCookiePlugin, after: ['env'] },
+
+		// DB + background jobs
+		{ name: 'prisma', plugin: prismaPlugin, after: ['env', 'readiness'] },
+		{ name: 'repositories', plugin: repositoriesPlugin, after: ['prisma'] },
+		// After prisma so it is drained before the DB pools close
+		{ name: 'jobs', plugin: jobsPlugin, after: ['env', 'prisma'] },
+		{
+			name: 'webhooks',
+			plugin: webhooksPlugin,
+			after: ['env', 'prisma', 'jobs'],
+		},
+		{ name: 'artifacts', plugin: artifactsPlugin, after: ['env'] },
+		{
+			name: 'retention',
+			plugin: retentionPlugin,
+			after: ['clock', 'repositories', 'artifacts'],
+		},
+
+		{
+			name: 'requestTimeout',
+			plugin: requestTimeoutPlugin,
+			after: ['env', 'clock'],
+		},
+		{
+			name: 'metrics',
+			plugin: metricsPlugin,
+			after: ['env', 'prisma', 'jobs', 'maintenance'],
+		},
+		{
+			name: 'auth',
+			plugin: authPlugin,
+			after: ['authCookie', 'prisma', 'repositories', 'requestContext'],
+		},
+	];
+}
+
+/**
+ * Ordering problems in a stack: duplicate names and `after` entries that are
+ * missing or come later. Empty means the stack is valid.
+ */
+export function middlewareOrderIssues(stack: Middleware[]): string[] {
+	const issues: string[] = [];
+	const seen = new Set<string>();
+	const names = new Set(stack.map((entry) => entry.name));
+
+	for (const entry of stack) {
+		if (seen.has(entry.name)) issues.push(`${entry.name} is listed twice`);
+		for (const dep of entry.after ?? []) {
+			if (!names.has(dep)) {
+				issues.push(`${entry.name} needs ${dep}, which is not in the stack`);
+			} else if (!seen.has(dep)) {
+				issues.push(`${entry.name} must come after ${dep}`);
+			}
+		}
+		seen.add(entry.name);
+	}
+	return issues;
+}
+
+/** Register a stack in order; throws on ordering problems. */
+export function registerMiddleware(app: FastifyInstance, stack: Middleware[]) {
+	const issues = middlewareOrderIssues(stack);
+	if (issues.length) {
+		throw new Error(`Invalid middleware stack: ${issues.join('; ')}`);
+	}
+	for (const entry of stack) {
+		app.register(entry.plugin as FastifyPluginAsync<any>, entry.opts ?? {});
+	}
+}
@@ -0,0 +1,76 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import {
+	OtlpHttpExporter,
+	endSpan,
+	formatTraceparent,
+	noopExporter,
+	parseTraceparent,
+	startServerSpan,
+	type Span,
+	type SpanExporter,
+} from '../lib/tracing';
+import { addLogBindings } from './requestContext';
+
+declare module 'fastify' {
+	interface FastifyRequest {
+		span: Span;
+	}
+}
+
+/**
+ * One server span per request, continuing an incoming W3C `traceparent`.
+ * Spans go to OTEL_EXPORTER_OTLP_ENDPOINT (OTLP/HTTP JSON); without it the
+ * exporter is a no-op. With an exporter, every log line of the request
+ * (the access log line included) carries traceId/spanId so logs and traces
+ * join up; without one there is no trace to jump to, so they are left out.
+ * Registered after requestContextPlugin (uses addLogBindings) and before
+ * requestLoggingPlugin.
+ */
+export const tracingPlugin: FastifyPluginAsync = fp(async (app) => {
+	const endpoint = app.config.OTEL_EXPORTER_OTLP_ENDPOINT;
+	const exporter: SpanExporter = endpoint
+		? new OtlpHttpExporter({
+				endpoint,
+				serviceName: app.config.OTEL_SERVICE_NAME,
+				flushIntervalMs: 5000,
+				log: app.log,
+			})
+		: noopExporter;
+
+	if (endpoint) {
+		app.log.info({ endpoint }, 'exporting traces via OTLP');
+	}
+
+	app.addHook('onRequest', async (req, reply) => {
+		const route = req.routeOptions.url;
+		const span = startServerSpan(
+			route ? `${req.method} ${route}` : req.method,
+			parseTraceparent(req.headers.traceparent),
+		);
+		span.attributes['http.request.method'] = req.method;
+		if (route) span.attributes['http.route'] = route;
+		req.span = span;
+
+		if (endpoint) {
+			addLogBindings(req, reply, {
+				traceId: span.traceId,
+				spanId: span.spanId,
+			});
+		}
+		reply.header('traceparent', formatTraceparent(span));
+	});
+
+	app.addHook('onResponse', async (req, reply) => {
+		if (!req.span) return;
+		req.span.attributes['http.response.status_code'] = reply.statusCode;
+		req.span.error = reply.statusCode >= 500;
+		endSpan(req.span);
+		exporter.export(req.span);
+	});
+
+	// Flush queued spans before the process exits
+	app.addHook('onClose', async () => {
+		await exporter.shutdown();
+	});
+});
@@ -0,0 +1,98 @@
+import fp from 'fastify-plugin';
+import type { FastifyPluginAsync } from 'fastify';
+import {
+	InternalAddressError,
+	OutboundHttpClient,
+	proxySettings,
+} from '../lib/outboundHttp';
+import { deliverWebhook, type WebhookEvent } from '../lib/webhooks';
+
+declare module 'fastify' {
+	interface FastifyInstance {
+		/**
+		 * Deliver `event` to the project's matching subscriptions in the
+		 * background (a job on app.webhookJobs). Returns immediately;
+		 * failures, and events dropped because the delivery queue is full,
+		 * are logged, never thrown.
+		 */
+		dispatchWebhookEvent(
+			projectId: string,
+			event: WebhookEvent,
+			data: unknown,
+		): void;
+		/**
+		 * Reject (400) a webhook URL whose host is or resolves to a
+		 * loopback, link-local or private address outside
+		 * WEBHOOK_ALLOWED_NETWORKS.
+		 */
+		checkWebhookUrl(url: string): Promise<void>;
+	}
+}
+
+export const webhooksPlugin: FastifyPluginAsync = fp(async (app) => {
+	// One client (and connection pool) for every delivery
+	const http = new OutboundHttpClient({
+		timeoutMs: app.config.WEBHOOK_TIMEOUT,
+		proxy: proxySettings(app.config),
+		allowedNetworks: app.config.WEBHOOK_ALLOWED_NETWORKS,
+	});
+	const { override, httpProxy, httpsProxy, noProxy } = http.proxy;
+	if (override || httpProxy || httpsProxy) {
+		// Origins only: proxy URLs may carry credentials
+		const origin = (url?: string) => url && new URL(url).origin;
+		app.log.info(
+			{
+				proxy: origin(override),
+				httpProxy: origin(httpProxy),
+				httpsProxy: origin(httpsProxy),
+				noProxy,
+			},
+			'webhook deliveries go through an outbound proxy',
+		);
+	}
+
+	app.decorate('checkWebhookUrl', async (url: string) => {
+		try {
+			await http.checkTarget(url);
+		} catch (err) {
+			if (!(err instanceof InternalAddressError)) throw err;
+			throw app.httpErrors.badRequest(`url: ${err.message}`);
+		}
+	});
+
+	app.decorate(
+		'dispatchWebhookEvent',
+		(projectId: string, event: WebhookEvent, data: unknown) => {
+			const deliver = () =>
+				app.prisma.webhook
+					.findMany({
+						where: { projectId, events: { has: event } },
+						select: { id: true, url: true, secret: true },
+					})
+					.then((targets) =>
+						Promise.all(
+							targets.map((target) =>
+								deliverWebhook(target, event, data, {
+									attempts: app.config.WEBHOOK_MAX_ATTEMPTS,
+									http,
+									clock: app.clock,
+									log: app.log,
+								}),
+							),
+						),
+					)
+					.catch((err) => {
+						app.log.error(
+							{ err, projectId, event },
+							'webhook dispatch failed',
+						);
+					});
+			if (!app.webhookJobs.tryEnqueue('webhook', deliver)) {
+				app.log.warn(
+					{ projectId, event },
+					'webhook dropped: delivery queue is full',
+				);
+			}
+		},
+	);
+});
@@ -0,0 +1,713 @@
+import type { Prisma, PrismaClient } from '@prisma/client';
+import type { ComparableResult } from '../lib/compareRuns';
+import { looksLikeId } from '../lib/idOrSlug';
+import type { ExportedResult } from '../lib/junitExport';
+import type { RunEnvironment } from '../lib/runEnvironment';
+import { labelMap } from '../lib/runLabels';
+import {
+	UniqueConstraintError,
+	type CreatedRun,
+	type NewProject,
+	type NewRun,
+	type ProjectChanges,
+	type ProjectRef,
+	type ProjectRepository,
+	type QuarantinedFailure,
+	type Repositories,
+	type RetentionPolicy,
+	type RunFeedFilter,
+	type RunFilter,
+	type RunRepository,
+	type RunResultItem,
+	type RunStatus,
+} from './types';
+
+type Db = PrismaClient | Prisma.TransactionClient;
+
+const projectSelect = {
+	id: true,
+	name: true,
+	slug: true,
+	createdAt: true,
+	updatedAt: true,
+	retentionMaxRuns: true,
+	retentionDays: true,
+	defaultBranch: true,
+} as const;
+
+const projectRefSelect = {
+	id: true,
+	slug: true,
+	name: true,
+	orgId: true,
+} as const;
+
+const runListSelect = {
+	id: true,
+	createdAt: true,
+	status: true,
+	source: true,
+	commitSha: true,
+	branch: true,
+	ciBuildUrl: true,
+	startedAt: true,
+	finishedAt: true,
+	durationMs: true,
+	totalCount: true,
+	passedCount: true,
+	failedCount: true,
+	skippedCount: true,
+	errorCount: true,
+	quarantinedCount: true,
+	labels: { select: { key: true, value: true }, orderBy: { key: 'asc' } },
+	environment: true,
+} as const;
+
+/** A row selected with runListSelect, as the API shapes it. */
+function listItem<
+	T extends {
+		labels: { key: string; value: string }[];
+		environment: Prisma.JsonValue;
+	},
+>(run: T) {
+	return {
+		...run,
+		labels: labelMap(run.labels),
+		// Only ever written from a validated RunEnvironment
+		environment: run.environment as RunEnvironment | null,
+	};
+}
+
+/** Prisma unique constraint violation (P2002). */
+function isUniqueViolation(err: unknown) {
+	return (
+		!!err &&
+		typeof err === 'object' &&
+		'code' in err &&
+		(err as { code?: string }).code === 'P2002'
+	);
+}
+
+async function mapUniqueViolation<T>(work: Promise<T>, message: string) {
+	try {
+		return await work;
+	} catch (err) {
+		if (isUniqueViolation(err)) throw new UniqueConstraintError(message);
+		throw err;
+	}
+}
+
+/** Run `fn` in a transaction unless `db` already is one. */
+function inTx<T>(db: Db, fn: (tx: Prisma.TransactionClient) => Promise<T>) {
+	return '$transaction' in db ? db.$transaction(fn) : fn(db);
+}
+
+function artifactKeys(db: Db, where: Prisma.ArtifactWhereInput) {
+	return db.artifact
+		.findMany({ where, select: { storageKey: true } })
+		.then((rows) => rows.map((row) => row.storageKey));
+}
+
+const SLUG_TAKEN = 'project slug is already in use in this organization';
+
+class PrismaProjectRepository implements ProjectRepository {
+	private readonly db: Db;
+
+	constructor(db: Db) {
+		this.db = db;
+	}
+
+	listForOrg(orgId: string) {
+		return this.db.project.findMany({
+			where: { orgId },
+			orderBy: { createdAt: 'desc' },
+			select: projectSelect,
+		});
+	}
+
+	get(id: string) {
+		return this.db.project.findUnique({ where: { id }, select: projectSelect });
+	}
+
+	async resolve(orgId: string, idOrSlug: string) {
+		// Id-shaped values are tried as ids first, then as slugs
+		if (looksLikeId(idOrSlug)) {
+			const byId = await this.db.project.findFirst({
+				where: { id: idOrSlug, orgId },
+				select: projectRefSelect,
+			});
+			if (byId) return { project: byId, viaAlias: false };
+		}
+
+		const bySlug = await this.db.project.findFirst({
+			where: { slug: idOrSlug, orgId },
+			select: projectRefSelect,
+		});
+		if (bySlug) return { project: bySlug, viaAlias: false };
+
+		const alias = await this.db.projectSlugAlias.findFirst({
+			where: { slug: idOrSlug, project: { orgId } },
+			select: { project: { select: projectRefSelect } },
+		});
+		return alias ? { project: alias.project, viaAlias: true } : null;
+	}
+
+	async resolvePublic(idOrSlug: string) {
+		const select = {
+			id: true,
+			defaultBranch: true,
+			updatedAt: true,
+		} as const;
+		if (looksLikeId(idOrSlug)) {
+			const byId = await this.db.project.findUnique({
+				where: { id: idOrSlug },
+				select,
+			});
+			if (byId) return byId;
+		}
+
+		// Slugs are only unique per org: two matches means no answer
+		const bySlug = await this.db.project.findMany({
+			where: { slug: idOrSlug },
+			take: 2,
+			select,
+		});
+		return bySlug.length === 1 ? bySlug[0] : null;
+	}
+
+	create(input: NewProject) {
+		return mapUniqueViolation(
+			this.db.project.create({ data: input, select: projectSelect }),
+			SLUG_TAKEN,
+		);
+	}
+
+	update(project: ProjectRef, changes: ProjectChanges) {
+		const nextSlug =
+			changes.slug && changes.slug !== project.slug ? changes.slug : undefined;
+
+		const work = inTx(this.db, async (tx) => {
+			if (nextSlug) {
+				const holder = await tx.project.findFirst({
+					where: { slug: nextSlug, orgId: project.orgId },
+					select: { id: true },
+				});
+				if (holder && holder.id !== project.id) {
+					throw new UniqueConstraintError(SLUG_TAKEN);
+				}
+
+				// Aliases are globally unique; taking back an own old slug
+				// drops its alias
+				const alias = await tx.projectSlugAlias.findUnique({
+					where: { slug: nextSlug },
+					select: { projectId: true },
+				});
+				if (alias && alias.projectId !== project.id) {
+					throw new UniqueConstraintError(SLUG_TAKEN);
+				}
+				if (alias) {
+					await tx.projectSlugAlias.delete({ where: { slug: nextSlug } });
+				}
+
+				await tx.projectSlugAlias.createMany({
+					data: [{ projectId: project.id, slug: project.slug }],
+					skipDuplicates: true,
+				});
+			}
+
+			return tx.project.update({
+				where: { id: project.id },
+				data: {
+					...(changes.name ? { name: changes.name } : {}),
+					...(nextSlug ? { slug: nextSlug } : {}),
+					retentionMaxRuns: changes.retentionMaxRuns,
+					retentionDays: changes.retentionDays,
+					defaultBranch: changes.defaultBranch,
+				},
+				select: projectSelect,
+			});
+		});
+		return mapUniqueViolation(work, SLUG_TAKEN);
+	}
+
+	async listWithRetention() {
+		const rows = await this.db.project.findMany({
+			where: {
+				OR: [
+					{ retentionMaxRuns: { not: null } },
+					{ retentionDays: { not: null } },
+				],
+			},
+			select: { id: true, retentionMaxRuns: true, retentionDays: true },
+		});
+		return rows.map((row) => ({
+			id: row.id,
+			policy: { maxRuns: row.retentionMaxRuns, days: row.retentionDays },
+		}));
+	}
+
+	countRuns(projectId: string) {
+		return this.db.testRun.count({ where: { projectId } });
+	}
+
+	async delete(projectId: string) {
+		const keys = await artifactKeys(this.db, { run: { projectId } });
+		// Cascades to runs, test cases, results and artifact rows
+		await this.db.project.delete({ where: { id: projectId } });
+		return keys;
+	}
+}
+
+class PrismaRunRepository implements RunRepository {
+	private readonly db: Db;
+	// Listings only: may lag the primary, so never read back a fresh write
+	private readonly reads: Db;
+
+	constructor(db: Db, reads: Db = db) {
+		this.db = db;
+		this.reads = reads;
+	}
+
+	async list(projectId: string, filter: RunFilter) {
+		// Keyset pagination on (createdAt, id): rows inserted while paging
+		// never shift or repeat later pages
+		const past = <T>(value: T) =>
+			filter.order === 'desc' ? { lt: value } : { gt: value };
+		const labels = filter.labels ?? [];
+		const environment = filter.environment ?? [];
+		const matches: Prisma.TestRunWhereInput[] = [
+			...labels.map((label) => ({ labels: { some: label } })),
+			...environment.map(({ key, value }) => ({
+				environment: { path: [key], equals: value },
+			})),
+		];
+
+		const where: Prisma.TestRunWhereInput = {
+			projectId,
+			...(filter.status ? { status: filter.status } : {}),
+			...(filter.branch ? { branch: filter.branch } : {}),
+			...(filter.commit ? { commitSha: { startsWith: filter.commit } } : {}),
+			...(matches.length ? { AND: matches } : {}),
+			...(filter.after
+				? {
+						OR: [
+							{ createdAt: past(filter.after.createdAt) },
+							{
+								createdAt: filter.after.createdAt,
+								id: past(filter.after.id),
+							},
+						],
+					}
+				: {}),
+		};
+
+		// One extra row tells whether another page exists
+		const rows = await this.reads.testRun.findMany({
+			where,
+			orderBy: [{ createdAt: filter.order }, { id: filter.order }],
+			take: filter.limit + 1,
+			select: runListSelect,
+		});
+
+		return {
+			items: rows
+				.slice(0, filter.limit)
+				.map(listItem),
+			hasMore: rows.length > filter.limit,
+		};
+	}
+
+	async feed(orgId: string, filter: RunFeedFilter) {
+		const rows = await this.reads.testRun.findMany({
+			where: {
+				project: { orgId },
+				...(filter.status ? { status: filter.status } : {}),
+				...(filter.after
+					? {
+							OR: [
+								{ createdAt: { lt: filter.after.createdAt } },
+								{
+									createdAt: filter.after.createdAt,
+									id: { lt: filter.after.id },
+								},
+							],
+						}
+					: {}),
+			},
+			orderBy: [{ createdAt: 'desc' }, { id: 'desc' }],
+			take: filter.limit + 1,
+			select: {
+				...runListSelect,
+				project: { select: { id: true, slug: true, name: true } },
+			},
+		});
+
+		return {
+			items: rows
+				.slice(0, filter.limit)
+				.map(listItem),
+			hasMore: rows.length > filter.limit,
+		};
+	}
+
+	async get(projectId: string, runId: string) {
+		const run = await this.db.testRun.findFirst({
+			where: { id: runId, projectId },
+			select: { ...runListSelect, projectId: true, warnings: true },
+		});
+		if (!run) return null;
+
+		const quarantined = run.quarantinedCount
+			? await this.db.testResult.findMany({
+					where: { runId, quarantined: true },
+					orderBy: [{ createdAt: 'asc' }, { id: 'asc' }],
+					select: {
+						status: true,
+						testCase: { select: { id: true, name: true, suiteName: true } },
+					},
+				})
+			: [];
+		return {
+			...listItem(run),
+			quarantinedFailures: quarantined.map(({ status, testCase }) => ({
+				testCaseId: testCase.id,
+				name: testCase.name,
+				suiteName: testCase.suiteName,
+				status: status as QuarantinedFailure['status'],
+			})),
+		};
+	}
+
+	async previousOnBranch(
+		projectId: string,
+		run: { id: string; createdAt: Date; branch: string },
+	) {
+		const previous = await this.findPreviousOnBranch(projectId, run);
+		return previous?.id ?? null;
+	}
+
+	async previousFinishedOnBranch(projectId: string, runId: string) {
+		const run = await this.db.testRun.findFirst({
+			where: { id: runId, projectId },
+			select: { id: true, createdAt: true, branch: true },
+		});
+		if (!run?.branch) return null;
+		return this.findPreviousOnBranch(projectId, {
+			id: run.id,
+			createdAt: run.createdAt,
+			branch: run.branch,
+		});
+	}
+
+	private findPreviousOnBranch(
+		projectId: string,
+		run: { id: string; createdAt: Date; branch: string },
+	) {
+		// Same (createdAt, id) order as list()
+		return this.db.testRun.findFirst({
+			where: {
+				projectId,
+				branch: run.branch,
+				status: { in: ['COMPLETED', 'FAILED'] },
+				OR: [
+					{ createdAt: { lt: run.createdAt } },
+					{ createdAt: run.createdAt, id: { lt: run.id } },
+				],
+			},
+			orderBy: [{ createdAt: 'desc' }, { id: 'desc' }],
+			select: { id: true, status: true },
+		});
+	}
+
+	async latestFinished(projectId: string, branch?: string) {
+		const run = await this.reads.testRun.findFirst({
+			where: {
+				projectId,
+				...(branch ? { branch } : {}),
+				status: { in: ['COMPLETED', 'FAILED'] },
+			},
+			orderBy: [{ createdAt: 'desc' }, { id: 'desc' }],
+			select: { status: true, finishedAt: true, createdAt: true },
+		});
+		if (!run) return null;
+		return {
+			status: run.status,
+			finishedAt: run.finishedAt ?? run.createdAt,
+		};
+	}
+
+	async projectIdOf(orgId: string, runId: string) {
+		const run = await this.db.testRun.findFirst({
+			where: { id: runId, project: { orgId } },
+			select: { projectId: true },
+		});
+		return run?.projectId ?? null;
+	}
+
+	create(input: NewRun): Promise<CreatedRun> {
+		const { labels, env, environment, meta, ...fields } = input;
+		return this.db.testRun.create({
+			data: {
+				...fields,
+				env: env as Prisma.InputJsonValue | undefined,
+				environment: environment as Prisma.InputJsonValue | undefined,
+				meta: meta as Prisma.InputJsonValue | undefined,
+				labels: {
+					create: Object.entries(labels ?? {}).map(([key, value]) => ({
+						key,
+						value,
+					})),
+				},
+			},
+			select: { id: true, createdAt: true, status: true, projectId: true },
+		});
+	}
+
+	async lockStatus(runId: string) {
+		const rows = await this.db.$queryRaw<{ status: RunStatus }[]>`
+			SELECT status FROM "TestRun" WHERE id = ${runId} FOR UPDATE
+		`;
+		return rows[0]?.status ?? null;
+	}
+
+	async start(runId: string, startedAt: Date) {
+		await this.db.testRun.updateMany({
+			where: { id: runId, status: 'QUEUED' },
+			data: { status: 'RUNNING', startedAt },
+		});
+	}
+
+	async failQueued(runId: string, warning: string, finishedAt: Date) {
+		await this.db.testRun.updateMany({
+			where: { id: runId, status: 'QUEUED' },
+			data: { status: 'FAILED', finishedAt, warnings: { push: warning } },
+		});
+	}
+
+	async recount(runId: string) {
+		const groups = await this.db.testResult.groupBy({
+			by: ['status'],
+			where: { runId },
+			_count: { _all: true },
+		});
+		const count = (status: string) =>
+			groups.find((g) => g.status === status)?._count._all ?? 0;
+		const counts = {
+			passedCount: count('PASSED'),
+			failedCount: count('FAILED'),
+			skippedCount: count('SKIPPED'),
+			errorCount: count('ERROR'),
+		};
+		const totalCount =
+			counts.passedCount +
+			counts.failedCount +
+			counts.skippedCount +
+			counts.errorCount;
+
+		await this.db.testRun.update({
+			where: { id: runId },
+			data: { ...counts, totalCount },
+		});
+		return { totalCount, ...counts };
+	}
+
+	async markQuarantined(projectId: string, runId: string, at: Date) {
+		const active = await this.db.quarantinedTest.findMany({
+			where: {
+				projectId,
+				OR: [{ expiresAt: null }, { expiresAt: { gt: at } }],
+			},
+			select: { name: true },
+		});
+		const { count } = active.length
+			? await this.db.testResult.updateMany({
+					where: {
+						runId,
+						status: { in: ['FAILED', 'ERROR'] },
+						testCase: { name: { in: active.map((q) => q.name) } },
+					},
+					data: { quarantined: true },
+				})
+			: { count: 0 };
+		await this.db.testRun.update({
+			where: { id: runId },
+			data: { quarantinedCount: count },
+		});
+		return count;
+	}
+
+	async finish(
+		runId: string,
+		outcome: { status: RunStatus; finishedAt: Date; durationMs?: number },
+	) {
+		await this.db.testRun.update({ where: { id: runId }, data: outcome });
+	}
+
+	results(runId: string): Promise<RunResultItem[]> {
+		return this.db.testResult.findMany({
+			where: { runId },
+			orderBy: { createdAt: 'asc' },
+			select: {
+				id: true,
+				status: true,
+				durationMs: true,
+				message: true,
+				stdout: true,
+				stderr: true,
+				outputTruncated: true,
+				createdAt: true,
+				testCase: {
+					select: {
+						id: true,
+						externalId: true,
+						name: true,
+						suiteName: true,
+						tags: true,
+					},
+				},
+			},
+		});
+	}
+
+	exportResults(runId: string): Promise<ExportedResult[]> {
+		return this.db.testResult.findMany({
+			where: { runId },
+			orderBy: [{ createdAt: 'asc' }, { id: 'asc' }],
+			select: {
+				status: true,
+				durationMs: true,
+				message: true,
+				stacktrace: true,
+				stdout: true,
+				stderr: true,
+				testCase: {
+					select: {
+						externalId: true,
+						name: true,
+						filePath: true,
+						suiteName: true,
+					},
+				},
+			},
+		});
+	}
+
+	comparableResults(runId: string): Promise<ComparableResult[]> {
+		return this.db.testResult.findMany({
+			where: { runId },
+			select: {
+				status: true,
+				durationMs: true,
+				message: true,
+				testCase: {
+					select: { id: true, externalId: true, name: true, suiteName: true },
+				},
+			},
+		});
+	}
+
+	async delete(runId: string) {
+		const keys = await artifactKeys(this.db, { runId });
+		// Cascades to results and artifact rows
+		await this.db.testRun.delete({ where: { id: runId } });
+		return keys;
+	}
+
+	async pruneCandidates(
+		projectId: string,
+		policy: RetentionPolicy,
+		limit: number,
+		now: Date,
+	) {
+		const cutoff =
+			policy.days == null
+				? null
+				: new Date(now.getTime() - policy.days * 24 * 60 * 60 * 1000);
+
+		// Rank over all runs so open runs still count towards maxRuns
+		const rows = await this.db.$queryRaw<{ id: string }[]>`
+			SELECT id FROM (
+				SELECT id, status, "createdAt",
+					row_number() OVER (ORDER BY "createdAt" DESC, id DESC) AS rank
+				FROM "TestRun"
+				WHERE "projectId" = ${projectId}
+			) ranked
+			WHERE status NOT IN ('QUEUED', 'RUNNING')
+			  AND (
+				(${policy.maxRuns}::int IS NOT NULL AND rank > ${policy.maxRuns}::int)
+				OR (${cutoff}::timestamp IS NOT NULL AND "createdAt" < ${cutoff}::timestamp)
+			  )
+			ORDER BY "createdAt" ASC, id ASC
+			LIMIT ${limit}
+		`;
+		return rows.map((row) => row.id);
+	}
+
+	async deleteMany(runIds: string[]) {
+		if (runIds.length === 0) return [];
+		const keys = await artifactKeys(this.db, { runId: { in: runIds } });
+		await this.db.testRun.deleteMany({ where: { id: { in: runIds } } });
+		return keys;
+	}
+
+	async findByIdempotencyKey(projectId: string, key: string, now: Date) {
+		const claim = await this.db.runIdempotencyKey.findFirst({
+			where: { projectId, key, expiresAt: { gt: now } },
+			select: { runId: true },
+		});
+		return claim?.runId ?? null;
+	}
+
+	async claimIdempotencyKey(
+		claim: {
+			projectId: string;
+			key: string;
+			runId: string;
+			expiresAt: Date;
+		},
+		now: Date,
+	) {
+		const { projectId, key } = claim;
+		await this.db.runIdempotencyKey.deleteMany({
+			where: { projectId, key, expiresAt: { lte: now } },
+		});
+		await mapUniqueViolation(
+			this.db.runIdempotencyKey.create({ data: claim }),
+			'Idempotency-Key is already in use',
+		);
+	}
+
+	async deleteExpiredIdempotencyKeys(now: Date) {
+		const { count } = await this.db.runIdempotencyKey.deleteMany({
+			where: { expiresAt: { lte: now } },
+		});
+		return count;
+	}
+}
+
+/** `replica` serves run listings; it defaults to (and in a tx is) `db`. */
+export function createPrismaRepositories(
+	db: Db,
+	replica: Db = db,
+): Repositories {
+	return {
+		projects: new PrismaProjectRepository(db),
+		runs: new PrismaRunRepository(db, replica),
+	};
+}
+
+/**
+ * Run `fn` in one database transaction with repositories bound to it. The
+ * transaction commits when `fn` resolves and rolls back if it throws (the
+ * error is rethrown). `tx` is for queries that have no repository yet.
+ */
+export function withTx<T>(
+	prisma: PrismaClient,
+	fn: (repos: Repositories, tx: Prisma.TransactionClient) => Promise<T>,
+	opts: { timeoutMs?: number } = {},
+): Promise<T> {
+	return prisma.$transaction(
+		(tx: Prisma.TransactionClient) => fn(createPrismaRepositories(tx), tx),
+		opts.timeoutMs ? { timeout: opts.timeoutMs } : undefined,
+	);
+}
@@ -0,0 +1,352 @@
+import type { ComparableResult } from '../lib/compareRuns';
+import type { Cursor } from '../lib/cursor';
+import type { ExportedResult } from '../lib/junitExport';
+import type {
+	EnvironmentKey,
+	RunEnvironment,
+} from '../lib/runEnvironment';
+import type { RunLabels } from '../lib/runLabels';
+
+/**
+ * Storage interfaces the HTTP layer depends on. The Prisma implementation
+ * lives in ./prisma; handlers get one through `app.repos` (or a
+ * transaction-scoped set through `app.withTx`), so a fake can stand in for
+ * Postgres in tests.
+ */
+
+export type Project = {
+	id: string;
+	name: string;
+	slug: string;
+	createdAt: Date;
+	updatedAt: Date;
+	retentionMaxRuns: number | null;
+	retentionDays: number | null;
+	defaultBranch: string | null;
+};
+
+/**
+ * Keep the newest `maxRuns` runs and/or runs from the last `days` days; a
+ * run outside either limit is pruned. Null means no limit.
+ */
+export type RetentionPolicy = {
+	maxRuns: number | null;
+	days: number | null;
+};
+
+/** Enough of a project to authorize and scope a request. */
+export type ProjectRef = {
+	id: string;
+	slug: string;
+	name: string;
+	orgId: string;
+};
+
+export type RunStatus =
+	| 'QUEUED'
+	| 'RUNNING'
+	| 'COMPLETED'
+	| 'FAILED'
+	| 'CANCELED';
+
+/** Results can still be appended and the run completed. */
+export function isOpenRun(status: RunStatus) {
+	return status === 'QUEUED' || status === 'RUNNING';
+}
+
+/**
+ * Status of a run that finished with `failures` failed/errored results,
+ * `quarantined` of them from quarantined tests (those don't fail it).
+ */
+export function finishedStatus(
+	failures: number,
+	quarantined: number,
+): 'COMPLETED' | 'FAILED' {
+	return failures - quarantined > 0 ? 'FAILED' : 'COMPLETED';
+}
+
+export type RunCounts = {
+	totalCount: number;
+	passedCount: number;
+	failedCount: number;
+	skippedCount: number;
+	errorCount: number;
+};
+
+export type RunListItem = RunCounts & {
+	id: string;
+	createdAt: Date;
+	status: RunStatus;
+	source: string | null;
+	commitSha: string | null;
+	branch: string | null;
+	ciBuildUrl: string | null;
+	startedAt: Date | null;
+	finishedAt: Date | null;
+	durationMs: number | null;
+	/** Failures/errors not counted against the status (quarantined tests). */
+	quarantinedCount: number;
+	labels: RunLabels;
+	environment: RunEnvironment | null;
+};
+
+/** A failed/errored result of a quarantined test. */
+export type QuarantinedFailure = {
+	testCaseId: string;
+	name: string;
+	suiteName: string | null;
+	status: 'FAILED' | 'ERROR';
+};
+
+export type RunDetails = RunListItem & {
+	projectId: string;
+	// Non-fatal problems found while ingesting a report
+	warnings: string[];
+	quarantinedFailures: QuarantinedFailure[];
+};
+
+/** A stored result and its test case, as GET .../results lists it. */
+export type RunResultItem = {
+	id: string;
+	status: ExportedResult['status'];
+	durationMs: number | null;
+	message: string | null;
+	stdout: string | null;
+	stderr: string | null;
+	outputTruncated: boolean;
+	createdAt: Date;
+	testCase: {
+		id: string;
+		externalId: string;
+		name: string;
+		suiteName: string | null;
+		tags: string[];
+	};
+};
+
+export type RunFilter = {
+	status?: RunStatus;
+	branch?: string;
+	/** Commit SHA prefix (lowercase). */
+	commit?: string;
+	/** Every label must match. */
+	labels?: { key: string; value: string }[];
+	/** Every environment field must match. */
+	environment?: { key: EnvironmentKey; value: string }[];
+	/** Keyset position: rows strictly after this (createdAt, id). */
+	after?: Cursor;
+	order: 'asc' | 'desc';
+	limit: number;
+};
+
+/** A run in the cross-project feed, with the project it belongs to. */
+export type FeedRun = RunListItem & {
+	project: { id: string; slug: string; name: string };
+};
+
+export type RunFeedFilter = {
+	status?: RunStatus;
+	/** Keyset position: rows strictly older than this (createdAt, id). */
+	after?: Cursor;
+	limit: number;
+};
+
+export type NewRun = {
+	projectId: string;
+	status: RunStatus;
+	source: string;
+	commitSha?: string;
+	branch?: string;
+	ciBuildUrl?: string;
+	env?: Record<string, unknown>;
+	environment?: RunEnvironment;
+	meta?: Record<string, unknown>;
+	startedAt?: Date;
+	warnings?: string[];
+	labels?: RunLabels;
+};
+
+export type CreatedRun = {
+	id: string;
+	createdAt: Date;
+	status: RunStatus;
+	projectId: string;
+};
+
+export type NewProject = {
+	orgId: string;
+	name: string;
+	slug: string;
+	retentionMaxRuns?: number | null;
+	retentionDays?: number | null;
+	defaultBranch?: string | null;
+};
+
+/**
+ * Omitted fields are left alone; a null retention limit or default branch
+ * clears it.
+ */
+export type ProjectChanges = {
+	name?: string;
+	slug?: string;
+	retentionMaxRuns?: number | null;
+	retentionDays?: number | null;
+	defaultBranch?: string | null;
+};
+
+/** A write hit a unique constraint (e.g. a project slug already taken). */
+export class UniqueConstraintError extends Error {
+	constructor(message = 'unique constraint violated') {
+		super(message);
+		this.name = 'UniqueConstraintError';
+	}
+}
+
+export interface ProjectRepository {
+	listForOrg(orgId: string): Promise<Project[]>;
+	get(id: string): Promise<Project | null>;
+	/** By id, current slug, or a previous slug (viaAlias) within the org. */
+	resolve(
+		orgId: string,
+		idOrSlug: string,
+	): Promise<{ project: ProjectRef; viaAlias: boolean } | null>;
+	/**
+	 * Without an org (the public status badge): by id, or by a slug only
+	 * one project (in any org) has. Null when missing or ambiguous.
+	 */
+	resolvePublic(idOrSlug: string): Promise<{
+		id: string;
+		defaultBranch: string | null;
+		updatedAt: Date;
+	} | null>;
+	/** Throws UniqueConstraintError when the slug is taken in the org. */
+	create(input: NewProject): Promise<Project>;
+	/**
+	 * Rename, re-slug and/or change the retention policy. The old slug keeps
+	 * resolving as an alias. Throws UniqueConstraintError when the new slug
+	 * is taken.
+	 */
+	update(project: ProjectRef, changes: ProjectChanges): Promise<Project>;
+	/** Projects with at least one retention limit set. */
+	listWithRetention(): Promise<{ id: string; policy: RetentionPolicy }[]>;
+	countRuns(projectId: string): Promise<number>;
+	/** Deletes runs, cases and results too; returns artifact storage keys. */
+	delete(projectId: string): Promise<string[]>;
+}
+
+export interface RunRepository {
+	/** `hasMore` reports whether rows exist past `filter.limit`. */
+	list(
+		projectId: string,
+		filter: RunFilter,
+	): Promise<{ items: RunListItem[]; hasMore: boolean }>;
+	/**
+	 * Runs of every project in the org, newest first: the cross-project
+	 * feed. Read from the replica; `hasMore` as for list().
+	 */
+	feed(
+		orgId: string,
+		filter: RunFeedFilter,
+	): Promise<{ items: FeedRun[]; hasMore: boolean }>;
+	get(projectId: string, runId: string): Promise<RunDetails | null>;
+	/**
+	 * Id of the newest finished run on `run.branch` created before `run`
+	 * (null if none): what a run is compared against by default.
+	 */
+	previousOnBranch(
+		projectId: string,
+		run: { id: string; createdAt: Date; branch: string },
+	): Promise<string | null>;
+	/**
+	 * Id and status of the run previousOnBranch would return for the run
+	 * `runId` (null if none, or if that run has no branch). Read from the
+	 * primary: it is asked right after `runId` finished.
+	 */
+	previousFinishedOnBranch(
+		projectId: string,
+		runId: string,
+	): Promise<{ id: string; status: RunStatus } | null>;
+	/**
+	 * Status and finish time (creation time if unset) of the newest finished
+	 * (COMPLETED/FAILED) run, on `branch` when given; null when there is
+	 * none. Read from the replica.
+	 */
+	latestFinished(
+		projectId: string,
+		branch?: string,
+	): Promise<{ status: RunStatus; finishedAt: Date } | null>;
+	/** Project of a run anywhere in the org (null if not in the org). */
+	projectIdOf(orgId: string, runId: string): Promise<string | null>;
+	create(input: NewRun): Promise<CreatedRun>;
+	/**
+	 * Row-lock the run until the transaction ends and return its current
+	 * status (null if gone). Only meaningful inside withTx.
+	 */
+	lockStatus(runId: string): Promise<RunStatus | null>;
+	/** QUEUED -> RUNNING (no-op in any other status). */
+	start(runId: string, startedAt: Date): Promise<void>;
+	/**
+	 * QUEUED -> FAILED with `warning` added (no-op in any other status):
+	 * for a queued report that could not be stored.
+	 */
+	failQueued(runId: string, warning: string, finishedAt: Date): Promise<void>;
+	/** Recompute the run's counters from its stored results. */
+	recount(runId: string): Promise<RunCounts>;
+	/**
+	 * Flag the run's failed/errored results of tests quarantined at `at`
+	 * and store their number as quarantinedCount; returns it. Call once,
+	 * right before finish().
+	 */
+	markQuarantined(projectId: string, runId: string, at: Date): Promise<number>;
+	finish(
+		runId: string,
+		outcome: { status: RunStatus; finishedAt: Date; durationMs?: number },
+	): Promise<void>;
+	/** The run's results in ingest order. */
+	results(runId: string): Promise<RunResultItem[]>;
+	/** The run's results with what a JUnit XML export needs. */
+	exportResults(runId: string): Promise<ExportedResult[]>;
+	/** The run's results with what compareRuns needs (any order). */
+	comparableResults(runId: string): Promise<ComparableResult[]>;
+	/** Deletes the run's results too; returns artifact storage keys. */
+	delete(runId: string): Promise<string[]>;
+	/**
+	 * Up to `limit` finished runs of the project that fall outside `policy`
+	 * as of `now`, oldest first. Open runs are never candidates.
+	 */
+	pruneCandidates(
+		projectId: string,
+		policy: RetentionPolicy,
+		limit: number,
+		now: Date,
+	): Promise<string[]>;
+	/** delete() for many runs at once; returns artifact storage keys. */
+	deleteMany(runIds: string[]): Promise<string[]>;
+	/** Run created under an Idempotency-Key that hasn't expired by `now`. */
+	findByIdempotencyKey(
+		projectId: string,
+		key: string,
+		now: Date,
+	): Promise<string | null>;
+	/**
+	 * Record that `key` created `runId` (replacing a claim expired by `now`).
+	 * Throws UniqueConstraintError when the key is already claimed,
+	 * including by a concurrent transaction that commits first.
+	 */
+	claimIdempotencyKey(
+		claim: {
+			projectId: string;
+			key: string;
+			runId: string;
+			expiresAt: Date;
+		},
+		now: Date,
+	): Promise<void>;
+	/** Drop claims expired by `now`; returns how many. */
+	deleteExpiredIdempotencyKeys(now: Date): Promise<number>;
+}
+
+export type Repositories = {
+	projects: ProjectRepository;
+	runs: RunRepository;
+};
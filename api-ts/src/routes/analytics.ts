@@ -1,5 +1,8 @@
-import type { FastifyPluginAsync } from 'fastify';
+import type { FastifyPluginAsync, FastifyRequest } from 'fastify';
+import type { Prisma } from '@prisma/client';
 import { z } from 'zod';
+import { cancellableQuery } from '../lib/queryCancel';
+import { ENVIRONMENT_KEYS } from '../lib/runEnvironment';
 import { requireAuth, getAuth } from '../lib/requireAuth';
 import { requireProjectForOrg } from '../lib/requireProjectForOrg';
 
@@ -15,8 +18,41 @@ const DaysLimitQuery = DaysQuery.extend({
 	limit: z.coerce.number().int().min(1).max(100).default(20),
 });
 
-function cutoffDate(days: number) {
-	return new Date(Date.now() - days * 24 * 60 * 60 * 1000);
+const FlakyQuery = z.object({
+	days: z.coerce.number().int().min(1).max(90).default(14),
+	minRuns: z.coerce.number().int().min(2).max(1000).default(5),
+	limit: z.coerce.number().int().min(1).max(100).default(20),
+	// Break each test's results down by this run environment field
+	groupBy: z.enum(ENVIRONMENT_KEYS).optional(),
+});
+
+const SlowQuery = z.object({
+	days: z.coerce.number().int().min(1).max(90).default(30),
+	// Flag when the recent median is at least factor x the baseline median
+	factor: z.coerce.number().gt(1).max(100).default(1.5),
+	// Latest results per test that make up the current median
+	recent: z.coerce.number().int().min(1).max(50).default(5),
+	// Results before those; tests with fewer are skipped
+	baseline: z.coerce.number().int().min(3).max(200).default(20),
+	limit: z.coerce.number().int().min(1).max(100).default(20),
+});
+
+const MAX_STATS_WINDOW_DAYS = 90;
+
+const StatsQuery = z.object({
+	// Whole days, e.g. 7d
+	window: z.string().default('7d'),
+});
+
+/** "7d" -> 7; null unless 1..MAX_STATS_WINDOW_DAYS whole days. */
+function parseWindowDays(window: string) {
+	const match = /^(\d{1,3})d$/.exec(window.trim());
+	const days = match ? Number(match[1]) : 0;
+	return days >= 1 && days <= MAX_STATS_WINDOW_DAYS ? days : null;
+}
+
+function cutoffDate(now: Date, days: number) {
+	return new Date(now.getTime() - days * 24 * 60 * 60 * 1000);
 }
 
 export const analyticsRoutes: FastifyPluginAsync = async (app) => {
@@ -24,6 +60,16 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 		requireAuth(req);
 	});
 
+	// Every query here scans a window of results: stop it in Postgres when
+	// the client disconnects or the request times out
+	const replicaQuery = <T>(
+		req: FastifyRequest,
+		query: (tx: Prisma.TransactionClient) => Promise<T>,
+	) =>
+		cancellableQuery(app.db.replica(), req.abortSignal, query, {
+			timeoutMs: app.config.REQUEST_TIMEOUT,
+		});
+
 	app.get('/projects/:projectId/analytics/timeseries', async (req) => {
 		const { projectId } = ProjectParams.parse(req.params);
 		const query = DaysQuery.parse(req.query);
@@ -31,7 +77,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const cutoff = cutoffDate(query.days);
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, query.days);
 		const startDaysAgo = query.days - 1;
 
 		type Row = {
@@ -43,11 +90,12 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			totalcount: number;
 		};
 
-		const rows = await app.prisma.$queryRaw<Row[]>`
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
 			WITH days AS (
 				SELECT generate_series(
-					date_trunc('day', now()) - (${startDaysAgo} * interval '1 day'),
-					date_trunc('day', now()),
+					date_trunc('day', ${now}::timestamp) - (${startDaysAgo} * interval '1 day'),
+					date_trunc('day', ${now}::timestamp),
 					interval '1 day'
 				) AS day
 			), filtered AS (
@@ -68,7 +116,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			LEFT JOIN filtered f ON date_trunc('day', f.created_at) = d.day
 			GROUP BY d.day
 			ORDER BY d.day ASC;
-		`;
+		`,
+		);
 
 		return {
 			days: query.days,
@@ -83,6 +132,108 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 		};
 	});
 
+	// Dashboard headline numbers for runs created in the window. One query:
+	// per-day rows, each carrying the window totals.
+	app.get('/projects/:projectId/stats', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const query = StatsQuery.parse(req.query);
+		const days = parseWindowDays(query.window);
+		if (!days) {
+			throw app.httpErrors.badRequest(
+				`Invalid window "${query.window}" (use 1d to ${MAX_STATS_WINDOW_DAYS}d)`,
+			);
+		}
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, days);
+		const startDaysAgo = days - 1;
+
+		type Row = {
+			day: string;
+			passed: number;
+			failed: number;
+			totalruns: number;
+			passedruns: number;
+			failedruns: number;
+			avgdurationms: number | null;
+			flakycount: number;
+		};
+
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
+			WITH days AS (
+				SELECT generate_series(
+					date_trunc('day', ${now}::timestamp) - (${startDaysAgo} * interval '1 day'),
+					date_trunc('day', ${now}::timestamp),
+					interval '1 day'
+				) AS day
+			), runs AS (
+				SELECT status, "durationMs" AS duration_ms, "createdAt" AS created_at
+				FROM "TestRun"
+				WHERE "projectId" = ${project.id}
+				  AND "createdAt" >= ${cutoff}
+			), totals AS (
+				SELECT
+					COUNT(*)::int AS total_runs,
+					COUNT(*) FILTER (WHERE status = 'COMPLETED')::int AS passed_runs,
+					COUNT(*) FILTER (WHERE status = 'FAILED')::int AS failed_runs,
+					AVG(duration_ms)::float8 AS avg_duration_ms
+				FROM runs
+			), flaky AS (
+				-- Same rule as /flaky without its minRuns: passed and failed
+				SELECT tr."testCaseId"
+				FROM "TestResult" tr
+				JOIN "TestRun" r ON r.id = tr."runId"
+				WHERE r."projectId" = ${project.id}
+				  AND r."createdAt" >= ${cutoff}
+				  AND tr.status <> 'SKIPPED'
+				GROUP BY tr."testCaseId"
+				HAVING bool_or(tr.status = 'PASSED')
+				   AND bool_or(tr.status IN ('FAILED', 'ERROR'))
+			)
+			SELECT
+				to_char(d.day::date, 'YYYY-MM-DD') AS day,
+				COUNT(r.status) FILTER (WHERE r.status = 'COMPLETED')::int AS passed,
+				COUNT(r.status) FILTER (WHERE r.status = 'FAILED')::int AS failed,
+				t.total_runs AS totalRuns,
+				t.passed_runs AS passedRuns,
+				t.failed_runs AS failedRuns,
+				t.avg_duration_ms AS avgDurationMs,
+				(SELECT COUNT(*)::int FROM flaky) AS flakyCount
+			FROM days d
+			CROSS JOIN totals t
+			LEFT JOIN runs r ON date_trunc('day', r.created_at) = d.day
+			GROUP BY d.day, t.total_runs, t.passed_runs, t.failed_runs, t.avg_duration_ms
+			ORDER BY d.day ASC;
+		`,
+		);
+
+		// Every row carries the totals; the series always has `days` rows
+		const totals = rows[0];
+		const finishedRuns = totals.passedruns + totals.failedruns;
+
+		return {
+			window: `${days}d`,
+			days,
+			totalRuns: totals.totalruns,
+			// Share of finished (COMPLETED or FAILED) runs that passed
+			passRate: finishedRuns ? totals.passedruns / finishedRuns : null,
+			avgDurationMs:
+				totals.avgdurationms == null
+					? null
+					: Math.round(totals.avgdurationms),
+			flakyCount: totals.flakycount,
+			items: rows.map((r: Row) => ({
+				day: r.day,
+				passed: r.passed,
+				failed: r.failed,
+			})),
+		};
+	});
+
 	app.get('/projects/:projectId/analytics/slowest-tests', async (req) => {
 		const { projectId } = ProjectParams.parse(req.params);
 		const query = DaysLimitQuery.parse(req.query);
@@ -90,7 +241,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const cutoff = cutoffDate(query.days);
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, query.days);
 
 		type Row = {
 			testcaseid: string;
@@ -102,7 +254,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			samplescount: number;
 		};
 
-		const rows = await app.prisma.$queryRaw<Row[]>`
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
 			WITH filtered AS (
 				SELECT
 					tr."testCaseId" AS testCaseId,
@@ -129,7 +282,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			GROUP BY f.testCaseId
 			ORDER BY AVG(f.durationMs) DESC NULLS LAST
 			LIMIT ${query.limit};
-		`;
+		`,
+		);
 
 		return {
 			days: query.days,
@@ -152,7 +306,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const cutoff = cutoffDate(query.days);
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, query.days);
 
 		type Row = {
 			testcaseid: string;
@@ -164,7 +319,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			totalcount: number;
 		};
 
-		const rows = await app.prisma.$queryRaw<Row[]>`
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
 			SELECT
 				tc.id AS testCaseId,
 				tc.name AS name,
@@ -182,7 +338,8 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			HAVING COUNT(*) > 0
 			ORDER BY (SUM(CASE WHEN tr.status IN ('FAILED','ERROR') THEN 1 ELSE 0 END)) DESC
 			LIMIT ${query.limit};
-		`;
+		`,
+		);
 
 		return {
 			days: query.days,
@@ -197,4 +354,251 @@ export const analyticsRoutes: FastifyPluginAsync = async (app) => {
 			})),
 		};
 	});
+
+	// Tests that both passed and failed within the window (skips ignored),
+	// ranked by how often consecutive runs flip between pass and fail
+	app.get('/projects/:projectId/flaky', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const query = FlakyQuery.parse(req.query);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, query.days);
+
+		type Row = {
+			testcaseid: string;
+			name: string;
+			externalid: string;
+			suitename: string | null;
+			runcount: number;
+			failedcount: number;
+			flipcount: number;
+			samecommitflips: number;
+			lastpassedat: Date;
+			lastfailedat: Date;
+		};
+
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
+			WITH results AS (
+				SELECT
+					tr."testCaseId" AS test_case_id,
+					r.id AS run_id,
+					r."commitSha" AS commit_sha,
+					r."createdAt" AS run_at,
+					CASE WHEN tr.status IN ('FAILED','ERROR') THEN 1 ELSE 0 END AS failed
+				FROM "TestResult" tr
+				JOIN "TestRun" r ON r.id = tr."runId"
+				WHERE r."projectId" = ${project.id}
+				  AND r."createdAt" >= ${cutoff}
+				  AND tr.status <> 'SKIPPED'
+			), ordered AS (
+				SELECT
+					*,
+					LAG(failed) OVER (
+						PARTITION BY test_case_id ORDER BY run_at, run_id
+					) AS prev_failed
+				FROM results
+			), per_test AS (
+				SELECT
+					test_case_id,
+					COUNT(*)::int AS run_count,
+					SUM(failed)::int AS failed_count,
+					SUM(CASE WHEN prev_failed <> failed THEN 1 ELSE 0 END)::int AS flip_count,
+					MAX(CASE WHEN failed = 0 THEN run_at END) AS last_passed_at,
+					MAX(CASE WHEN failed = 1 THEN run_at END) AS last_failed_at
+				FROM ordered
+				GROUP BY test_case_id
+			), mixed_commits AS (
+				-- Same commit, both outcomes: the strongest flakiness signal
+				SELECT test_case_id, COUNT(*)::int AS commit_count
+				FROM (
+					SELECT test_case_id
+					FROM results
+					WHERE commit_sha IS NOT NULL
+					GROUP BY test_case_id, commit_sha
+					HAVING MIN(failed) = 0 AND MAX(failed) = 1
+				) m
+				GROUP BY test_case_id
+			)
+			SELECT
+				tc.id AS testCaseId,
+				tc.name AS name,
+				tc."externalId" AS externalId,
+				tc."suiteName" AS suiteName,
+				p.run_count AS runCount,
+				p.failed_count AS failedCount,
+				p.flip_count AS flipCount,
+				COALESCE(mc.commit_count, 0)::int AS sameCommitFlips,
+				p.last_passed_at AS lastPassedAt,
+				p.last_failed_at AS lastFailedAt
+			FROM per_test p
+			JOIN "TestCase" tc ON tc.id = p.test_case_id
+			LEFT JOIN mixed_commits mc ON mc.test_case_id = p.test_case_id
+			WHERE p.run_count >= ${query.minRuns}
+			  AND p.failed_count > 0
+			  AND p.failed_count < p.run_count
+			ORDER BY
+				p.flip_count::float / (p.run_count - 1) DESC,
+				COALESCE(mc.commit_count, 0) DESC,
+				p.last_failed_at DESC
+			LIMIT ${query.limit};
+		`,
+		);
+
+		// Per environment value (null = runs that didn't report it), worst
+		// first: "fails on macos, passes on linux" shows up at a glance
+		type EnvironmentRow = {
+			testcaseid: string;
+			value: string | null;
+			runcount: number;
+			failedcount: number;
+		};
+		const environments = new Map<string, EnvironmentRow[]>();
+		if (query.groupBy && rows.length) {
+			const testCaseIds = rows.map((r) => r.testcaseid);
+			const breakdown = await replicaQuery(req, (tx) =>
+				tx.$queryRaw<EnvironmentRow[]>`
+				SELECT
+					tr."testCaseId" AS testCaseId,
+					r.environment ->> ${query.groupBy}::text AS value,
+					COUNT(*)::int AS runCount,
+					SUM(CASE WHEN tr.status IN ('FAILED','ERROR') THEN 1 ELSE 0 END)::int AS failedCount
+				FROM "TestResult" tr
+				JOIN "TestRun" r ON r.id = tr."runId"
+				WHERE r."projectId" = ${project.id}
+				  AND r."createdAt" >= ${cutoff}
+				  AND tr.status <> 'SKIPPED'
+				  AND tr."testCaseId" = ANY(${testCaseIds})
+				GROUP BY 1, 2
+			`,
+			);
+			const rate = (row: EnvironmentRow) => row.failedcount / row.runcount;
+			breakdown.sort((a, b) => rate(b) - rate(a) || b.runcount - a.runcount);
+			for (const row of breakdown) {
+				const list = environments.get(row.testcaseid);
+				if (list) list.push(row);
+				else environments.set(row.testcaseid, [row]);
+			}
+		}
+
+		return {
+			days: query.days,
+			minRuns: query.minRuns,
+			...(query.groupBy ? { groupBy: query.groupBy } : {}),
+			items: rows.map((r: Row) => ({
+				testCaseId: r.testcaseid,
+				name: r.name,
+				externalId: r.externalid,
+				suiteName: r.suitename,
+				runCount: r.runcount,
+				failedCount: r.failedcount,
+				failureRate: r.failedcount / r.runcount,
+				flipCount: r.flipcount,
+				flipRate: r.flipcount / (r.runcount - 1),
+				sameCommitFlips: r.samecommitflips,
+				lastPassedAt: r.lastpassedat,
+				lastFailedAt: r.lastfailedat,
+				...(query.groupBy
+					? {
+							environments: (environments.get(r.testcaseid) ?? []).map(
+								(e) => ({
+									value: e.value,
+									runCount: e.runcount,
+									failedCount: e.failedcount,
+									failureRate: e.failedcount / e.runcount,
+								}),
+							),
+						}
+					: {}),
+			})),
+		};
+	});
+
+	// Tests whose median duration over the last `recent` results is at least
+	// `factor` times the median of the `baseline` results before them
+	app.get('/projects/:projectId/slow', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const query = SlowQuery.parse(req.query);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const now = app.clock.now();
+		const cutoff = cutoffDate(now, query.days);
+
+		type Row = {
+			testcaseid: string;
+			name: string;
+			externalid: string;
+			suitename: string | null;
+			baselinems: number;
+			currentms: number;
+		};
+
+		const rows = await replicaQuery(req, (tx) =>
+			tx.$queryRaw<Row[]>`
+			WITH ranked AS (
+				SELECT
+					tr."testCaseId" AS test_case_id,
+					tr."durationMs" AS duration_ms,
+					ROW_NUMBER() OVER (
+						PARTITION BY tr."testCaseId"
+						ORDER BY r."createdAt" DESC, r.id DESC
+					) AS rn
+				FROM "TestResult" tr
+				JOIN "TestRun" r ON r.id = tr."runId"
+				WHERE r."projectId" = ${project.id}
+				  AND r."createdAt" >= ${cutoff}
+				  AND tr."durationMs" IS NOT NULL
+				  AND tr.status <> 'SKIPPED'
+			), per_test AS (
+				SELECT
+					test_case_id,
+					percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms)
+						FILTER (WHERE rn <= ${query.recent}) AS current_ms,
+					percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms)
+						FILTER (WHERE rn > ${query.recent}) AS baseline_ms,
+					COUNT(*) FILTER (WHERE rn > ${query.recent})::int AS baseline_count
+				FROM ranked
+				WHERE rn <= ${query.recent + query.baseline}
+				GROUP BY test_case_id
+			)
+			SELECT
+				tc.id AS testCaseId,
+				tc.name AS name,
+				tc."externalId" AS externalId,
+				tc."suiteName" AS suiteName,
+				p.baseline_ms AS baselineMs,
+				p.current_ms AS currentMs
+			FROM per_test p
+			JOIN "TestCase" tc ON tc.id = p.test_case_id
+			WHERE p.baseline_count >= ${query.baseline}
+			  AND p.baseline_ms > 0
+			  AND p.current_ms >= p.baseline_ms * ${query.factor}
+			ORDER BY p.current_ms / p.baseline_ms DESC, tc.name ASC
+			LIMIT ${query.limit};
+		`,
+		);
+
+		return {
+			days: query.days,
+			factor: query.factor,
+			recent: query.recent,
+			baseline: query.baseline,
+			items: rows.map((r: Row) => ({
+				testCaseId: r.testcaseid,
+				name: r.name,
+				externalId: r.externalid,
+				suiteName: r.suitename,
+				baselineMs: Math.round(r.baselinems),
+				currentMs: Math.round(r.currentms),
+				// One decimal, e.g. 52.5 for 1.525x
+				increasePercent:
+					Math.round((r.currentms / r.baselinems - 1) * 1000) / 10,
+			})),
+		};
+	});
 };
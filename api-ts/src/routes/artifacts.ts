@@ -0,0 +1,230 @@
+import fs from 'node:fs';
+import os from 'node:os';
+import path from 'node:path';
+import { randomUUID } from 'node:crypto';
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { requireAuth, getAuth, requireApiKey } from '../lib/requireAuth';
+import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import { requireRun } from '../lib/requireRun';
+import {
+	ArtifactTooLargeError,
+	stageFile,
+	type StagedFile,
+} from '../lib/artifactStorage';
+import {
+	MultipartError,
+	multipartBoundary,
+	readMultipartFile,
+} from '../lib/multipart';
+
+const RunIdParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+	runId: z.string().min(1),
+});
+
+const ArtifactParams = RunIdParams.extend({
+	artifactId: z.string().min(1),
+});
+
+// Room for part headers and other form fields around the file itself
+const MULTIPART_OVERHEAD_BYTES = 64 * 1024;
+
+const artifactSelect = {
+	id: true,
+	runId: true,
+	filename: true,
+	contentType: true,
+	sizeBytes: true,
+	sha256: true,
+	createdAt: true,
+} as const;
+
+/** Exact match, or a "type/*" entry matching the whole family. */
+function isAllowedType(contentType: string, allowed: string[]) {
+	return allowed.some((entry) => {
+		const rule = entry.toLowerCase();
+		return rule.endsWith('/*')
+			? contentType.startsWith(rule.slice(0, -1))
+			: contentType === rule;
+	});
+}
+
+/** Last path segment, without control characters or quotes. */
+function sanitizeFilename(raw: string) {
+	const name = raw
+		.split(/[\\/]/)
+		.pop()!
+		.replace(/[\u0000-\u001f\u007f"]/g, '')
+		.trim()
+		.slice(0, 255);
+	return name || 'artifact';
+}
+
+function contentDisposition(filename: string) {
+	const ascii = filename.replace(/[^\x20-\x7e]/g, '_').replace(/\\/g, '_');
+	const encoded = encodeURIComponent(filename);
+	return `attachment; filename="${ascii}"; filename*=UTF-8''${encoded}`;
+}
+
+export const artifactRoutes: FastifyPluginAsync = async (app) => {
+	// Auth guard for *all* routes in this plugin
+	app.addHook('preHandler', async (req) => {
+		requireAuth(req);
+	});
+
+	// Leave the body unread: the upload handler streams it from req.raw
+	app.addContentTypeParser('multipart/form-data', (_req, _payload, done) =>
+		done(null),
+	);
+
+	// List a run's artifacts
+	app.get('/projects/:projectId/runs/:runId/artifacts', async (req) => {
+		const { projectId, runId } = RunIdParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+		const run = await requireRun(app, project.id, runId);
+
+		const items = await app.prisma.artifact.findMany({
+			where: { runId: run.id },
+			orderBy: { createdAt: 'asc' },
+			select: artifactSelect,
+		});
+
+		return { items };
+	});
+
+	// Upload one file (first file part of a multipart/form-data body)
+	app.post('/projects/:projectId/runs/:runId/artifacts', async (req, reply) => {
+		const { projectId, runId } = RunIdParams.parse(req.params);
+
+		const maxBytes = app.config.ARTIFACT_MAX_BYTES;
+		// The stream is capped either way; a declared oversize body is
+		// refused before any of it is read
+		const declaredBytes = Number(req.headers['content-length']);
+		if (declaredBytes > maxBytes + MULTIPART_OVERHEAD_BYTES) {
+			throw app.httpErrors.payloadTooLarge(
+				`artifact exceeds the ${maxBytes} byte limit`,
+			);
+		}
+
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+		const run = await requireRun(app, project.id, runId);
+
+		const boundary = multipartBoundary(req.headers['content-type']);
+		if (!boundary) {
+			throw app.httpErrors.unsupportedMediaType(
+				'Expected a multipart/form-data upload',
+			);
+		}
+
+		const tmpDir = await fs.promises.mkdtemp(
+			path.join(os.tmpdir(), 'testhub-artifact-'),
+		);
+
+		try {
+			let staged: StagedFile & { filename: string };
+			try {
+				staged = await readMultipartFile(
+					req.raw,
+					boundary,
+					{ maxTotalBytes: maxBytes + MULTIPART_OVERHEAD_BYTES },
+					async (part, body) => {
+						const allowed = app.config.ARTIFACT_ALLOWED_TYPES;
+						if (!isAllowedType(part.contentType, allowed)) {
+							throw app.httpErrors.unsupportedMediaType(
+								`Content type ${part.contentType} is not allowed`,
+							);
+						}
+						const file = await stageFile(
+							body,
+							path.join(tmpDir, 'upload'),
+							maxBytes,
+							part.contentType,
+						);
+						return { ...file, filename: sanitizeFilename(part.filename) };
+					},
+				);
+			} catch (err) {
+				if (err instanceof ArtifactTooLargeError) {
+					throw app.httpErrors.payloadTooLarge(err.message);
+				}
+				if (err instanceof MultipartError) {
+					throw err.statusCode === 413
+						? app.httpErrors.payloadTooLarge(err.message)
+						: app.httpErrors.badRequest(err.message);
+				}
+				throw err;
+			}
+
+			const storageKey = `runs/${run.id}/${randomUUID()}`;
+			await app.artifactStorage.put(storageKey, staged);
+
+			try {
+				const artifact = await app.prisma.artifact.create({
+					data: {
+						runId: run.id,
+						filename: staged.filename,
+						contentType: staged.contentType,
+						sizeBytes: staged.size,
+						sha256: staged.sha256,
+						storageKey,
+					},
+					select: artifactSelect,
+				});
+				return reply.code(201).send(artifact);
+			} catch (err) {
+				await app.artifactStorage.delete(storageKey).catch(() => undefined);
+				throw err;
+			}
+		} finally {
+			await fs.promises.rm(tmpDir, { recursive: true, force: true });
+		}
+	});
+
+	// Download (streamed from storage, always as an attachment). HEAD is
+	// routed here explicitly rather than through Fastify's automatic HEAD
+	// route, which would open the object and read it to the end only to
+	// discard it.
+	app.route({
+		method: ['GET', 'HEAD'],
+		url: '/projects/:projectId/runs/:runId/artifacts/:artifactId',
+		handler: async (req, reply) => {
+			const { projectId, runId, artifactId } = ArtifactParams.parse(
+				req.params,
+			);
+
+			const { orgId } = getAuth(req);
+			const project = await requireProjectForOrg(app, projectId, orgId);
+			const run = await requireRun(app, project.id, runId);
+
+			const artifact = await app.prisma.artifact.findFirst({
+				where: { id: artifactId, runId: run.id },
+				select: { ...artifactSelect, storageKey: true },
+			});
+			if (!artifact) throw app.httpErrors.notFound('Artifact not found');
+
+			reply
+				.header('content-type', artifact.contentType)
+				.header('content-length', artifact.sizeBytes)
+				.header('content-disposition', contentDisposition(artifact.filename))
+				.header('etag', `"${artifact.sha256}"`);
+			if (req.method === 'HEAD') return reply.send();
+
+			const body = await app.artifactStorage.get(artifact.storageKey);
+			if (!body) {
+				req.log.error(
+					{ artifactId: artifact.id, storageKey: artifact.storageKey },
+					'artifact content missing from storage',
+				);
+				throw app.httpErrors.notFound('Artifact content not found');
+			}
+
+			return reply.send(body);
+		},
+	});
+};
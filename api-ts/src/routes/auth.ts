@@ -8,6 +8,7 @@ import {
 	hashToken,
 	verifyPassword,
 } from '../lib/authPasswords';
+import { clientIp } from '../lib/clientIp';
 
 const GithubCallbackQuery = z.object({
 	code: z.string().min(1),
@@ -215,7 +216,7 @@ export const authRoutes: FastifyPluginAsync = async (app) => {
 
 	app.post('/auth/login', async (req, reply) => {
 		try {
-			checkRateLimit(`login:${req.ip}`, 10, 60_000);
+			checkRateLimit(`login:${clientIp(req)}`, 10, 60_000);
 		} catch {
 			req.log.warn({ reasonCode: 'rate_limited' }, 'auth.login.blocked');
 			throw app.httpErrors.tooManyRequests('Too many attempts');
@@ -376,7 +377,7 @@ export const authRoutes: FastifyPluginAsync = async (app) => {
 
 	app.post('/auth/password/forgot', async (req, reply) => {
 		try {
-			checkRateLimit(`forgot:${req.ip}`, 5, 60_000);
+			checkRateLimit(`forgot:${clientIp(req)}`, 5, 60_000);
 		} catch {
 			return reply.code(204).send();
 		}
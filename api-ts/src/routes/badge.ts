@@ -0,0 +1,63 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { badgeStatus, renderBadge } from '../lib/badge';
+import {
+	httpDate,
+	jsonEtag,
+	notModified,
+	publicCacheControl,
+} from '../lib/etag';
+
+const ProjectParams = z.object({
+	projectId: z.string().min(1), // db id, or a slug unique across orgs
+});
+
+const BadgeQuery = z.object({
+	branch: z.string().trim().max(255).optional(),
+});
+
+/**
+ * Public status badge for READMEs: no auth, and nothing but the status of
+ * the latest finished run. Unknown projects and ambiguous slugs get the
+ * "unknown" badge rather than a 404, so the endpoint doesn't tell which
+ * projects exist.
+ */
+export const badgeRoutes: FastifyPluginAsync = async (app) => {
+	app.get('/projects/:projectId/badge.svg', async (req, reply) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const query = BadgeQuery.safeParse(req.query);
+		if (!query.success) throw app.httpErrors.badRequest('Invalid branch');
+
+		const project = await app.repos.projects.resolvePublic(projectId);
+		const branch = query.data.branch || project?.defaultBranch || undefined;
+		const latest = project
+			? await app.repos.runs.latestFinished(project.id, branch)
+			: null;
+
+		const svg = renderBadge('tests', badgeStatus(latest?.status ?? null));
+		const etag = jsonEtag(svg);
+		// The badge changes with a newer run or a project edit (default
+		// branch); nothing to date it by when the project is unknown
+		const lastModified = project
+			? new Date(
+					Math.max(
+						project.updatedAt.getTime(),
+						latest?.finishedAt.getTime() ?? 0,
+					),
+				)
+			: null;
+
+		// Stale-while-revalidate lets README image proxies absorb the
+		// traffic while still picking up a new run soon after its max-age
+		const maxAge = app.config.BADGE_CACHE_MAX_AGE;
+		reply
+			.header('content-type', 'image/svg+xml; charset=utf-8')
+			.header('cache-control', publicCacheControl(maxAge, maxAge * 5))
+			.header('etag', etag);
+		if (lastModified) reply.header('last-modified', httpDate(lastModified));
+		if (notModified(req.headers, { etag, lastModified })) {
+			return reply.code(304).send();
+		}
+		return reply.send(svg);
+	});
+};
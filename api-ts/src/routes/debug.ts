@@ -0,0 +1,115 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { Session } from 'node:inspector/promises';
+import v8 from 'node:v8';
+import { z } from 'zod';
+import { parseJsonBody } from '../lib/jsonBody';
+import { requireAuth } from '../lib/requireAuth';
+import { RuntimeStats } from '../lib/runtimeStats';
+
+const MaintenanceBody = z.strictObject({
+	enabled: z.boolean(),
+});
+
+const ProfileQuery = z.object({
+	// Keep below REQUEST_TIMEOUT (default 30s)
+	seconds: z.coerce.number().int().min(1).max(25).default(10),
+});
+
+let profiling = false;
+
+/**
+ * Profiling endpoints (Node's take on Go's /debug/pprof), only registered
+ * when TESTHUB_ENABLE_PPROF=true and always behind auth:
+ *   GET /debug/pprof/          process/heap stats
+ *   GET /debug/pprof/heap      V8 heap snapshot (open in Chrome DevTools)
+ *   GET /debug/pprof/profile   CPU profile over ?seconds= (DevTools / speedscope)
+ * A heap snapshot holds every secret in memory (config, tokens, other
+ * users' requests), so the heap route exists only with TESTHUB_ADMIN_PORT
+ * set, which keeps it off the public port.
+ */
+export const debugRoutes: FastifyPluginAsync = async (app) => {
+	app.addHook('preHandler', async (req) => {
+		requireAuth(req);
+	});
+
+	app.get('/debug/pprof/', async () => ({
+		pid: process.pid,
+		uptimeSeconds: process.uptime(),
+		memory: process.memoryUsage(),
+		heap: v8.getHeapStatistics(),
+		resources: process.resourceUsage(),
+	}));
+
+	if (app.config.TESTHUB_ADMIN_PORT) {
+		app.get('/debug/pprof/heap', async (req, reply) => {
+			req.log.warn('writing heap snapshot (blocks the event loop)');
+			return reply
+				.header('content-type', 'application/octet-stream')
+				.header(
+					'content-disposition',
+					`attachment; filename="testhub-${process.pid}-${Date.now()}.heapsnapshot"`,
+				)
+				.send(v8.getHeapSnapshot());
+		});
+	}
+
+	app.get('/debug/pprof/profile', async (req, reply) => {
+		const { seconds } = ProfileQuery.parse(req.query);
+		if (profiling) {
+			throw app.httpErrors.conflict('A CPU profile is already being taken');
+		}
+
+		profiling = true;
+		const session = new Session();
+		session.connect();
+		try {
+			req.log.info({ seconds }, 'taking CPU profile');
+			await session.post('Profiler.enable');
+			await session.post('Profiler.start');
+			await new Promise((resolve) => setTimeout(resolve, seconds * 1000));
+			const { profile } = await session.post('Profiler.stop');
+
+			return reply
+				.header(
+					'content-disposition',
+					`attachment; filename="testhub-${process.pid}-${Date.now()}.cpuprofile"`,
+				)
+				.send(profile);
+		} finally {
+			session.disconnect();
+			profiling = false;
+		}
+	});
+};
+
+/**
+ * GET /debug/stats: runtime counters as JSON (see RuntimeSnapshot). Only
+ * registered with TESTHUB_ADMIN_PORT set, so it is reachable on the admin
+ * listener alone and, like /metrics there, needs no auth.
+ */
+export const runtimeStatsRoutes: FastifyPluginAsync = async (app) => {
+	const runtime = new RuntimeStats();
+	app.addHook('onClose', async () => runtime.close());
+
+	app.get('/debug/stats', async (_req, reply) => {
+		return reply.header('cache-control', 'no-store').send(runtime.snapshot());
+	});
+};
+
+/**
+ * GET/PUT /debug/maintenance: read or switch maintenance mode (see the
+ * maintenance plugin). Registered next to /debug/stats, so only on the
+ * admin listener and without auth.
+ */
+export const maintenanceRoutes: FastifyPluginAsync = async (app) => {
+	app.get('/debug/maintenance', async (_req, reply) => {
+		return reply.header('cache-control', 'no-store').send(app.maintenance());
+	});
+
+	app.put('/debug/maintenance', async (req, reply) => {
+		const { enabled } = parseJsonBody(req, MaintenanceBody);
+		return reply
+			.header('cache-control', 'no-store')
+			.send(app.setMaintenance(enabled, 'admin'));
+	});
+};
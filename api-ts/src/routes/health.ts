@@ -1,15 +1,49 @@
-import type { FastifyPluginAsync } from 'fastify';
+import type {
+	FastifyPluginAsync,
+	FastifyReply,
+	FastifyRequest,
+} from 'fastify';
+import { buildInfo } from '../lib/buildInfo';
+import { startedAt, uptimeSeconds } from '../lib/uptime';
 
+/**
+ * Probes, Kubernetes style: /livez (liveness) answers 200 while the process
+ * can serve at all and never touches the DB; /readyz (readiness) is 503
+ * while a dependency check fails or the server is shutting down. /health and
+ * /ready are the original names, kept as aliases.
+ */
 export const healthRoutes: FastifyPluginAsync = async (app) => {
-	app.get('/health', async (req) => {
-		// TEMP: verify request context wiring (Step 8B)
-		req.log.info({ auth: req.ctx.auth }, 'request auth context');
+	const live = async (req: FastifyRequest) => {
+		req.log.debug({ auth: req.ctx.auth }, 'request auth context');
 
-		return { ok: true };
-	});
+		return {
+			ok: true,
+			...buildInfo,
+			started_at: startedAt,
+			uptime_seconds: uptimeSeconds(app.clock),
+		};
+	};
 
-	app.get('/ready', async () => {
-		await app.prisma.$queryRaw`SELECT 1`;
-		return { ok: true };
-	});
+	// 200 only when every registered dependency check passes
+	const ready = async (req: FastifyRequest, reply: FastifyReply) => {
+		const report = await app.runReadinessChecks();
+
+		if (!report.ok) {
+			req.log.warn(
+				{ checks: report.checks.filter((c) => c.status === 'error') },
+				'readiness check failed',
+			);
+			return reply.code(503).send(report);
+		}
+
+		return report;
+	};
+
+	app.get('/livez', live);
+	app.get('/health', live);
+	app.get('/readyz', ready);
+	app.get('/ready', ready);
+
+	// Which build is deployed (same fields as /health)
+	app.get('/version', async () => buildInfo);
 };
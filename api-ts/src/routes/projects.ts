@@ -1,17 +1,30 @@
 import type { FastifyPluginAsync } from 'fastify';
-import type { Prisma } from '@prisma/client';
 import { z } from 'zod';
+import { parseJsonBody } from '../lib/jsonBody';
 import { requireAuth, getAuth } from '../lib/requireAuth';
 import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import { UniqueConstraintError } from '../repositories/types';
 
-const CreateProjectBody = z.object({
+// Retention limits; null (or omitted on create) means no limit
+const RetentionLimit = z.number().int().min(1).nullable().optional();
+
+// Branch the status badge reports on; null (or omitted) means any branch
+const DefaultBranch = z.string().trim().min(1).max(255).nullable().optional();
+
+const CreateProjectBody = z.strictObject({
 	name: z.string().min(1),
 	slug: z.string().min(1),
+	retentionMaxRuns: RetentionLimit,
+	retentionDays: RetentionLimit,
+	defaultBranch: DefaultBranch,
 });
 
-const UpdateProjectBody = z.object({
+const UpdateProjectBody = z.strictObject({
 	name: z.string().min(1).optional(),
 	slug: z.string().min(1).optional(),
+	retentionMaxRuns: RetentionLimit,
+	retentionDays: RetentionLimit,
+	defaultBranch: DefaultBranch,
 });
 
 const ProjectParams = z.object({
@@ -20,16 +33,27 @@ const ProjectParams = z.object({
 
 const SlugPattern = /^[a-z0-9]+(?:-[a-z0-9]+)*$/;
 
+const DeleteProjectQuery = z.object({
+	// Without it, deleting a project that still has runs is a 409
+	cascade: z
+		.enum(['true', 'false'])
+		.optional()
+		.transform((v) => v === 'true'),
+});
+
+const SLUG_IN_USE = 'Project slug is already in use in this organization';
+
 function assertSlug(value: string) {
 	if (!SlugPattern.test(value)) {
 		throw new Error('invalid_slug');
 	}
 }
 
+
 export const projectRoutes: FastifyPluginAsync = async (app) => {
 	// Auth guard for *all* routes in this plugin
 	app.addHook('preHandler', (req, _reply, done) => {
-		req.log.info(
+		req.log.debug(
 			{ url: req.url, method: req.method },
 			'projects preHandler requireAuth',
 		);
@@ -37,7 +61,7 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 		try {
 			requireAuth(req);
 			const { orgId, userId } = getAuth(req);
-			req.log.info(
+			req.log.debug(
 				{ orgId, userId: userId ?? null, reqId: (req as any).id },
 				'projects requireAuth: success',
 			);
@@ -50,7 +74,7 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 
 	// --- DEBUG PING ---
 	app.get('/projects/ping', async (req, reply) => {
-		req.log.info('projects ping handler reached');
+		req.log.debug('projects ping handler reached');
 		const { orgId, userId } = getAuth(req);
 
 		return reply.send({
@@ -64,17 +88,7 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 	app.get('/projects', async (req) => {
 		const { orgId } = getAuth(req);
 
-		const projects = await app.prisma.project.findMany({
-			where: { orgId },
-			orderBy: { createdAt: 'desc' },
-			select: {
-				id: true,
-				name: true,
-				slug: true,
-				createdAt: true,
-				updatedAt: true,
-			},
-		});
+		const projects = await app.repos.projects.listForOrg(orgId);
 
 		// matches ProjectListResponse (items: Project[])
 		return { items: projects };
@@ -83,37 +97,23 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 	// --- CREATE PROJECT ---
 	app.post('/projects', async (req, reply) => {
 		const { orgId } = getAuth(req);
-		const body = CreateProjectBody.parse(req.body);
+		const body = parseJsonBody(req, CreateProjectBody);
 
 		try {
-			const project = await app.prisma.project.create({
-				data: {
-					orgId,
-					name: body.name,
-					slug: body.slug,
-				},
-				select: {
-					id: true,
-					name: true,
-					slug: true,
-					createdAt: true,
-					updatedAt: true,
-				},
+			const project = await app.repos.projects.create({
+				orgId,
+				name: body.name,
+				slug: body.slug,
+				retentionMaxRuns: body.retentionMaxRuns,
+				retentionDays: body.retentionDays,
+				defaultBranch: body.defaultBranch,
 			});
 
 			// OpenAPI says 201 Created
 			return reply.code(201).send(project);
 		} catch (err) {
-			if (
-				err &&
-				typeof err === 'object' &&
-				'code' in err &&
-				(err as { code?: string }).code === 'P2002'
-			) {
-				// Unique constraint violation (likely orgId+slug)
-				throw app.httpErrors.badRequest(
-					'Project slug is already in use in this organization',
-				);
+			if (err instanceof UniqueConstraintError) {
+				throw app.httpErrors.conflict(SLUG_IN_USE);
 			}
 			throw err;
 		}
@@ -127,17 +127,9 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 		// Ensure the project exists + belongs to this org
 		const base = await requireProjectForOrg(app, projectId, orgId);
 
-		// Fetch with a typed select that matches the OpenAPI Project schema
-		const project = await app.prisma.project.findUniqueOrThrow({
-			where: { id: base.id },
-			select: {
-				id: true,
-				name: true,
-				slug: true,
-				createdAt: true,
-				updatedAt: true,
-			},
-		});
+		// Full row matching the OpenAPI Project schema
+		const project = await app.repos.projects.get(base.id);
+		if (!project) throw app.httpErrors.notFound('Project not found');
 
 		return project;
 	});
@@ -146,24 +138,16 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 	app.patch('/projects/:projectId', async (req) => {
 		const { orgId } = getAuth(req);
 		const { projectId } = ProjectParams.parse(req.params);
-		const body = UpdateProjectBody.parse(req.body);
-
-		if (!app.prisma) {
-			throw app.httpErrors.internalServerError('Prisma not initialized');
-		}
+		const body = parseJsonBody(req, UpdateProjectBody);
 
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
 		const nextName = body.name?.trim();
-		const nextSlugRaw = body.slug?.trim();
-		const wantsSlugChange =
-			nextSlugRaw != null &&
-			nextSlugRaw.length > 0 &&
-			nextSlugRaw !== project.slug;
+		const nextSlug = body.slug?.trim();
 
-		if (nextSlugRaw) {
+		if (nextSlug) {
 			try {
-				assertSlug(nextSlugRaw);
+				assertSlug(nextSlug);
 			} catch (err) {
 				if (err instanceof Error && err.message === 'invalid_slug') {
 					throw app.httpErrors.badRequest(
@@ -175,75 +159,17 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 		}
 
 		try {
-			const updated = await app.prisma.$transaction(
-				async (tx: Prisma.TransactionClient) => {
-					const aliasDelegate = (tx as typeof app.prisma).projectSlugAlias as
-						| typeof app.prisma.projectSlugAlias
-						| undefined;
-
-					if (wantsSlugChange && nextSlugRaw) {
-						const existingProject = await tx.project.findFirst({
-							where: { slug: nextSlugRaw, orgId },
-							select: { id: true },
-						});
-						if (existingProject && existingProject.id !== project.id) {
-							throw app.httpErrors.badRequest(
-								'Project slug is already in use in this organization',
-							);
-						}
-
-						if (aliasDelegate) {
-							const existingAlias = await aliasDelegate.findUnique({
-								where: { slug: nextSlugRaw },
-								select: { projectId: true },
-							});
-							if (existingAlias && existingAlias.projectId !== project.id) {
-								throw app.httpErrors.badRequest(
-									'Project slug is already in use in this organization',
-								);
-							}
-
-							if (existingAlias && existingAlias.projectId === project.id) {
-								await aliasDelegate.delete({
-									where: { slug: nextSlugRaw },
-								});
-							}
-
-							await aliasDelegate.createMany({
-								data: [{ projectId: project.id, slug: project.slug }],
-								skipDuplicates: true,
-							});
-						}
-					}
-
-					return tx.project.update({
-						where: { id: project.id },
-						data: {
-							...(nextName ? { name: nextName } : {}),
-							...(wantsSlugChange && nextSlugRaw ? { slug: nextSlugRaw } : {}),
-						},
-						select: {
-							id: true,
-							name: true,
-							slug: true,
-							createdAt: true,
-							updatedAt: true,
-						},
-					});
-				},
-			);
-
-			return updated;
+			// A changed slug leaves the old one behind as an alias
+			return await app.repos.projects.update(project, {
+				name: nextName || undefined,
+				slug: nextSlug || undefined,
+				retentionMaxRuns: body.retentionMaxRuns,
+				retentionDays: body.retentionDays,
+				defaultBranch: body.defaultBranch,
+			});
 		} catch (err) {
-			if (
-				err &&
-				typeof err === 'object' &&
-				'code' in err &&
-				(err as { code?: string }).code === 'P2002'
-			) {
-				throw app.httpErrors.badRequest(
-					'Project slug is already in use in this organization',
-				);
+			if (err instanceof UniqueConstraintError) {
+				throw app.httpErrors.conflict(SLUG_IN_USE);
 			}
 			throw err;
 		}
@@ -253,14 +179,23 @@ export const projectRoutes: FastifyPluginAsync = async (app) => {
 	app.delete('/projects/:projectId', async (req, reply) => {
 		const { orgId } = getAuth(req);
 		const { projectId } = ProjectParams.parse(req.params);
+		const { cascade } = DeleteProjectQuery.parse(req.query);
 
 		// Ensure the project exists + belongs to this org
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
+		if (!cascade) {
+			const runCount = await app.repos.projects.countRuns(project.id);
+			if (runCount > 0) {
+				throw app.httpErrors.conflict(
+					`Project has ${runCount} run(s); pass ?cascade=true to delete them too`,
+				);
+			}
+		}
+
 		// Delete the project (cascade will remove runs, test cases, results)
-		await app.prisma.project.delete({
-			where: { id: project.id },
-		});
+		const artifactKeys = await app.repos.projects.delete(project.id);
+		await app.removeArtifactBlobs(artifactKeys);
 
 		return reply.code(204).send();
 	});
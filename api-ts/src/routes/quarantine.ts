@@ -0,0 +1,112 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { parseJsonBody } from '../lib/jsonBody';
+import { requireAuth, getAuth } from '../lib/requireAuth';
+import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+
+const ProjectParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+});
+
+const QuarantineParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+	quarantineId: z.string().min(1),
+});
+
+const QuarantineBody = z.strictObject({
+	// TestCase.name; matches the test in every suite
+	name: z.string().trim().min(1).max(1000),
+	reason: z.string().trim().max(1000).optional(),
+	// Omitted = until removed
+	expiresAt: z.iso.datetime({ offset: true }).optional(),
+});
+
+const quarantineSelect = {
+	id: true,
+	name: true,
+	reason: true,
+	expiresAt: true,
+	createdAt: true,
+	updatedAt: true,
+} as const;
+
+/**
+ * Quarantined (known-flaky) tests: their failures are still recorded but
+ * don't make a run FAILED while the entry is active. Entries past
+ * expiresAt stop applying at once and are removed by the retention pass.
+ */
+export const quarantineRoutes: FastifyPluginAsync = async (app) => {
+	// Auth guard for *all* routes in this plugin
+	app.addHook('preHandler', async (req) => {
+		requireAuth(req);
+	});
+
+	// Active entries, by name
+	app.get('/projects/:projectId/quarantine', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const items = await app.prisma.quarantinedTest.findMany({
+			where: {
+				projectId: project.id,
+				OR: [{ expiresAt: null }, { expiresAt: { gt: new Date() } }],
+			},
+			orderBy: { name: 'asc' },
+			select: quarantineSelect,
+		});
+
+		return { items };
+	});
+
+	// Quarantine a test by name; for a name already listed, the reason and
+	// expiry are replaced (200 instead of 201)
+	app.post('/projects/:projectId/quarantine', async (req, reply) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const body = parseJsonBody(req, QuarantineBody);
+
+		const expiresAt = body.expiresAt ? new Date(body.expiresAt) : null;
+		if (expiresAt && expiresAt.getTime() <= Date.now()) {
+			throw app.httpErrors.badRequest('expiresAt must be in the future');
+		}
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const where = {
+			projectId_name: { projectId: project.id, name: body.name },
+		};
+		const existing = await app.prisma.quarantinedTest.findUnique({
+			where,
+			select: { id: true },
+		});
+		const fields = { reason: body.reason ?? null, expiresAt };
+		const entry = await app.prisma.quarantinedTest.upsert({
+			where,
+			create: { projectId: project.id, name: body.name, ...fields },
+			update: fields,
+			select: quarantineSelect,
+		});
+
+		return reply.code(existing ? 200 : 201).send(entry);
+	});
+
+	// Release a test: its failures fail runs finished from now on
+	app.delete(
+		'/projects/:projectId/quarantine/:quarantineId',
+		async (req, reply) => {
+			const { projectId, quarantineId } = QuarantineParams.parse(req.params);
+
+			const { orgId } = getAuth(req);
+			const project = await requireProjectForOrg(app, projectId, orgId);
+
+			const { count } = await app.prisma.quarantinedTest.deleteMany({
+				where: { id: quarantineId, projectId: project.id },
+			});
+			if (!count) throw app.httpErrors.notFound('Quarantine entry not found');
+
+			return reply.code(204).send();
+		},
+	);
+};
@@ -1,9 +1,63 @@
-import type { FastifyPluginAsync } from 'fastify';
-import { z } from 'zod';
+import type { Readable } from 'node:stream';
+import type {
+	FastifyPluginAsync,
+	FastifyReply,
+	FastifyRequest,
+} from 'fastify';
 import type { Prisma } from '@prisma/client';
+import { z } from 'zod';
 import { requireRun } from '../lib/requireRun';
-import { requireAuth, getAuth } from '../lib/requireAuth';
+import { requireAuth, getAuth, requireApiKey } from '../lib/requireAuth';
 import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import {
+	UniqueConstraintError,
+	finishedStatus,
+	isOpenRun,
+	type ProjectRef,
+	type Repositories,
+	type RunStatus,
+} from '../repositories/types';
+import { ingestResults } from '../lib/ingestResults';
+import { parseJsonBody } from '../lib/jsonBody';
+import { decodeCursor, encodeCursor } from '../lib/cursor';
+import { compareRuns } from '../lib/compareRuns';
+import { etagMatches, jsonEtag } from '../lib/etag';
+import { runToJUnitXml } from '../lib/junitExport';
+import {
+	LabelError,
+	collectLabels,
+	parseLabelFilters,
+	type RunLabels,
+} from '../lib/runLabels';
+import {
+	EnvironmentError,
+	collectRunEnvironment,
+	parseEnvironmentFilters,
+	type RunEnvironment,
+} from '../lib/runEnvironment';
+import {
+	RunMetadataError,
+	collectRunMetadata,
+	parseCommitSha,
+	type RunMetadata,
+} from '../lib/runMetadata';
+import {
+	REPORT_CONTENT_TYPES,
+	REPORT_FORMATS,
+	ReportParseError,
+	parseReport,
+	reportFileFormat,
+	reportFormat,
+	type ParsedReport,
+	type ReportFormat,
+} from '../lib/reports';
+import {
+	MultipartError,
+	multipartBoundary,
+	readMultipartFiles,
+} from '../lib/multipart';
+import { transitionEvent } from '../lib/webhooks';
+import { requestBudgetMs } from '../lib/deadline';
 
 const ProjectParams = z.object({
 	projectId: z.string().min(1), // slug or db id
@@ -20,19 +74,92 @@ const ListRunsQuery = z.object({
 	status: z
 		.enum(['QUEUED', 'RUNNING', 'COMPLETED', 'FAILED', 'CANCELED'])
 		.optional(),
+	branch: z.string().min(1).optional(),
+	// Commit SHA or a prefix of one (at least 7 hex characters)
+	commit: z.string().optional(),
+	// key:value, repeatable (all must match)
+	label: z.union([z.string(), z.array(z.string())]).optional(),
+	// os|arch|runner|runtime:value, repeatable (all must match)
+	environment: z.union([z.string(), z.array(z.string())]).optional(),
+	order: z.enum(['asc', 'desc']).default('desc'),
 });
 
-const CreateRunBody = z.object({
+const RunFeedQuery = z.object({
+	limit: z.coerce.number().int().min(1).max(100).default(25),
+	cursor: z.string().optional(),
+	// Case-insensitive (?status=failed)
+	status: z
+		.string()
+		.transform((value) => value.toUpperCase())
+		.pipe(z.enum(['QUEUED', 'RUNNING', 'COMPLETED', 'FAILED', 'CANCELED']))
+		.optional(),
+});
+
+const CreateRunBody = z.strictObject({
 	source: z.string().optional(),
 	commitSha: z.string().optional(),
 	branch: z.string().optional(),
+	ciBuildUrl: z.string().optional(),
 	env: z.record(z.string(), z.unknown()).optional(),
+	environment: z.record(z.string(), z.unknown()).nullable().optional(),
 	meta: z.record(z.string(), z.unknown()).optional(),
+	labels: z.record(z.string(), z.unknown()).optional(),
 });
 
-const BatchResultsBody = z.object({
+const CompareRunsParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+	runId: z.string().min(1),
+	otherRunId: z.string().min(1),
+});
+
+const ReportRunQuery = z.object({
+	format: z.enum(REPORT_FORMATS).optional(),
+	source: z.string().optional(),
+	commitSha: z.string().optional(),
+	branch: z.string().optional(),
+	ciBuildUrl: z.string().optional(),
+});
+
+type ReportRunQuery = Omit<z.infer<typeof ReportRunQuery>, 'format'>;
+
+// Printable ASCII, as in the IETF Idempotency-Key draft's examples (UUIDs)
+const IDEMPOTENCY_KEY = /^[\x21-\x7e]{1,255}$/;
+
+// Transactions of a request are also cut to what is left of its deadline
+// (requestBudgetMs). Prisma's default for the short ones; whole reports can
+// hold thousands of cases (one upsert each)
+const TX_TIMEOUT_MS = 5_000;
+const REPORT_TX_TIMEOUT_MS = 60_000;
+
+// Retry-After for a report refused because the job queue is full
+const QUEUE_FULL_RETRY_AFTER_S = 5;
+
+/** RFC 7240 `Prefer: respond-async` (among other preferences). */
+function prefersAsync(req: FastifyRequest) {
+	const prefer = req.headers.prefer;
+	return (
+		typeof prefer === 'string' &&
+		prefer
+			.split(',')
+			.some((pref) => pref.split(';')[0].trim().toLowerCase() === 'respond-async')
+	);
+}
+
+/** Buffer one uploaded report; null once it grows past maxBytes. */
+async function readReportText(body: Readable, maxBytes: number) {
+	const chunks: Buffer[] = [];
+	let size = 0;
+	for await (const chunk of body) {
+		size += chunk.length;
+		if (size > maxBytes) return null;
+		chunks.push(chunk);
+	}
+	return Buffer.concat(chunks).toString('utf8');
+}
+
+const BatchResultsBody = z.strictObject({
 	results: z.array(
-		z.object({
+		z.strictObject({
 			externalId: z.string().min(1),
 			name: z.string().min(1),
 			status: z.enum(['PASSED', 'FAILED', 'SKIPPED', 'ERROR']),
@@ -55,6 +182,415 @@ export const runRoutes: FastifyPluginAsync = async (app) => {
 		requireAuth(req);
 	});
 
+	// JUnit XML / TAP reports (POST /projects/:projectId/runs); scoped to this
+	// plugin. Reports get their own size limit (larger than JSON bodies), so
+	// Fastify's default text/plain parser is replaced here too; over-limit
+	// bodies are a 413.
+	app.removeContentTypeParser('text/plain');
+	app.addContentTypeParser(
+		Object.keys(REPORT_CONTENT_TYPES),
+		{ parseAs: 'string', bodyLimit: app.config.REPORT_BODY_LIMIT_BYTES },
+		(_req, body, done) => done(null, body),
+	);
+	// Leave the body unread: the batch handler streams it from req.raw
+	app.addContentTypeParser('multipart/form-data', (_req, _payload, done) =>
+		done(null),
+	);
+
+	/** Body + X-Testhub-Label-* labels; invalid ones are a 400. */
+	function requestLabels(
+		req: FastifyRequest,
+		body?: Record<string, unknown>,
+	): RunLabels {
+		try {
+			return collectLabels(body, req.headers);
+		} catch (err) {
+			if (err instanceof LabelError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+	}
+
+	/** Body + X-Testhub-Env-* headers; invalid is a 400. */
+	function requestEnvironment(
+		req: FastifyRequest,
+		body?: Record<string, unknown>,
+	): RunEnvironment | undefined {
+		try {
+			return collectRunEnvironment(body, req.headers);
+		} catch (err) {
+			if (err instanceof EnvironmentError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+	}
+
+	/** Body/query + X-Testhub-Commit/-Branch/-Build-Url; invalid is a 400. */
+	function requestMetadata(
+		req: FastifyRequest,
+		fields: RunMetadata,
+	): RunMetadata {
+		try {
+			return collectRunMetadata(fields, req.headers);
+		} catch (err) {
+			if (err instanceof RunMetadataError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+	}
+
+	/** Report query with its run metadata validated (headers as fallback). */
+	function reportRunQuery(req: FastifyRequest) {
+		const { format, source, ...fields } = ReportRunQuery.parse(req.query);
+		const query: ReportRunQuery = {
+			source,
+			...requestMetadata(req, fields),
+		};
+		return { format, query };
+	}
+
+	/** The Idempotency-Key header (undefined when absent or disabled). */
+	function idempotencyKey(req: FastifyRequest) {
+		const header = req.headers['idempotency-key'];
+		if (header == null || app.config.IDEMPOTENCY_KEY_TTL === 0) return;
+		const key = Array.isArray(header) ? header[0] : header;
+		if (!IDEMPOTENCY_KEY.test(key)) {
+			throw app.httpErrors.badRequest(
+				'Invalid Idempotency-Key (1-255 printable ASCII characters)',
+			);
+		}
+		return key;
+	}
+
+	/**
+	 * Create a run in one transaction with `create`, claiming `key` for it.
+	 * When the key already names a run, including one a concurrent duplicate
+	 * just committed, nothing is created and that run is returned instead.
+	 */
+	async function createOnce<T extends { id: string }>(
+		project: ProjectRef,
+		key: string | undefined,
+		create: (repos: Repositories, tx: Prisma.TransactionClient) => Promise<T>,
+		opts?: { timeoutMs?: number },
+	) {
+		const replay = async () => {
+			if (!key) return null;
+			const runId = await app.repos.runs.findByIdempotencyKey(
+				project.id,
+				key,
+				app.clock.now(),
+			);
+			return runId ? requireRun(app, project.id, runId) : null;
+		};
+
+		const original = await replay();
+		if (original) return { created: null, replayed: original };
+		try {
+			const created = await app.withTx(async (repos, tx) => {
+				const run = await create(repos, tx);
+				if (key) {
+					const now = app.clock.now();
+					const ttl = app.config.IDEMPOTENCY_KEY_TTL;
+					await repos.runs.claimIdempotencyKey(
+						{
+							projectId: project.id,
+							key,
+							runId: run.id,
+							expiresAt: new Date(now.getTime() + ttl),
+						},
+						now,
+					);
+				}
+				return run;
+			}, opts);
+			return { created, replayed: null };
+		} catch (err) {
+			// Lost the race: the other request's run is the answer
+			const winner = err instanceof UniqueConstraintError && (await replay());
+			if (winner) return { created: null, replayed: winner };
+			throw err;
+		}
+	}
+
+	/** 200 with the run an earlier request with the same key created. */
+	function sendReplay(reply: FastifyReply, run: unknown) {
+		return reply.code(200).header('idempotent-replayed', 'true').send(run);
+	}
+
+	type ReportRunInput = {
+		project: ProjectRef;
+		format: ReportFormat;
+		report: ParsedReport;
+		query: ReportRunQuery;
+		labels: RunLabels;
+		environment?: RunEnvironment;
+		finishedAt: Date;
+	};
+
+	type StoredReportRun = Awaited<ReturnType<typeof finishReportRun>>;
+
+	/** The run row of a report, before its results are stored. */
+	function createReportRun(
+		{ runs }: Repositories,
+		input: ReportRunInput,
+		status: 'QUEUED' | 'RUNNING',
+	) {
+		const { project, format, report, query, labels, environment, finishedAt } =
+			input;
+		const startedAt =
+			report.durationMs != null
+				? new Date(finishedAt.getTime() - report.durationMs)
+				: undefined;
+
+		return runs.create({
+			projectId: project.id,
+			source: query.source ?? format,
+			commitSha: query.commitSha,
+			branch: query.branch,
+			ciBuildUrl: query.ciBuildUrl,
+			environment,
+			status,
+			startedAt,
+			warnings: report.warnings,
+			labels,
+		});
+	}
+
+	/** Store a report's results in its run and finish it (inside withTx). */
+	async function finishReportRun(
+		{ runs }: Repositories,
+		tx: Prisma.TransactionClient,
+		runId: string,
+		input: ReportRunInput,
+	) {
+		const { project, format, report, labels, environment, finishedAt } = input;
+		const counts = await ingestResults(
+			tx,
+			project.id,
+			runId,
+			report.results,
+			{ maxOutputBytes: app.config.REPORT_OUTPUT_MAX_BYTES },
+		);
+		const quarantined = await runs.markQuarantined(
+			project.id,
+			runId,
+			finishedAt,
+		);
+		const status = finishedStatus(counts.failed + counts.error, quarantined);
+		const summary = { ...counts, quarantined };
+
+		await runs.finish(runId, {
+			status,
+			finishedAt,
+			durationMs: report.durationMs,
+		});
+
+		return {
+			id: runId,
+			status,
+			format,
+			suites: report.suiteCount,
+			summary,
+			labels,
+			environment: environment ?? null,
+			warnings: report.warnings,
+		};
+	}
+
+	/** Create a finished run from a parsed report (inside withTx). */
+	async function storeReportRun(
+		repos: Repositories,
+		tx: Prisma.TransactionClient,
+		input: ReportRunInput,
+	) {
+		const run = await createReportRun(repos, input, 'RUNNING');
+		return finishReportRun(repos, tx, run.id, input);
+	}
+
+	/**
+	 * Background job for a queued report run: store the results and finish
+	 * the run, or mark it FAILED with a warning when that fails. A run
+	 * deleted (or otherwise no longer QUEUED) in the meantime is left alone.
+	 */
+	async function ingestQueuedReportRun(runId: string, input: ReportRunInput) {
+		let stored: StoredReportRun | null;
+		try {
+			stored = await app.withTx(async (repos, tx) => {
+				const status = await repos.runs.lockStatus(runId);
+				if (status !== 'QUEUED') return null;
+				return finishReportRun(repos, tx, runId, input);
+			}, { timeoutMs: REPORT_TX_TIMEOUT_MS });
+		} catch (err) {
+			app.log.error({ err, runId }, 'queued report ingest failed');
+			await app.repos.runs.failQueued(
+				runId,
+				'Storing the report failed; upload it again',
+				app.clock.now(),
+			);
+			return;
+		}
+		if (stored) await notifyReportRun(input.project, stored, input.query);
+	}
+
+	/**
+	 * Webhooks for a run that just finished, sent after commit so receivers
+	 * can fetch it: run.completed or run.failed, plus run.regressed /
+	 * run.recovered when the run flips the result of its branch (see
+	 * transitionEvent). Those carry `previousRun` as well. If looking up the
+	 * previous run fails, only the first event goes out.
+	 */
+	async function notifyRunFinished(
+		projectId: string,
+		run: { id: string; status: RunStatus },
+		data: Record<string, unknown>,
+	) {
+		app.dispatchWebhookEvent(
+			projectId,
+			run.status === 'FAILED' ? 'run.failed' : 'run.completed',
+			data,
+		);
+
+		let previous: { id: string; status: RunStatus } | null;
+		try {
+			previous = await app.repos.runs.previousFinishedOnBranch(
+				projectId,
+				run.id,
+			);
+		} catch (err) {
+			app.log.warn(
+				{ err, runId: run.id },
+				'previous run lookup failed; no regressed/recovered webhook',
+			);
+			return;
+		}
+		const transition = transitionEvent(previous?.status ?? null, run.status);
+		if (transition) {
+			app.dispatchWebhookEvent(projectId, transition, {
+				...data,
+				previousRun: previous,
+			});
+		}
+	}
+
+	function notifyReportRun(
+		project: ProjectRef,
+		created: StoredReportRun,
+		query: ReportRunQuery,
+	) {
+		return notifyRunFinished(project.id, created, {
+			project: { id: project.id, slug: project.slug },
+			run: {
+				id: created.id,
+				status: created.status,
+				...query,
+				labels: created.labels,
+			},
+			summary: created.summary,
+		});
+	}
+
+	async function ingestReportRun(
+		req: FastifyRequest,
+		reply: FastifyReply,
+		projectId: string,
+	) {
+		const { format: explicitFormat, query } = reportRunQuery(req);
+		const format = reportFormat(req.headers['content-type'], explicitFormat);
+		if (!format) {
+			throw app.httpErrors.unsupportedMediaType(
+				`Pass ?format=${REPORT_FORMATS.join('|')} for plain-text reports`,
+			);
+		}
+
+		const labels = requestLabels(req);
+		const environment = requestEnvironment(req);
+
+		let report: ParsedReport;
+		try {
+			report = parseReport(format, req.body as string);
+		} catch (err) {
+			if (err instanceof ReportParseError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const input: ReportRunInput = {
+			project,
+			format,
+			report,
+			query,
+			labels,
+			environment,
+			finishedAt: app.clock.now(),
+		};
+		if (prefersAsync(req)) return queueReportRun(req, reply, input);
+
+		const result = await createOnce(
+			project,
+			idempotencyKey(req),
+			(repos, tx) => storeReportRun(repos, tx, input),
+			{ timeoutMs: requestBudgetMs(req, REPORT_TX_TIMEOUT_MS) },
+		);
+		if (result.replayed) return sendReplay(reply, result.replayed);
+		await notifyReportRun(project, result.created, query);
+
+		return reply.code(201).send(result.created);
+	}
+
+	/**
+	 * `Prefer: respond-async`: create the run QUEUED and store its results
+	 * in a background job. 202 with the run's URL; 503 while the job queue
+	 * is full. The report was already parsed, so a bad one is still a 400.
+	 */
+	async function queueReportRun(
+		req: FastifyRequest,
+		reply: FastifyReply,
+		input: ReportRunInput,
+	) {
+		if (!app.jobs.hasCapacity()) {
+			reply.header('retry-after', String(QUEUE_FULL_RETRY_AFTER_S));
+			throw app.httpErrors.serviceUnavailable(
+				'Too many reports waiting to be stored; retry later',
+			);
+		}
+
+		const result = await createOnce(
+			input.project,
+			idempotencyKey(req),
+			(repos) => createReportRun(repos, input, 'QUEUED'),
+			{ timeoutMs: requestBudgetMs(req, TX_TIMEOUT_MS) },
+		);
+		if (result.replayed) return sendReplay(reply, result.replayed);
+
+		const runId = result.created.id;
+		const job = () => ingestQueuedReportRun(runId, input);
+		// Filled up since the check: store it now rather than strand the run
+		if (!app.jobs.tryEnqueue('report ingest', job)) await job();
+
+		const path = req.url.split('?', 1)[0];
+		return reply
+			.code(202)
+			.header('location', `${path}/${runId}`)
+			.send({
+				id: runId,
+				status: 'QUEUED',
+				format: input.format,
+				suites: input.report.suiteCount,
+				labels: input.labels,
+				environment: input.environment ?? null,
+				warnings: input.report.warnings,
+			});
+	}
+
 	// List runs
 	app.get('/projects/:projectId/runs', async (req) => {
 		const { projectId } = ProjectParams.parse(req.params);
@@ -63,48 +599,122 @@ export const runRoutes: FastifyPluginAsync = async (app) => {
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const where: Prisma.TestRunWhereInput = {
-			projectId: project.id,
-			...(query.status ? { status: query.status } : {}),
-		};
+		const cursor = query.cursor ? decodeCursor(query.cursor) : null;
+		if (query.cursor && !cursor) {
+			throw app.httpErrors.badRequest('Invalid cursor');
+		}
 
-		const runs = await app.prisma.testRun.findMany({
-			where,
-			orderBy: { createdAt: 'desc' },
-			take: query.limit,
-			...(query.cursor ? { skip: 1, cursor: { id: query.cursor } } : {}),
-			select: {
-				id: true,
-				createdAt: true,
-				status: true,
-				source: true,
-				commitSha: true,
-				branch: true,
-				startedAt: true,
-				finishedAt: true,
-				durationMs: true,
-				totalCount: true,
-				passedCount: true,
-				failedCount: true,
-				skippedCount: true,
-				errorCount: true,
-			},
+		let commit: string | undefined;
+		try {
+			commit = query.commit ? parseCommitSha(query.commit) : undefined;
+		} catch (err) {
+			if (err instanceof RunMetadataError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+
+		let labels: { key: string; value: string }[];
+		try {
+			labels = parseLabelFilters(query.label);
+		} catch (err) {
+			if (err instanceof LabelError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+
+		let environment: ReturnType<typeof parseEnvironmentFilters>;
+		try {
+			environment = parseEnvironmentFilters(query.environment);
+		} catch (err) {
+			if (err instanceof EnvironmentError) {
+				throw app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+
+		const { items, hasMore } = await app.repos.runs.list(project.id, {
+			status: query.status,
+			branch: query.branch,
+			commit,
+			labels,
+			environment,
+			after: cursor ?? undefined,
+			order: query.order,
+			limit: query.limit,
 		});
 
-		const nextCursor =
-			runs.length === query.limit ? runs[runs.length - 1]?.id : null;
+		const last = items[items.length - 1];
+		const nextCursor = hasMore && last ? encodeCursor(last) : null;
 
-		return { items: runs, nextCursor };
+		return { items, nextCursor };
 	});
 
-	// Run details
-	app.get('/projects/:projectId/runs/:runId', async (req) => {
+	// Runs of every project in the caller's org, newest first (e.g. a feed
+	// of recent failures with ?status=failed)
+	app.get('/runs', async (req) => {
+		const parsed = RunFeedQuery.safeParse(req.query);
+		if (!parsed.success) {
+			throw app.httpErrors.badRequest('Invalid query', {
+				errors: parsed.error.issues.map((issue) => ({
+					path: issue.path.join('.'),
+					message: issue.message,
+				})),
+			});
+		}
+		const query = parsed.data;
+
+		const cursor = query.cursor ? decodeCursor(query.cursor) : null;
+		if (query.cursor && !cursor) {
+			throw app.httpErrors.badRequest('Invalid cursor');
+		}
+
+		const { orgId } = getAuth(req);
+		const { items, hasMore } = await app.repos.runs.feed(orgId, {
+			status: query.status,
+			after: cursor ?? undefined,
+			limit: query.limit,
+		});
+
+		const last = items[items.length - 1];
+		const nextCursor = hasMore && last ? encodeCursor(last) : null;
+
+		return { items, nextCursor };
+	});
+
+	// Run details, with an ETag of the body so pollers can revalidate: a
+	// matching If-None-Match gets an empty 304.
+	app.get('/projects/:projectId/runs/:runId', async (req, reply) => {
 		const { projectId, runId } = RunIdParams.parse(req.params);
 
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		return requireRun(app, project.id, runId);
+		const run = await requireRun(app, project.id, runId);
+		const etag = jsonEtag(run);
+		// Revalidate on every use; private: the body is org data
+		reply.header('etag', etag).header('cache-control', 'private, no-cache');
+		if (etagMatches(req.headers['if-none-match'], etag)) {
+			return reply.code(304).send();
+		}
+		return run;
+	});
+
+	// Export a run as a JUnit XML report (e.g. for tools that only read JUnit)
+	app.get('/projects/:projectId/runs/:runId/junit.xml', async (req, reply) => {
+		const { projectId, runId } = RunIdParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+		const run = await requireRun(app, project.id, runId);
+
+		const results = await app.repos.runs.exportResults(runId);
+
+		return reply
+			.type('application/xml; charset=utf-8')
+			.header('content-disposition', `attachment; filename="${run.id}.xml"`)
+			.send(runToJUnitXml(run, results));
 	});
 
 	// List results for a run
@@ -117,134 +727,373 @@ export const runRoutes: FastifyPluginAsync = async (app) => {
 		// Ensure run belongs to project (throws 404 if not)
 		await requireRun(app, project.id, runId);
 
-		const results = await app.prisma.testResult.findMany({
-			where: { runId },
-			orderBy: { createdAt: 'asc' },
-			select: {
-				id: true,
-				status: true,
-				durationMs: true,
-				message: true,
-				createdAt: true,
-				testCase: {
-					select: {
-						id: true,
-						externalId: true,
-						name: true,
-						suiteName: true,
-						tags: true,
-					},
-				},
-			},
-		});
+		const results = await app.repos.runs.results(runId);
 
 		return { items: results };
 	});
 
-	// Create run
+	type ComparedRun = Awaited<ReturnType<typeof requireRun>>;
+
+	/** What changed from `base` to `head` (both runs of the project). */
+	async function compareRunPair(base: ComparedRun, head: ComparedRun) {
+		const [baseResults, headResults] = await Promise.all([
+			app.repos.runs.comparableResults(base.id),
+			app.repos.runs.comparableResults(head.id),
+		]);
+
+		const summary = (run: ComparedRun) => ({
+			id: run.id,
+			status: run.status,
+			createdAt: run.createdAt,
+			branch: run.branch,
+			commitSha: run.commitSha,
+			environment: run.environment,
+			totalCount: run.totalCount,
+		});
+
+		return {
+			base: summary(base),
+			head: summary(head),
+			...compareRuns(baseResults, headResults),
+		};
+	}
+
+	// Compare two runs: what changed from :runId (base) to :otherRunId (head)
+	app.get(
+		'/projects/:projectId/runs/:runId/compare/:otherRunId',
+		async (req) => {
+			const { projectId, runId, otherRunId } = CompareRunsParams.parse(
+				req.params,
+			);
+
+			const { orgId } = getAuth(req);
+			const project = await requireProjectForOrg(app, projectId, orgId);
+
+			const base = await requireRun(app, project.id, runId);
+			const otherProjectId = await app.repos.runs.projectIdOf(
+				orgId,
+				otherRunId,
+			);
+			if (!otherProjectId) {
+				throw app.httpErrors.notFound('Run not found');
+			}
+			if (otherProjectId !== project.id) {
+				throw app.httpErrors.badRequest(
+					'Runs belong to different projects and cannot be compared',
+				);
+			}
+			const head = await requireRun(app, project.id, otherRunId);
+
+			return compareRunPair(base, head);
+		},
+	);
+
+	// Compare :runId (head) with the previous finished run on its branch
+	// (base)
+	app.get('/projects/:projectId/runs/:runId/compare', async (req) => {
+		const { projectId, runId } = RunIdParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const head = await requireRun(app, project.id, runId);
+		if (!head.branch) {
+			throw app.httpErrors.badRequest(
+				'Run has no branch; pass the run to compare with (.../compare/:otherRunId)',
+			);
+		}
+		const baseId = await app.repos.runs.previousOnBranch(project.id, {
+			id: head.id,
+			createdAt: head.createdAt,
+			branch: head.branch,
+		});
+		if (!baseId) {
+			throw app.httpErrors.notFound(
+				`No earlier finished run on branch "${head.branch}"`,
+			);
+		}
+		const base = await requireRun(app, project.id, baseId);
+
+		return compareRunPair(base, head);
+	});
+
+	// Create run (JSON; no body = already RUNNING, for streamed results), or
+	// ingest a finished run from a JUnit XML/TAP report
 	app.post('/projects/:projectId/runs', async (req, reply) => {
 		const { projectId } = ProjectParams.parse(req.params);
-		const body = CreateRunBody.parse(req.body);
+		if (typeof req.body === 'string') {
+			return ingestReportRun(req, reply, projectId);
+		}
+		if (multipartBoundary(req.headers['content-type'])) {
+			throw app.httpErrors.unsupportedMediaType(
+				'Upload several reports to POST .../runs/batch',
+			);
+		}
+		const parsed = parseJsonBody(req, CreateRunBody, { optional: true });
+		const inProgress = parsed === undefined;
+		const body: z.infer<typeof CreateRunBody> = parsed ?? {};
+		const labels = requestLabels(req, body.labels);
+		const environment = requestEnvironment(
+			req,
+			body.environment ?? undefined,
+		);
+		const metadata = requestMetadata(req, body);
 
-		const { orgId } = getAuth(req);
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const created = await app.prisma.testRun.create({
-			data: {
+		const result = await createOnce(project, idempotencyKey(req), ({ runs }) =>
+			runs.create({
 				projectId: project.id,
 				source: body.source ?? 'manual',
-				commitSha: body.commitSha,
-				branch: body.branch,
-				env: body.env as Prisma.InputJsonValue | undefined,
-				meta: body.meta as Prisma.InputJsonValue | undefined,
-				status: 'QUEUED',
+				...metadata,
+				env: body.env,
+				environment,
+				meta: body.meta,
+				status: inProgress ? 'RUNNING' : 'QUEUED',
+				startedAt: inProgress ? app.clock.now() : undefined,
+				labels,
+			}),
+			{ timeoutMs: requestBudgetMs(req, TX_TIMEOUT_MS) },
+		);
+		if (result.replayed) return sendReplay(reply, result.replayed);
+
+		return reply
+			.code(201)
+			.send({ ...result.created, labels, environment: environment ?? null });
+	});
+
+	// Several JUnit XML/TAP reports (one file part each, e.g. every JUnit
+	// file of a monorepo build) as runs of the same commit/branch. All files
+	// are parsed first and stored in one transaction: a single bad file
+	// fails the whole batch with a 400 listing every parse error.
+	app.post('/projects/:projectId/runs/batch', async (req, reply) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const { format: explicitFormat, query } = reportRunQuery(req);
+
+		const maxBytes = app.config.REPORT_BATCH_MAX_BYTES;
+		const fileMaxBytes = app.config.REPORT_BODY_LIMIT_BYTES;
+		if (Number(req.headers['content-length']) > maxBytes) {
+			throw app.httpErrors.payloadTooLarge(
+				`batch exceeds the ${maxBytes} byte limit`,
+			);
+		}
+		const boundary = multipartBoundary(req.headers['content-type']);
+		if (!boundary) {
+			throw app.httpErrors.unsupportedMediaType(
+				'Expected a multipart/form-data upload',
+			);
+		}
+
+		const labels = requestLabels(req);
+		const environment = requestEnvironment(req);
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		let files: { filename: string; contentType: string; text: string }[];
+		try {
+			files = await readMultipartFiles(
+				req.raw,
+				boundary,
+				{
+					maxTotalBytes: maxBytes,
+					maxFiles: app.config.REPORT_BATCH_MAX_FILES,
+				},
+				async (part, body) => {
+					const text = await readReportText(body, fileMaxBytes);
+					if (text == null) {
+						throw app.httpErrors.payloadTooLarge(
+							`${part.filename} exceeds the ${fileMaxBytes} byte limit`,
+						);
+					}
+					return {
+						filename: part.filename,
+						contentType: part.contentType,
+						text,
+					};
+				},
+			);
+		} catch (err) {
+			if (err instanceof MultipartError) {
+				throw err.statusCode === 413
+					? app.httpErrors.payloadTooLarge(err.message)
+					: app.httpErrors.badRequest(err.message);
+			}
+			throw err;
+		}
+
+		const reports: {
+			filename: string;
+			format: ReportFormat;
+			report: ParsedReport;
+		}[] = [];
+		const errors: { filename: string; error: string }[] = [];
+		for (const file of files) {
+			const format = reportFileFormat(
+				file.contentType,
+				file.filename,
+				explicitFormat,
+			);
+			if (!format) {
+				errors.push({
+					filename: file.filename,
+					error: `unknown report format; pass ?format=${REPORT_FORMATS.join('|')} or use a .xml/.tap name`,
+				});
+				continue;
+			}
+			try {
+				reports.push({
+					filename: file.filename,
+					format,
+					report: parseReport(format, file.text),
+				});
+			} catch (err) {
+				if (!(err instanceof ReportParseError)) throw err;
+				errors.push({ filename: file.filename, error: err.message });
+			}
+		}
+		if (errors.length) {
+			throw app.httpErrors.badRequest(
+				`${errors.length} of ${files.length} report(s) could not be parsed; nothing was ingested`,
+				{ errors },
+			);
+		}
+
+		const finishedAt = app.clock.now();
+		const created = await app.withTx(
+			async (repos, tx) => {
+				const items = [];
+				for (const { filename, format, report } of reports) {
+					const run = await storeReportRun(repos, tx, {
+						project,
+						format,
+						report,
+						query,
+						labels,
+						environment,
+						finishedAt,
+					});
+					items.push({ filename, run });
+				}
+				return items;
 			},
-			select: { id: true, createdAt: true, status: true, projectId: true },
-		});
+			{ timeoutMs: requestBudgetMs(req, REPORT_TX_TIMEOUT_MS * 2) },
+		);
+		for (const { run } of created) {
+			await notifyReportRun(project, run, query);
+		}
 
-		return reply.code(201).send(created);
+		return reply.code(201).send({ items: created });
 	});
 
-	// Batch results (upserts TestCase + inserts TestResult)
-	app.post('/projects/:projectId/runs/:runId/results/batch', async (req) => {
+	/**
+	 * Append results to an open run (409 once it is finished); the first
+	 * append moves a QUEUED run to RUNNING.
+	 */
+	async function appendResults(req: FastifyRequest) {
 		const { projectId, runId } = RunIdParams.parse(req.params);
-		const body = BatchResultsBody.parse(req.body);
+		const body = parseJsonBody(req, BatchResultsBody);
 
-		const { orgId } = getAuth(req);
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
 		await requireRun(app, project.id, runId);
 
-		const created = await app.prisma.$transaction(
-			async (tx: Prisma.TransactionClient) => {
-				let passed = 0,
-					failed = 0,
-					skipped = 0,
-					error = 0;
-
-				for (const r of body.results) {
-					const tc = await tx.testCase.upsert({
-						where: {
-							projectId_externalId: {
-								projectId: project.id,
-								externalId: r.externalId,
-							},
-						},
-						update: {
-							name: r.name,
-							filePath: r.filePath,
-							suiteName: r.suiteName,
-							...(r.tags ? { tags: r.tags } : {}),
-						},
-						create: {
-							projectId: project.id,
-							externalId: r.externalId,
-							name: r.name,
-							filePath: r.filePath,
-							suiteName: r.suiteName,
-							tags: r.tags ?? [],
-						},
-						select: { id: true },
-					});
+		await app.withTx(async ({ runs }, tx) => {
+			// Locked so a concurrent /complete can't finish the run mid-append
+			const status = await runs.lockStatus(runId);
+			if (!status) throw app.httpErrors.notFound('Run not found');
+			if (!isOpenRun(status)) {
+				throw app.httpErrors.conflict(
+					`Run is already finished (${status}); results can no longer be added`,
+				);
+			}
+			await runs.start(runId, app.clock.now());
+			await ingestResults(tx, project.id, runId, body.results, {
+				maxOutputBytes: app.config.REPORT_OUTPUT_MAX_BYTES,
+			});
+		}, { timeoutMs: requestBudgetMs(req, TX_TIMEOUT_MS) });
 
-					await tx.testResult.create({
-						data: {
-							runId,
-							testCaseId: tc.id,
-							status: r.status,
-							durationMs: r.durationMs,
-							message: r.message,
-							stacktrace: r.stacktrace,
-							stdout: r.stdout,
-							stderr: r.stderr,
-							meta: (r.meta ?? undefined) as Prisma.InputJsonValue | undefined,
-						},
-					});
+		return { inserted: body.results.length };
+	}
 
-					if (r.status === 'PASSED') passed++;
-					else if (r.status === 'FAILED') failed++;
-					else if (r.status === 'SKIPPED') skipped++;
-					else error++;
-				}
+	// Batch results (upserts TestCase + inserts TestResult)
+	app.post('/projects/:projectId/runs/:runId/results/batch', appendResults);
 
-				const total = passed + failed + skipped + error;
-
-				await tx.testRun.update({
-					where: { id: runId },
-					data: {
-						totalCount: total,
-						passedCount: passed,
-						failedCount: failed,
-						skippedCount: skipped,
-						errorCount: error,
-					},
-				});
+	// Same, named for streaming: CI appends cases as tests finish
+	app.post('/projects/:projectId/runs/:runId/cases', appendResults);
 
-				return { inserted: body.results.length };
-			},
-		);
+	// Finish an open run: counts come from the stored results. Completing a
+	// finished run again returns it unchanged.
+	app.post('/projects/:projectId/runs/:runId/complete', async (req) => {
+		const { projectId, runId } = RunIdParams.parse(req.params);
 
-		return created;
+		const { orgId } = app.config.INGEST_REQUIRE_API_KEY
+			? requireApiKey(req)
+			: getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		await requireRun(app, project.id, runId);
+
+		const outcome = await app.withTx(async ({ runs }) => {
+			const status = await runs.lockStatus(runId);
+			if (!status) throw app.httpErrors.notFound('Run not found');
+			if (status === 'CANCELED') {
+				throw app.httpErrors.conflict('Run was canceled');
+			}
+			if (!isOpenRun(status)) return { finishedNow: false };
+
+			const counts = await runs.recount(runId);
+			const startedAt = (await runs.get(project.id, runId))?.startedAt;
+			const finishedAt = app.clock.now();
+			const quarantined = await runs.markQuarantined(
+				project.id,
+				runId,
+				finishedAt,
+			);
+			await runs.finish(runId, {
+				status: finishedStatus(
+					counts.failedCount + counts.errorCount,
+					quarantined,
+				),
+				finishedAt,
+				durationMs: startedAt
+					? finishedAt.getTime() - startedAt.getTime()
+					: undefined,
+			});
+			return { finishedNow: true };
+		}, { timeoutMs: requestBudgetMs(req, TX_TIMEOUT_MS) });
+
+		const run = await requireRun(app, project.id, runId);
+		if (outcome.finishedNow) {
+			await notifyRunFinished(project.id, run, {
+				project: { id: project.id, slug: project.slug },
+				run: {
+					id: run.id,
+					status: run.status,
+					source: run.source,
+					commitSha: run.commitSha,
+					branch: run.branch,
+					ciBuildUrl: run.ciBuildUrl,
+					labels: run.labels,
+				},
+				summary: {
+					total: run.totalCount,
+					passed: run.passedCount,
+					failed: run.failedCount,
+					skipped: run.skippedCount,
+					error: run.errorCount,
+					quarantined: run.quarantinedCount,
+				},
+			});
+		}
+		return run;
 	});
 
 	// --- DELETE RUN ---
@@ -257,10 +1106,9 @@ export const runRoutes: FastifyPluginAsync = async (app) => {
 		// Ensure run belongs to project (throws 404 if not)
 		const run = await requireRun(app, project.id, runId);
 
-		// Delete the run (cascade will remove test results)
-		await app.prisma.testRun.delete({
-			where: { id: run.id },
-		});
+		// Delete the run (cascade will remove test results and artifact rows)
+		const artifactKeys = await app.repos.runs.delete(run.id);
+		await app.removeArtifactBlobs(artifactKeys);
 
 		return reply.code(204).send();
 	});
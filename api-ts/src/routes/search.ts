@@ -3,6 +3,8 @@ import { z } from 'zod';
 import * as prismaPkg from '@prisma/client';
 import { requireAuth, getAuth } from '../lib/requireAuth';
 import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import { decodeCursor, encodeCursor } from '../lib/cursor';
+import { cancellableQuery } from '../lib/queryCancel';
 
 const { Prisma } = prismaPkg;
 
@@ -11,10 +13,17 @@ const ProjectParams = z.object({
 });
 
 const SearchQuery = z.object({
-	q: z.string().trim().min(1),
+	q: z.string().trim().default(''),
 	limit: z.coerce.number().int().min(1).max(25).default(5),
+	// Pages through tests only; runs come with the first page
+	cursor: z.string().optional(),
 });
 
+/** ILIKE pattern matching `value` as a literal substring. */
+function containsPattern(value: string) {
+	return `%${value.replace(/[\\%_]/g, '\\$&')}%`;
+}
+
 export const searchRoutes: FastifyPluginAsync = async (app) => {
 	// Auth guard for *all* routes in this plugin
 	app.addHook('preHandler', async (req) => {
@@ -25,11 +34,17 @@ export const searchRoutes: FastifyPluginAsync = async (app) => {
 	app.get('/projects/:projectId/search', async (req) => {
 		const { projectId } = ProjectParams.parse(req.params);
 		const query = SearchQuery.parse(req.query);
+		if (!query.q) throw app.httpErrors.badRequest('q must not be empty');
+
+		const cursor = query.cursor ? decodeCursor(query.cursor) : null;
+		if (query.cursor && !cursor) {
+			throw app.httpErrors.badRequest('Invalid cursor');
+		}
 
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		const qLike = `%${query.q}%`;
+		const qLike = containsPattern(query.q);
 		const qExact = query.q;
 		const qUpper = query.q.toUpperCase();
 		const statusMatch = [
@@ -42,71 +57,97 @@ export const searchRoutes: FastifyPluginAsync = async (app) => {
 			? qUpper
 			: undefined;
 
-		const tests = await app.prisma.$queryRaw<
-			Array<{
-				id: string;
-				externalId: string;
-				name: string;
-				suiteName: string | null;
-				lastStatus: string | null;
-				lastSeenAt: Date | null;
-			}>
-		>(Prisma.sql`
-			WITH latest AS (
-				SELECT DISTINCT ON (tr."testCaseId")
-					tr."testCaseId",
-					tr.status,
-					tr."createdAt" AS "lastSeenAt"
-				FROM "TestResult" tr
-				JOIN "TestRun" r ON r.id = tr."runId"
-				WHERE r."projectId" = ${project.id}
-				ORDER BY tr."testCaseId", tr."createdAt" DESC
+		// Match cases first (name/externalId/suiteName use the trigram indexes),
+		// then look up only their latest result, newest activity first. Keyset
+		// pages on (sortAt, id); one extra row tells whether there is more.
+		const after = cursor
+			? Prisma.sql`WHERE (sort_at, id) < (${cursor.createdAt}, ${cursor.id})`
+			: Prisma.empty;
+		type TestRow = {
+			id: string;
+			externalId: string;
+			name: string;
+			suiteName: string | null;
+			lastStatus: string | null;
+			lastSeenAt: Date | null;
+			sortAt: Date;
+		};
+		// Stopped in Postgres too if the client goes away (ILIKE scans)
+		const tests = await cancellableQuery(
+			app.db.replica(),
+			req.abortSignal,
+			(tx) => tx.$queryRaw<TestRow[]>(Prisma.sql`
+			WITH matches AS (
+				SELECT tc.id, tc."externalId", tc.name, tc."suiteName", tc."createdAt"
+				FROM "TestCase" tc
+				WHERE tc."projectId" = ${project.id}
+					AND (
+						tc.name ILIKE ${qLike}
+						OR tc."externalId" ILIKE ${qLike}
+						OR tc."suiteName" ILIKE ${qLike}
+						OR tc.tags @> ARRAY[${qExact}]::text[]
+						OR array_to_string(tc.tags, ',') ILIKE ${qLike}
+					)
+			), ranked AS (
+				SELECT
+					m.*,
+					latest.status AS "lastStatus",
+					latest."createdAt" AS "lastSeenAt",
+					COALESCE(latest."createdAt", m."createdAt") AS sort_at
+				FROM matches m
+				LEFT JOIN LATERAL (
+					SELECT tr.status, tr."createdAt"
+					FROM "TestResult" tr
+					WHERE tr."testCaseId" = m.id
+					ORDER BY tr."createdAt" DESC
+					LIMIT 1
+				) latest ON true
 			)
 			SELECT
-				tc.id,
-				tc."externalId",
-				tc.name,
-				tc."suiteName",
-				latest.status AS "lastStatus",
-				latest."lastSeenAt" AS "lastSeenAt"
-			FROM "TestCase" tc
-			LEFT JOIN latest ON latest."testCaseId" = tc.id
-			WHERE tc."projectId" = ${project.id}
-				AND (
-					tc.name ILIKE ${qLike}
-					OR tc."externalId" ILIKE ${qLike}
-					OR tc.tags @> ARRAY[${qExact}]::text[]
-					OR array_to_string(tc.tags, ',') ILIKE ${qLike}
-					OR COALESCE(tc."suiteName", '') ILIKE ${qLike}
-				)
-			ORDER BY COALESCE(latest."lastSeenAt", tc."createdAt") DESC
-			LIMIT ${query.limit}
-		`);
+				id,
+				"externalId",
+				name,
+				"suiteName",
+				"lastStatus",
+				"lastSeenAt",
+				sort_at AS "sortAt"
+			FROM ranked
+			${after}
+			ORDER BY sort_at DESC, id DESC
+			LIMIT ${query.limit + 1}
+		`),
+			{ timeoutMs: app.config.REQUEST_TIMEOUT },
+		);
+		const hasMore = tests.length > query.limit;
+		const page = tests.slice(0, query.limit);
+		const last = page[page.length - 1];
 
-		const runs = await app.prisma.testRun.findMany({
-			where: {
-				projectId: project.id,
-				OR: [
-					{ id: { contains: query.q, mode: 'insensitive' } },
-					{ branch: { contains: query.q, mode: 'insensitive' } },
-					{ commitSha: { contains: query.q, mode: 'insensitive' } },
-					{ source: { contains: query.q, mode: 'insensitive' } },
-					...(statusMatch ? [{ status: statusMatch as any }] : []),
-				],
-			},
-			orderBy: { createdAt: 'desc' },
-			take: query.limit,
-			select: {
-				id: true,
-				createdAt: true,
-				status: true,
-				branch: true,
-				commitSha: true,
-			},
-		});
+		const runs = cursor
+			? []
+			: await app.prisma.testRun.findMany({
+					where: {
+						projectId: project.id,
+						OR: [
+							{ id: { contains: query.q, mode: 'insensitive' } },
+							{ branch: { contains: query.q, mode: 'insensitive' } },
+							{ commitSha: { contains: query.q, mode: 'insensitive' } },
+							{ source: { contains: query.q, mode: 'insensitive' } },
+							...(statusMatch ? [{ status: statusMatch as any }] : []),
+						],
+					},
+					orderBy: { createdAt: 'desc' },
+					take: query.limit,
+					select: {
+						id: true,
+						createdAt: true,
+						status: true,
+						branch: true,
+						commitSha: true,
+					},
+				});
 
 		return {
-			tests: tests.map((t: (typeof tests)[number]) => ({
+			tests: page.map((t: (typeof tests)[number]) => ({
 				id: t.id,
 				externalId: t.externalId,
 				name: t.name,
@@ -121,6 +162,10 @@ export const searchRoutes: FastifyPluginAsync = async (app) => {
 				branch: r.branch ?? null,
 				commitSha: r.commitSha ?? null,
 			})),
+			nextCursor:
+				hasMore && last
+					? encodeCursor({ createdAt: last.sortAt, id: last.id })
+					: null,
 		};
 	});
 };
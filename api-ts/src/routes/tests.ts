@@ -2,6 +2,7 @@ import type { FastifyPluginAsync } from 'fastify';
 import { z } from 'zod';
 import { requireAuth, getAuth } from '../lib/requireAuth';
 import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import { looksLikeId } from '../lib/idOrSlug';
 
 const ProjectParams = z.object({
 	projectId: z.string().min(1), // slug or db id
@@ -19,9 +20,19 @@ const ListTestsQuery = z.object({
 	limit: z.coerce.number().int().min(1).max(200).default(100),
 });
 
-const HistoryQuery = z.object({
-	limit: z.coerce.number().int().min(1).max(200).default(50),
-});
+const HistoryQuery = z
+	.object({
+		limit: z.coerce.number().int().min(1).max(200).default(50),
+		// Narrows a by-name lookup when several suites share the test name
+		suite: z.string().trim().min(1).optional(),
+		from: z.coerce.date().optional(),
+		to: z.coerce.date().optional(),
+		order: z.enum(['asc', 'desc']).default('desc'),
+	})
+	.refine((q) => !q.from || !q.to || q.from <= q.to, {
+		message: '`from` must not be after `to`',
+		path: ['from'],
+	});
 
 export const testRoutes: FastifyPluginAsync = async (app) => {
 	// Auth guard for *all* routes in this plugin
@@ -108,7 +119,7 @@ export const testRoutes: FastifyPluginAsync = async (app) => {
 		};
 	});
 
-	// Execution history for a single test case
+	// Execution history for a single test case, addressed by id or by name
 	app.get('/projects/:projectId/tests/:testCaseId/history', async (req) => {
 		const { projectId, testCaseId } = TestCaseParams.parse(req.params);
 		const query = HistoryQuery.parse(req.query);
@@ -116,22 +127,45 @@ export const testRoutes: FastifyPluginAsync = async (app) => {
 		const { orgId } = getAuth(req);
 		const project = await requireProjectForOrg(app, projectId, orgId);
 
-		// Ensure testCase belongs to the project
-		const testCase = await app.prisma.testCase.findFirst({
-			where: { id: testCaseId, projectId: project.id },
-			select: { id: true },
-		});
-		if (!testCase) throw app.httpErrors.notFound('Test case not found');
+		// History tolerates replication lag; read it from the replica
+		const db = app.db.replica();
+
+		// Ensure testCase belongs to the project; otherwise treat the param as
+		// a test name (uses the projectId+name index). A name shared by several
+		// suites merges their histories unless ?suite= picks one.
+		const byId = looksLikeId(testCaseId)
+			? await db.testCase.findFirst({
+					where: { id: testCaseId, projectId: project.id },
+					select: { id: true },
+				})
+			: null;
+		const testCases = byId
+			? [byId]
+			: await db.testCase.findMany({
+					where: {
+						projectId: project.id,
+						name: testCaseId,
+						...(query.suite ? { suiteName: query.suite } : {}),
+					},
+					select: { id: true },
+				});
+		if (!testCases.length) {
+			throw app.httpErrors.notFound('Test case not found');
+		}
 
-		const results = await app.prisma.testResult.findMany({
+		// Served by the (testCaseId, createdAt) index
+		const results = await db.testResult.findMany({
 			where: {
-				testCaseId,
-				run: { projectId: project.id },
+				testCaseId: { in: testCases.map((tc: { id: string }) => tc.id) },
+				...(query.from || query.to
+					? { createdAt: { gte: query.from, lte: query.to } }
+					: {}),
 			},
-			orderBy: { createdAt: 'desc' },
+			orderBy: [{ createdAt: query.order }, { id: query.order }],
 			take: query.limit,
 			select: {
 				id: true,
+				testCaseId: true,
 				status: true,
 				durationMs: true,
 				createdAt: true,
@@ -150,6 +184,7 @@ export const testRoutes: FastifyPluginAsync = async (app) => {
 		return {
 			items: results.map((r: (typeof results)[number]) => ({
 				id: r.id,
+				testCaseId: r.testCaseId,
 				status: r.status,
 				durationMs: r.durationMs ?? null,
 				createdAt: r.createdAt.toISOString(),
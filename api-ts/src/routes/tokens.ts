@@ -0,0 +1,105 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { parseJsonBody } from '../lib/jsonBody';
+import { createProjectToken, TOKEN_SCOPES } from '../lib/projectTokens';
+import { requireAuth, getAuth } from '../lib/requireAuth';
+import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+
+const ProjectParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+});
+
+const TokenParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+	tokenId: z.string().min(1),
+});
+
+const CreateTokenBody = z.strictObject({
+	name: z.string().trim().min(1).max(200),
+	scopes: z.array(z.enum(TOKEN_SCOPES)).min(1),
+	// Omitted = until revoked
+	expiresAt: z.iso.datetime({ offset: true }).optional(),
+});
+
+const tokenSelect = {
+	id: true,
+	name: true,
+	prefix: true,
+	scopes: true,
+	createdAt: true,
+	lastUsedAt: true,
+	expiresAt: true,
+} as const;
+
+/**
+ * Project tokens: API keys that only work on one project's routes, with
+ * `ingest` (upload runs, results, artifacts) and/or `read` scopes. They
+ * are checked in the auth plugin; they can't manage tokens themselves.
+ */
+export const tokenRoutes: FastifyPluginAsync = async (app) => {
+	// Auth guard for *all* routes in this plugin
+	app.addHook('preHandler', async (req) => {
+		requireAuth(req);
+	});
+
+	// Tokens not revoked, newest first (the secret is never returned again)
+	app.get('/projects/:projectId/tokens', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const items = await app.prisma.projectToken.findMany({
+			where: { projectId: project.id, revokedAt: null },
+			orderBy: { createdAt: 'desc' },
+			select: tokenSelect,
+		});
+
+		return { items };
+	});
+
+	app.post('/projects/:projectId/tokens', async (req, reply) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const body = parseJsonBody(req, CreateTokenBody);
+
+		const expiresAt = body.expiresAt ? new Date(body.expiresAt) : null;
+		if (expiresAt && expiresAt.getTime() <= Date.now()) {
+			throw app.httpErrors.badRequest('expiresAt must be in the future');
+		}
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const { plainText, prefix, hash } = createProjectToken();
+		const created = await app.prisma.projectToken.create({
+			data: {
+				projectId: project.id,
+				name: body.name,
+				prefix,
+				hash,
+				scopes: [...new Set(body.scopes)],
+				expiresAt,
+			},
+			select: tokenSelect,
+		});
+
+		// The token itself is only shown here
+		return reply.code(201).send({ ...created, token: plainText });
+	});
+
+	// Revoke: the token is rejected from the next request on
+	app.delete('/projects/:projectId/tokens/:tokenId', async (req, reply) => {
+		const { projectId, tokenId } = TokenParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const { count } = await app.prisma.projectToken.updateMany({
+			where: { id: tokenId, projectId: project.id, revokedAt: null },
+			data: { revokedAt: new Date() },
+		});
+		if (!count) throw app.httpErrors.notFound('Token not found');
+
+		return reply.code(204).send();
+	});
+};
@@ -0,0 +1,47 @@
+import type { FastifyInstance, FastifyPluginAsync } from 'fastify';
+
+import { runRoutes } from './runs';
+import { projectRoutes } from './projects';
+import { testRoutes } from './tests';
+import { analyticsRoutes } from './analytics';
+import { searchRoutes } from './search';
+import { webhookRoutes } from './webhooks';
+import { artifactRoutes } from './artifacts';
+import { badgeRoutes } from './badge';
+import { quarantineRoutes } from './quarantine';
+import { tokenRoutes } from './tokens';
+
+/** Matches a leading /v1, /v2, ... segment. */
+export const API_VERSION_PREFIX = /^\/v\d+(?=\/|$)/;
+
+/**
+ * Mount `routes` under /<version>. Route plugins are written without the
+ * prefix (app.get('/projects')), so a future /v2 is a new entry here that
+ * reuses unchanged plugins and swaps the ones that changed.
+ */
+export function registerApiVersion(
+	app: FastifyInstance,
+	version: string,
+	routes: FastifyPluginAsync[],
+) {
+	app.register(
+		async (versioned) => {
+			for (const plugin of routes) versioned.register(plugin);
+		},
+		{ prefix: `/${version}` },
+	);
+}
+
+// Versioned application routes (health/version/auth stay at the root)
+export const v1Routes: FastifyPluginAsync[] = [
+	runRoutes,
+	projectRoutes,
+	testRoutes,
+	analyticsRoutes,
+	searchRoutes,
+	webhookRoutes,
+	artifactRoutes,
+	quarantineRoutes,
+	tokenRoutes,
+	badgeRoutes,
+];
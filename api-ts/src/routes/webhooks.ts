@@ -0,0 +1,94 @@
+import type { FastifyPluginAsync } from 'fastify';
+import { z } from 'zod';
+import { parseJsonBody } from '../lib/jsonBody';
+import { requireAuth, getAuth } from '../lib/requireAuth';
+import { requireProjectForOrg } from '../lib/requireProjectForOrg';
+import { generateWebhookSecret, WEBHOOK_EVENTS } from '../lib/webhooks';
+
+const ProjectParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+});
+
+const WebhookParams = z.object({
+	projectId: z.string().min(1), // slug or db id
+	webhookId: z.string().min(1),
+});
+
+const CreateWebhookBody = z.strictObject({
+	url: z
+		.string()
+		.url()
+		.refine((value) => /^https?:\/\//i.test(value), {
+			message: 'url must be http(s)',
+		}),
+	// Omitted = every event
+	events: z.array(z.enum(WEBHOOK_EVENTS)).min(1).optional(),
+});
+
+const webhookSelect = {
+	id: true,
+	url: true,
+	events: true,
+	createdAt: true,
+} as const;
+
+export const webhookRoutes: FastifyPluginAsync = async (app) => {
+	// Auth guard for *all* routes in this plugin
+	app.addHook('preHandler', async (req) => {
+		requireAuth(req);
+	});
+
+	// List subscriptions (secrets are never returned after creation)
+	app.get('/projects/:projectId/webhooks', async (req) => {
+		const { projectId } = ProjectParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const items = await app.prisma.webhook.findMany({
+			where: { projectId: project.id },
+			orderBy: { createdAt: 'desc' },
+			select: webhookSelect,
+		});
+
+		return { items };
+	});
+
+	// Subscribe a URL to run events
+	app.post('/projects/:projectId/webhooks', async (req, reply) => {
+		const { projectId } = ProjectParams.parse(req.params);
+		const body = parseJsonBody(req, CreateWebhookBody);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+		await app.checkWebhookUrl(body.url);
+
+		const secret = generateWebhookSecret();
+		const created = await app.prisma.webhook.create({
+			data: {
+				projectId: project.id,
+				url: body.url,
+				events: [...new Set(body.events ?? WEBHOOK_EVENTS)],
+				secret,
+			},
+			select: webhookSelect,
+		});
+
+		// The signing secret is only shown here
+		return reply.code(201).send({ ...created, secret });
+	});
+
+	app.delete('/projects/:projectId/webhooks/:webhookId', async (req, reply) => {
+		const { projectId, webhookId } = WebhookParams.parse(req.params);
+
+		const { orgId } = getAuth(req);
+		const project = await requireProjectForOrg(app, projectId, orgId);
+
+		const { count } = await app.prisma.webhook.deleteMany({
+			where: { id: webhookId, projectId: project.id },
+		});
+		if (!count) throw app.httpErrors.notFound('Webhook not found');
+
+		return reply.code(204).send();
+	});
+};
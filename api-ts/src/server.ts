@@ -1,110 +1,260 @@
-import Fastify from 'fastify';
-import sensible from '@fastify/sensible';
-import fp from 'fastify-plugin';
-import cookie from '@fastify/cookie';
-
-import { openapiContractPlugin } from './plugins/openapiContract';
-import { envPlugin } from './plugins/env';
-import { corsPlugin } from './plugins/cors';
-import { prismaPlugin } from './plugins/prisma';
-import { requestContextPlugin } from './plugins/requestContext';
-import { authPlugin } from './plugins/auth';
+import type { Server } from 'node:http';
+import type { AddressInfo } from 'node:net';
+import Fastify, { type FastifyServerOptions } from 'fastify';
+import {
+	ConfigError,
+	loadConfig,
+	redactConfig,
+	type AppConfig,
+} from './lib/config';
+import type { Clock } from './lib/clock';
+import { EnvFileError, loadRawEnv } from './lib/envFile';
+import {
+	buildLoggerOptions,
+	checkLogFile,
+	fatalExit,
+	flushLogs,
+	LogFileError,
+} from './lib/logger';
+import { genRequestId } from './lib/requestId';
+import { handleError } from './lib/problem';
+import { runMigrations } from './lib/migrate';
+import { serverTimeoutOptions } from './lib/serverTimeouts';
+import { loadTlsOptions, TlsConfigError, type TlsOptions } from './lib/tls';
+import { prepareSocketPath, removeSocketPath } from './lib/unixSocket';
+import { closeAdminServer, startAdminServer } from './plugins/adminListener';
+import {
+	defaultMiddleware,
+	registerMiddleware,
+	type Middleware,
+} from './plugins/stack';
 
 import { healthRoutes } from './routes/health';
-import { runRoutes } from './routes/runs';
-import { projectRoutes } from './routes/projects';
-import { testRoutes } from './routes/tests';
-import { analyticsRoutes } from './routes/analytics';
-import { searchRoutes } from './routes/search';
 import { authRoutes } from './routes/auth';
+import {
+	debugRoutes,
+	maintenanceRoutes,
+	runtimeStatsRoutes,
+} from './routes/debug';
+import { registerApiVersion, v1Routes } from './routes/versions';
 
-/**
- * Cookie plugin must run AFTER envPlugin
- * because it needs app.config.AUTH_COOKIE_SECRET
- */
-const authCookiePlugin = fp(async (app) => {
-	await app.register(cookie, {
-		secret: app.config.AUTH_COOKIE_SECRET,
-		parseOptions: {
-			httpOnly: true,
-		},
-	});
-});
+export type BuildAppOptions = {
+	/** Replaces the default plugin stack (see plugins/stack.ts). */
+	middleware?: Middleware[];
+	/** For the default stack; e.g. a FakeClock in a script. */
+	clock?: Clock;
+};
 
-export function buildApp() {
-	const app = Fastify({ logger: true });
+export function buildApp(
+	config: AppConfig,
+	tls: TlsOptions | null = null,
+	opts: BuildAppOptions = {},
+) {
+	const options: FastifyServerOptions & { https?: TlsOptions } = {
+		logger: buildLoggerOptions(config),
+		bodyLimit: config.BODY_LIMIT_BYTES,
+		...serverTimeoutOptions(config),
+		// Replaced by requestLoggingPlugin (one line per request, skip list)
+		disableRequestLogging: true,
+		// X-Request-ID is read (and validated) by genRequestId instead
+		requestIdHeader: false,
+		genReqId: genRequestId,
+		// Same trust as clientIp(): every peer, the listed ones, or none
+		trustProxy:
+			config.TRUST_PROXY ||
+			(config.TRUSTED_PROXIES.length ? config.TRUSTED_PROXIES : false),
+		// DB connect retries can outlast avvio's 10s default; startup is
+		// bounded by TESTHUB_DB_CONNECT_ATTEMPTS instead
+		pluginTimeout: 0,
+	};
+	// With cert/key set Fastify creates an https.Server instead
+	if (tls) options.https = tls;
 
-	// Core / cross-cutting
-	app.register(envPlugin);
-	app.register(sensible);
+	const app = Fastify(options);
 
-	// OpenAPI contract + /docs + request validation
-	app.register(openapiContractPlugin);
+	// Cross-cutting plugins, in order (see plugins/stack.ts)
+	registerMiddleware(
+		app,
+		opts.middleware ?? defaultMiddleware(config, opts.clock),
+	);
 
-	// Needs envPlugin (WEB_APP_URL)
-	app.register(corsPlugin);
+	// Unversioned: probes/build info, and auth (OAuth callback URLs are
+	// registered with GitHub, cookies are host-wide)
+	app.register(healthRoutes);
+	app.register(authRoutes);
 
-	// Cookie parsing/signing for session auth
-	app.register(authCookiePlugin);
+	// Application API
+	registerApiVersion(app, 'v1', v1Routes);
 
-	// DB + request context + auth
-	app.register(prismaPlugin);
-	app.register(requestContextPlugin);
-	app.register(authPlugin);
+	if (config.TESTHUB_ENABLE_PPROF) {
+		app.register(debugRoutes);
+	}
+	if (config.TESTHUB_ADMIN_PORT) {
+		app.register(runtimeStatsRoutes);
+		app.register(maintenanceRoutes);
+	}
 
-	// Routes
-	app.register(healthRoutes);
-	app.register(runRoutes);
-	app.register(projectRoutes);
-	app.register(testRoutes);
-	app.register(analyticsRoutes);
-	app.register(searchRoutes);
-	app.register(authRoutes);
+	// Central error handler (also the recovery path for anything a handler throws)
+	app.setErrorHandler(handleError);
+
+	return app;
+}
+
+/**
+ * Run a startup step that reads config files; before Fastify exists, so
+ * problems (bad config, env file, TLS files or LOG_FILE) are printed to
+ * stderr and the process exits 1.
+ */
+function orExit<T>(load: () => T): T {
+	try {
+		return load();
+	} catch (err) {
+		if (
+			err instanceof ConfigError ||
+			err instanceof EnvFileError ||
+			err instanceof TlsConfigError ||
+			err instanceof LogFileError
+		) {
+			console.error(err.message);
+			process.exit(1);
+		}
+		throw err;
+	}
+}
 
-	// Central error handler
-	app.setErrorHandler((err, _req, reply) => {
-		const anyErr = err as any;
-
-		const statusCode =
-			typeof anyErr.statusCode === 'number' && anyErr.statusCode >= 400
-				? anyErr.statusCode
-				: 500;
-
-		const details =
-			anyErr.cause ?? anyErr.errors ?? anyErr.validation ?? undefined;
-
-		const message =
-			typeof anyErr.message === 'string'
-				? anyErr.message
-				: statusCode >= 500
-					? 'Internal Server Error'
-					: 'Bad Request';
-
-		const errorName =
-			typeof anyErr.name === 'string'
-				? anyErr.name
-				: statusCode >= 500
-					? 'Internal Server Error'
-					: 'Bad Request';
-
-		reply.status(statusCode).send({
-			statusCode,
-			error: errorName,
-			message,
-			...(details ? { details } : {}),
-		});
+/**
+ * Read .env (or TESTHUB_ENV_FILE) + process env and validate it, load the
+ * TLS cert/key if configured and check that LOG_FILE can be opened.
+ */
+function loadStartupConfig(): { config: AppConfig; tls: TlsOptions | null } {
+	return orExit(() => {
+		const config = loadConfig(loadRawEnv());
+		checkLogFile(config);
+		return { config, tls: loadTlsOptions(config) };
 	});
+}
 
-	return app;
+/**
+ * --print-config: the config the server would run with, after defaults,
+ * the env file and process env, as JSON on stdout with secrets redacted.
+ * Nothing is opened (no TLS files, no DB); invalid config fails as usual.
+ */
+function printConfig() {
+	const config = orExit(() => loadConfig(loadRawEnv()));
+	process.stdout.write(`${JSON.stringify(redactConfig(config), null, 2)}\n`);
 }
 
 async function main() {
-	const app = buildApp();
+	if (process.argv.includes('--print-config')) {
+		printConfig();
+		return;
+	}
+
+	const { config, tls } = loadStartupConfig();
+	const app = buildApp(config, tls);
+
+	// --migrate-only: apply migrations and exit (deploy pipelines)
+	if (process.argv.includes('--migrate-only')) {
+		try {
+			await runMigrations(config.DATABASE_URL, app.log);
+		} catch (err) {
+			await fatalExit(app.log, err, 'database migration failed');
+			return;
+		}
+		await flushLogs();
+		process.exit(0);
+	}
+
+	const socketPath = config.TESTHUB_API_SOCKET;
+	let adminServer: Server | null = null;
+
+	try {
+		// Before app.ready(): prismaPlugin refuses to start on an old schema
+		if (config.MIGRATE_ON_STARTUP) {
+			await runMigrations(config.DATABASE_URL, app.log);
+		}
+
+		await app.ready();
+
+		app.server.headersTimeout = app.config.HEADERS_TIMEOUT;
+
+		if (socketPath) {
+			await prepareSocketPath(socketPath);
+			// Access is controlled by the directory the socket lives in
+			await app.listen({
+				path: socketPath,
+				readableAll: true,
+				writableAll: true,
+			});
+		} else {
+			const host = '0.0.0.0';
+			await app.listen({ port: app.config.PORT, host });
+			// The bound port, which differs from PORT when that is 0
+			const { port } = app.server.address() as AddressInfo;
+			app.log.info({ host, port }, 'api listener started');
+		}
+		if (app.config.TESTHUB_ADMIN_PORT) {
+			adminServer = await startAdminServer(app);
+		}
+	} catch (err) {
+		await fatalExit(app.log, err, 'server failed to start');
+		return;
+	}
+
+	// Graceful shutdown (HTTP and HTTPS alike):
+	// 1. SIGTERM: fail /ready and keep serving for SHUTDOWN_DRAIN_DELAY so the
+	//    load balancer stops routing here (SIGINT / Ctrl-C skips the wait)
+	// 2. stop accepting connections (admin listener too), let in-flight
+	//    requests finish
+	// 3. run onClose hooks (DB pools closed) and exit; if 2-3 outlast
+	//    SHUTDOWN_TIMEOUT, close the pools anyway and exit 1
+	// 4. flush the log destination, so the last lines aren't lost
+	const shutdown = async (signal: NodeJS.Signals) => {
+		app.markNotReady();
+		const drainMs =
+			signal === 'SIGTERM' ? app.config.SHUTDOWN_DRAIN_DELAY : 0;
+		app.log.info({ signal, drainMs }, 'shutdown: marked not ready');
+		if (drainMs > 0) {
+			await new Promise((resolve) => setTimeout(resolve, drainMs));
+		}
 
-	await app.ready();
+		app.log.info('shutdown: closing server, draining in-flight requests');
+		const closed = (async () => {
+			// Admin listener first: it routes into the app being closed
+			if (adminServer) await closeAdminServer(adminServer);
+			await app.close();
+			return true;
+		})();
+		const timeoutMs = app.config.SHUTDOWN_TIMEOUT;
+		const finished =
+			timeoutMs > 0
+				? await Promise.race([
+						closed,
+						new Promise<false>((resolve) =>
+							setTimeout(() => resolve(false), timeoutMs).unref(),
+						),
+					])
+				: await closed;
+		if (socketPath) removeSocketPath(socketPath);
 
-	const port = app.config.PORT;
-	await app.listen({ port, host: '0.0.0.0' });
+		if (!finished) {
+			// Requests still running; don't leave their connections to the DB
+			app.log.warn({ timeoutMs }, 'shutdown: drain timed out');
+			await app.closeDbPools();
+			await flushLogs();
+			process.exit(1);
+		}
+		app.log.info('shutdown: complete');
+		await flushLogs();
+		process.exit(0);
+	};
+	const onSignal = (signal: NodeJS.Signals) => {
+		shutdown(signal).catch((err) =>
+			fatalExit(app.log, err, 'shutdown failed'),
+		);
+	};
+	process.once('SIGTERM', onSignal);
+	process.once('SIGINT', onSignal);
 }
 
 main().catch((err) => {
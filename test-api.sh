@@ -6,6 +6,8 @@
 
 API_KEY="${API_KEY:-your-api-key-here}"
 BASE_URL="http://localhost:8080"
+# Application endpoints are versioned; probes and /version stay at the root
+API_URL="$BASE_URL/v1"
 
 echo "🧪 Testing Testhub API CRUD Operations"
 echo "========================================"
@@ -38,17 +40,152 @@ curl -s -w "\nStatus: %{http_code}\n" \
   "$BASE_URL/health"
 success_msg "Health check"
 
+# 1b. Uptime increases between two /health calls
+test_endpoint "1b. GET /health - uptime_seconds increases"
+UPTIME_1=$(curl -s "$BASE_URL/health" | grep -o '"uptime_seconds":[0-9.]*' | cut -d: -f2)
+sleep 1
+UPTIME_2=$(curl -s "$BASE_URL/health" | grep -o '"uptime_seconds":[0-9.]*' | cut -d: -f2)
+echo "uptime_seconds: $UPTIME_1 -> $UPTIME_2"
+if [ -n "$UPTIME_1" ] && [ -n "$UPTIME_2" ] && awk "BEGIN { exit !($UPTIME_2 > $UPTIME_1) }"; then
+  success_msg "Uptime increases"
+else
+  error_msg "Uptime did not increase"
+fi
+
 # 2. Ready Check (no auth required)
 test_endpoint "2. GET /ready - Readiness check (no auth)"
 curl -s -w "\nStatus: %{http_code}\n" \
   "$BASE_URL/ready"
 success_msg "Ready check"
 
+# 2a. Kubernetes-style probe names answer like /health and /ready
+test_endpoint "2a. GET /livez and /readyz"
+LIVEZ_STATUS=$(curl -s -o /dev/null -w "%{http_code}" "$BASE_URL/livez")
+READYZ_STATUS=$(curl -s -o /dev/null -w "%{http_code}" "$BASE_URL/readyz")
+echo "/livez: $LIVEZ_STATUS, /readyz: $READYZ_STATUS"
+if [ "$LIVEZ_STATUS" = "200" ] && [ "$READYZ_STATUS" = "200" ]; then
+  success_msg "Probe aliases"
+else
+  error_msg "Probe aliases"
+fi
+
+# 2a2. HEAD on the GET probes: same status and Content-Length as GET, no body
+test_endpoint "2a2. HEAD /health, /ready, /version - Headers only"
+HEAD_OK=true
+for path in /health /ready /version; do
+  HEAD_HEADERS=$(mktemp)
+  HEAD_BODY=$(mktemp)
+  HEAD_STATUS=$(curl -s --head -D "$HEAD_HEADERS" -o "$HEAD_BODY" -w "%{http_code}" "$BASE_URL$path")
+  HEAD_LENGTH=$(grep -i '^content-length:' "$HEAD_HEADERS" | cut -d' ' -f2 | tr -d '\r')
+  GET_LENGTH=$(curl -s -o /dev/null -w "%{size_download}" "$BASE_URL$path")
+  echo "HEAD $path: $HEAD_STATUS, content-length $HEAD_LENGTH (GET body $GET_LENGTH bytes)"
+  if [ "$HEAD_STATUS" != "200" ] || [ -s "$HEAD_BODY" ] || [ -z "$HEAD_LENGTH" ]; then
+    HEAD_OK=false
+  fi
+  # /health carries a changing uptime, so only /version is compared exactly
+  if [ "$path" = "/version" ] && [ "$HEAD_LENGTH" != "$GET_LENGTH" ]; then
+    HEAD_OK=false
+  fi
+  rm -f "$HEAD_HEADERS" "$HEAD_BODY"
+done
+if [ "$HEAD_OK" = "true" ]; then
+  success_msg "HEAD on GET routes"
+else
+  error_msg "HEAD on GET routes"
+fi
+
+# 2b. Version (no auth required)
+test_endpoint "2b. GET /version - Build info (no auth)"
+curl -s -w "\nStatus: %{http_code}\n" \
+  "$BASE_URL/version"
+success_msg "Version"
+
+# 2b2. Spec derived from the registered routes (no auth required), cacheable:
+# its Last-Modified gives a 304
+test_endpoint "2b2. GET /openapi.json - Served routes spec"
+SPEC_HEADERS=$(mktemp)
+SPEC_BODY=$(curl -s -D "$SPEC_HEADERS" "$BASE_URL/openapi.json")
+echo "$SPEC_BODY" | head -c 200; echo
+SPEC_MODIFIED=$(grep -i '^last-modified:' "$SPEC_HEADERS" | cut -d' ' -f2- | tr -d '\r')
+SPEC_304=$(curl -s -o /dev/null -w "%{http_code}" -H "If-Modified-Since: $SPEC_MODIFIED" \
+  "$BASE_URL/openapi.json")
+echo "last-modified: $SPEC_MODIFIED, revalidated: $SPEC_304"
+if echo "$SPEC_BODY" | grep -q '"openapi":"3' &&
+  echo "$SPEC_BODY" | grep -q '"/projects/{projectId}/runs"' &&
+  echo "$SPEC_BODY" | grep -q '"operationId":"getOpenApiSpec"' &&
+  grep -qi '^cache-control: public' "$SPEC_HEADERS" &&
+  [ "$SPEC_304" = "304" ]; then
+  success_msg "OpenAPI spec"
+else
+  error_msg "OpenAPI spec"
+fi
+rm -f "$SPEC_HEADERS"
+
+# 2c. Versioned routing: /v1 works, unknown versions and unprefixed paths 404
+test_endpoint "2c. GET /v1/projects/ping vs /v2/projects/ping"
+V1_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" "$API_URL/projects/ping")
+V2_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" "$BASE_URL/v2/projects/ping")
+echo "/v1: $V1_STATUS, /v2: $V2_STATUS"
+if [ "$V1_STATUS" = "200" ] && [ "$V2_STATUS" = "404" ]; then
+  success_msg "API versioning"
+else
+  error_msg "API versioning"
+fi
+
+# 2d. 404 for unknown paths, 405 + Allow for a wrong method
+test_endpoint "2d. GET /nope (404) and PUT /health (405)"
+curl -s -w "\nStatus: %{http_code}\n" "$BASE_URL/nope"
+curl -s -i -X PUT "$BASE_URL/health" | grep -i "^HTTP\|^allow"
+success_msg "Not found / method not allowed"
+
+# 2d2. Errors are problem+json (RFC 7807)
+test_endpoint "2d2. GET /nope - problem+json body"
+PROBLEM_CT=$(curl -s -o /dev/null -w "%{content_type}" "$BASE_URL/nope")
+PROBLEM_BODY=$(curl -s "$BASE_URL/nope")
+echo "Content-Type: $PROBLEM_CT"
+echo "$PROBLEM_BODY"
+if [[ "$PROBLEM_CT" == application/problem+json* ]] &&
+  echo "$PROBLEM_BODY" | grep -q '"type":"about:blank"' &&
+  echo "$PROBLEM_BODY" | grep -q '"title":"Not Found","status":404,"detail":"'; then
+  success_msg "Problem details"
+else
+  error_msg "Problem details"
+fi
+
+# 2d3. Middleware order: the request ID is assigned before routing, so even
+# a 404 from the not-found handler echoes the caller's X-Request-ID
+test_endpoint "2d3. GET /nope - X-Request-ID echoed on errors"
+ECHOED_ID=$(curl -s -o /dev/null -D - -H "X-Request-ID: smoke-order-check" "$BASE_URL/nope" \
+  | grep -i "^x-request-id" | tr -d '\r' | cut -d' ' -f2)
+echo "X-Request-ID: $ECHOED_ID"
+if [ "$ECHOED_ID" = "smoke-order-check" ]; then
+  success_msg "Request ID survives the error path"
+else
+  error_msg "Request ID not echoed"
+fi
+
+# 2d4. Heap snapshots (every secret in memory) are never served on the
+# public port: absent without TESTHUB_ENABLE_PPROF, admin-listener-only with it
+test_endpoint "2d4. GET /debug/pprof/heap - not on the public port (expect 404)"
+HEAP_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" "$BASE_URL/debug/pprof/heap")
+echo "Status: $HEAP_STATUS"
+if [ "$HEAP_STATUS" = "404" ]; then
+  success_msg "Heap snapshot not reachable on PORT"
+else
+  error_msg "Heap snapshot answered $HEAP_STATUS on PORT"
+fi
+
+# 2e. gzip: tiny bodies stay uncompressed, large ones (project list) are gzipped
+test_endpoint "2e. Accept-Encoding: gzip on /health (small) and /projects"
+curl -s -o /dev/null -D - -H "Accept-Encoding: gzip" "$BASE_URL/health" | grep -i "^content-encoding" || echo "/health: not compressed"
+curl -s -o /dev/null -D - -H "Accept-Encoding: gzip" -H "x-api-key: $API_KEY" "$API_URL/projects" | grep -i "^content-encoding" || echo "/projects: not compressed (body below COMPRESSION_MIN_BYTES?)"
+success_msg "Compression"
+
 # 3. List Projects (empty initially)
 test_endpoint "3. GET /projects - List projects"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects"
+  "$API_URL/projects"
 success_msg "List projects"
 
 # 4. Create Project
@@ -61,7 +198,7 @@ PROJECT_RESPONSE=$(curl -s -w "\nHTTP_STATUS:%{http_code}" \
     "name": "Test Project",
     "slug": "test-project-'$(date +%s)'"
   }' \
-  "$BASE_URL/projects")
+  "$API_URL/projects")
 
 PROJECT_BODY=$(echo "$PROJECT_RESPONSE" | sed '$d')
 STATUS_CODE=$(echo "$PROJECT_RESPONSE" | grep "HTTP_STATUS:" | cut -d':' -f2)
@@ -82,14 +219,14 @@ fi
 test_endpoint "5. GET /projects/{projectId} - Get project by ID"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID"
+  "$API_URL/projects/$PROJECT_ID"
 success_msg "Get project by ID"
 
 # 6. Get Project by Slug
 test_endpoint "6. GET /projects/{projectSlug} - Get project by slug"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_SLUG"
+  "$API_URL/projects/$PROJECT_SLUG"
 success_msg "Get project by slug"
 
 # 7. Update Project
@@ -101,22 +238,150 @@ curl -s -w "\nStatus: %{http_code}\n" \
   -d '{
     "name": "Updated Test Project"
   }' \
-  "$BASE_URL/projects/$PROJECT_ID"
+  "$API_URL/projects/$PROJECT_ID"
 success_msg "Update project"
 
+# 7b. Retention policy: set, then clear with null
+test_endpoint "7b. PATCH /projects/{projectId} - Retention policy"
+RETENTION_BODY=$(curl -s \
+  -X PATCH \
+  -H "x-api-key: $API_KEY" \
+  -H "Content-Type: application/json" \
+  -d '{"retentionMaxRuns": 500, "retentionDays": 90}' \
+  "$API_URL/projects/$PROJECT_ID")
+CLEARED_BODY=$(curl -s \
+  -X PATCH \
+  -H "x-api-key: $API_KEY" \
+  -H "Content-Type: application/json" \
+  -d '{"retentionMaxRuns": null, "retentionDays": null}' \
+  "$API_URL/projects/$PROJECT_ID")
+echo "$RETENTION_BODY"
+if echo "$RETENTION_BODY" | grep -q '"retentionMaxRuns":500' \
+  && echo "$CLEARED_BODY" | grep -q '"retentionDays":null'; then
+  success_msg "Retention policy set and cleared"
+else
+  error_msg "Retention policy not applied"
+fi
+
+# 7c. JSON bodies: unknown fields and trailing garbage are 400s, a body that
+# isn't sent as application/json is a 415
+test_endpoint "7c. PATCH /projects/{projectId} - Body validation"
+UNKNOWN_FIELD_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"name": "Updated Test Project", "colour": "red"}' \
+  "$API_URL/projects/$PROJECT_ID")
+TRAILING_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"name": "Updated Test Project"} trailing' \
+  "$API_URL/projects/$PROJECT_ID")
+TEXT_BODY_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH \
+  -H "x-api-key: $API_KEY" -H "Content-Type: text/plain" \
+  -d '{"name": "Updated Test Project"}' \
+  "$API_URL/projects/$PROJECT_ID")
+echo "unknown field: $UNKNOWN_FIELD_STATUS, trailing garbage: $TRAILING_STATUS, text/plain: $TEXT_BODY_STATUS"
+if [ "$UNKNOWN_FIELD_STATUS" = "400" ] && [ "$TRAILING_STATUS" = "400" ] \
+  && [ "$TEXT_BODY_STATUS" = "415" ]; then
+  success_msg "JSON body validation"
+else
+  error_msg "JSON body validation"
+fi
+
 # 8. List Runs (empty initially)
 test_endpoint "8. GET /projects/{projectId}/runs - List runs"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs"
+  "$API_URL/projects/$PROJECT_ID/runs"
 success_msg "List runs (empty)"
 
+# 8b. Webhook subscriptions: create (secret returned once), list, delete
+test_endpoint "8b. POST/GET/DELETE /projects/{projectId}/webhooks - Webhooks"
+WEBHOOK_BODY=$(curl -s \
+  -X POST \
+  -H "x-api-key: $API_KEY" \
+  -H "Content-Type: application/json" \
+  -d '{"url": "https://example.com/testhub-hook", "events": ["run.failed", "run.regressed"]}' \
+  "$API_URL/projects/$PROJECT_ID/webhooks")
+echo "$WEBHOOK_BODY"
+WEBHOOK_ID=$(echo "$WEBHOOK_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+LISTED_SECRET=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/webhooks" | grep -c '"secret"')
+WEBHOOK_DELETE_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/webhooks/$WEBHOOK_ID")
+echo "secret in list: $LISTED_SECRET, delete: $WEBHOOK_DELETE_STATUS"
+if echo "$WEBHOOK_BODY" | grep -q '"secret":"whsec_' && [ "$LISTED_SECRET" = "0" ] \
+  && echo "$WEBHOOK_BODY" | grep -q '"run.regressed"' \
+  && [ "$WEBHOOK_DELETE_STATUS" = "204" ]; then
+  success_msg "Webhook subscriptions"
+else
+  error_msg "Webhook create/list/delete did not behave as expected"
+fi
+
+# 8b1. Webhook URLs pointing inside (this host, the cluster, cloud
+# metadata) are refused unless WEBHOOK_ALLOWED_NETWORKS lists them
+test_endpoint "8b1. POST /projects/{projectId}/webhooks - Internal URLs (expect 400)"
+INTERNAL_HOOK_STATUSES=""
+for HOOK_URL in "http://127.0.0.1:8080/hook" "http://localhost/hook" \
+  "http://169.254.169.254/latest/meta-data" "http://[::1]/hook" "http://10.0.0.1/hook"; do
+  STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+    -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+    -d "{\"url\": \"$HOOK_URL\"}" \
+    "$API_URL/projects/$PROJECT_ID/webhooks")
+  INTERNAL_HOOK_STATUSES="$INTERNAL_HOOK_STATUSES $STATUS"
+done
+echo "Statuses:$INTERNAL_HOOK_STATUSES"
+if [ "$INTERNAL_HOOK_STATUSES" = " 400 400 400 400 400" ]; then
+  success_msg "Internal webhook URLs refused"
+else
+  error_msg "Internal webhook URLs should be refused with 400"
+fi
+
+# 8b2. Unknown webhook fields are a 400 listing the issue, not silently
+# dropped (the contract and parseJsonBody's strict schema both refuse them)
+test_endpoint "8b2. POST /projects/{projectId}/webhooks - Unknown field (expect 400)"
+UNKNOWN_FIELD_BODY=$(curl -s -w "\nStatus: %{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"url": "https://example.com/testhub-hook", "secret": "mine"}' \
+  "$API_URL/projects/$PROJECT_ID/webhooks")
+echo "$UNKNOWN_FIELD_BODY"
+if echo "$UNKNOWN_FIELD_BODY" | grep -q "Status: 400" \
+  && echo "$UNKNOWN_FIELD_BODY" | grep -q '"errors"'; then
+  success_msg "Unknown webhook field rejected"
+else
+  error_msg "Unknown webhook field should be a 400"
+fi
+
+# 8c. A webhook receiver that never answers (192.0.2.1 is TEST-NET-1, which
+# drops the connection attempt) doesn't hold up ingest: deliveries are
+# background jobs, so the run is created well within its request deadline
+test_endpoint "8c. POST /projects/{projectId}/runs - Slow webhook doesn't delay ingest"
+SLOW_WEBHOOK_ID=$(curl -s -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"url": "http://192.0.2.1:81/testhub-hook", "events": ["run.completed", "run.failed"]}' \
+  "$API_URL/projects/$PROJECT_ID/webhooks" \
+  | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+SLOW_INGEST=$(curl -s -o /dev/null -w "%{http_code} %{time_total}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary '<testsuite name="deadline"><testcase name="ok"/></testsuite>' \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=deadline-smoke")
+curl -s -o /dev/null -X DELETE -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/webhooks/$SLOW_WEBHOOK_ID"
+echo "ingest with a hanging webhook: $SLOW_INGEST"
+if [ -n "$SLOW_WEBHOOK_ID" ] && [ "${SLOW_INGEST%% *}" = "201" ] \
+  && awk "BEGIN { exit !(${SLOW_INGEST##* } < 3) }"; then
+  success_msg "Slow webhook doesn't delay ingest"
+else
+  error_msg "Ingest should answer without waiting for a webhook receiver"
+fi
+
 # 9. Create Run
 test_endpoint "9. POST /projects/{projectId}/runs - Create run"
 RUN_RESPONSE=$(curl -s -w "\nHTTP_STATUS:%{http_code}" \
   -X POST \
   -H "x-api-key: $API_KEY" \
   -H "Content-Type: application/json" \
+  -H "X-Testhub-Label-job: smoke" \
+  -H "X-Testhub-Env-Arch: x64" \
   -d '{
     "source": "test-script",
     "branch": "main",
@@ -124,11 +389,18 @@ RUN_RESPONSE=$(curl -s -w "\nHTTP_STATUS:%{http_code}" \
     "env": {
       "NODE_ENV": "test"
     },
+    "environment": {
+      "os": "Linux",
+      "runtime": "node 22"
+    },
     "meta": {
       "runner": "curl"
+    },
+    "labels": {
+      "env": "staging"
     }
   }' \
-  "$BASE_URL/projects/$PROJECT_ID/runs")
+  "$API_URL/projects/$PROJECT_ID/runs")
 
 RUN_BODY=$(echo "$RUN_RESPONSE" | sed '$d')
 STATUS_CODE=$(echo "$RUN_RESPONSE" | grep "HTTP_STATUS:" | cut -d':' -f2)
@@ -143,13 +415,57 @@ else
     error_msg "Failed to create run"
 fi
 
+# 9b. Idempotency-Key: the retry returns the first run (200, replay header)
+# instead of creating a second one
+test_endpoint "9b. POST /projects/{projectId}/runs with Idempotency-Key - Retry-safe create"
+IDEM_KEY="smoke-$(date +%s)-$$"
+IDEM_FIRST=$(curl -s -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -H "Idempotency-Key: $IDEM_KEY" \
+  -d '{"source":"test-script","branch":"idempotency-smoke"}' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+IDEM_RETRY=$(curl -s -i -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -H "Idempotency-Key: $IDEM_KEY" \
+  -d '{"source":"test-script","branch":"idempotency-smoke"}' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+IDEM_FIRST_ID=$(echo "$IDEM_FIRST" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+IDEM_COUNT=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=idempotency-smoke" | grep -o '"branch":"idempotency-smoke"' | wc -l | tr -d ' ')
+echo "$IDEM_FIRST"
+echo "$IDEM_RETRY" | grep -i "^HTTP\|^idempotent-replayed"
+echo "runs with the key's branch: $IDEM_COUNT"
+if echo "$IDEM_FIRST" | grep -q "Status: 201" \
+  && echo "$IDEM_RETRY" | grep -q "^HTTP/[0-9.]* 200" \
+  && echo "$IDEM_RETRY" | grep -qi "^idempotent-replayed: true" \
+  && echo "$IDEM_RETRY" | grep -q "\"id\":\"$IDEM_FIRST_ID\"" \
+  && [ "$IDEM_COUNT" = "1" ]; then
+  success_msg "Idempotent run creation"
+else
+  error_msg "Idempotent run creation"
+fi
+
 # 10. Get Run Details
 test_endpoint "10. GET /projects/{projectId}/runs/{runId} - Get run details"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs/$RUN_ID"
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID"
 success_msg "Get run details"
 
+# 10b. Conditional GET: revalidating with the run's ETag is an empty 304
+test_endpoint "10b. GET /projects/{projectId}/runs/{runId} with If-None-Match - Not Modified"
+RUN_ETAG=$(curl -s -i -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID" | grep -i "^etag:" | cut -d' ' -f2 | tr -d '\r')
+RUN_304=$(curl -s -o /dev/null -w "%{http_code}" \
+  -H "x-api-key: $API_KEY" -H "If-None-Match: $RUN_ETAG" \
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID")
+echo "ETag: $RUN_ETAG -> $RUN_304"
+if [ -n "$RUN_ETAG" ] && [ "$RUN_304" = "304" ]; then
+  success_msg "Run details revalidation"
+else
+  error_msg "Run details revalidation"
+fi
+
 # 11. Batch Ingest Results
 test_endpoint "11. POST /projects/{projectId}/runs/{runId}/results/batch - Batch ingest"
 curl -s -w "\nStatus: %{http_code}\n" \
@@ -187,55 +503,634 @@ curl -s -w "\nStatus: %{http_code}\n" \
       }
     ]
   }' \
-  "$BASE_URL/projects/$PROJECT_ID/runs/$RUN_ID/results/batch"
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID/results/batch"
 success_msg "Batch ingest results"
 
+# 11b. The batch changed the run's counts, so the ETag from 10b is stale
+test_endpoint "11b. GET /projects/{projectId}/runs/{runId} with a stale If-None-Match - Modified"
+RUN_STALE=$(curl -s -i -H "x-api-key: $API_KEY" -H "If-None-Match: $RUN_ETAG" \
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID")
+RUN_NEW_ETAG=$(echo "$RUN_STALE" | grep -i "^etag:" | cut -d' ' -f2 | tr -d '\r')
+echo "$RUN_STALE" | grep -i "^HTTP\|^etag"
+if echo "$RUN_STALE" | grep -q "^HTTP/[0-9.]* 200" \
+  && [ -n "$RUN_NEW_ETAG" ] && [ "$RUN_NEW_ETAG" != "$RUN_ETAG" ]; then
+  success_msg "Run ETag changes with its results"
+else
+  error_msg "Run ETag changes with its results"
+fi
+
 # 12. List Run Results
 test_endpoint "12. GET /projects/{projectId}/runs/{runId}/results - List results"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs/$RUN_ID/results"
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID/results"
 success_msg "List run results"
 
+# 12a. Search tests by name: case-insensitive, paged by cursor; blank q is 400
+test_endpoint "12a. GET /projects/{projectId}/search?q= - Search tests"
+SEARCH_BODY=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/search?q=SHOULD&limit=1")
+echo "$SEARCH_BODY"
+SEARCH_CURSOR=$(echo "$SEARCH_BODY" | grep -o '"nextCursor":"[^"]*"' | cut -d'"' -f4)
+SEARCH_PAGE2=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/search?q=SHOULD&limit=1&cursor=$SEARCH_CURSOR")
+BLANK_Q_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/search?q=%20")
+FIRST_TEST=$(echo "$SEARCH_BODY" | grep -o '"externalId":"[^"]*"' | head -1)
+SECOND_TEST=$(echo "$SEARCH_PAGE2" | grep -o '"externalId":"[^"]*"' | head -1)
+echo "page 1: $FIRST_TEST, page 2: $SECOND_TEST, blank q: $BLANK_Q_STATUS"
+if [ -n "$SEARCH_CURSOR" ] && [ -n "$SECOND_TEST" ] \
+  && [ "$FIRST_TEST" != "$SECOND_TEST" ] && [ "$BLANK_Q_STATUS" = "400" ]; then
+  success_msg "Search tests with pagination"
+else
+  error_msg "Search tests"
+fi
+
+# 12b. Ingest a JUnit XML report as a new run; malformed XML is a 400
+test_endpoint "12b. POST /projects/{projectId}/runs (JUnit XML) - Ingest report"
+JUNIT_BODY=$(curl -s -w "\nStatus: %{http_code}\n" \
+  -X POST \
+  -H "x-api-key: $API_KEY" \
+  -H "Content-Type: application/xml" \
+  --data-binary '<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="math" time="0.3">
+    <testcase classname="math" name="adds" time="0.1"/>
+    <testcase classname="math" name="divides" time="0.2">
+      <failure message="expected 2">AssertionError</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="io">
+    <testcase classname="io" name="writes"><skipped/></testcase>
+  </testsuite>
+</testsuites>' \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=junit-smoke")
+echo "$JUNIT_BODY"
+JUNIT_RUN_ID=$(echo "$JUNIT_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+BAD_XML_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary '<testsuite><testcase name="a"></testsuite>' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+echo "malformed XML: $BAD_XML_STATUS"
+# A report media type on a JSON-only route is refused, not let past the
+# contract
+XML_ON_JSON_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary '<testsuite name="a"/>' \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/results/batch")
+echo "XML to the JSON batch route: $XML_ON_JSON_STATUS"
+if [ "$BAD_XML_STATUS" = "400" ] && [ "$XML_ON_JSON_STATUS" = "415" ]; then
+  success_msg "JUnit XML ingest"
+else
+  error_msg "Malformed XML should return 400, XML to a JSON route 415"
+fi
+
+# 12b1. Captured output on the results: a case's own <system-out>; a failure
+# without any gets its suite's, a passing case doesn't; stdout past
+# REPORT_OUTPUT_MAX_BYTES (64 KiB by default) keeps its end and is flagged
+test_endpoint "12b1. GET /projects/{projectId}/runs/{runId}/results - Captured output"
+OUTPUT_REPORT=$(mktemp)
+LONG_OUTPUT="$(head -c 70000 /dev/zero | tr '\0' 'x')END-OF-OUTPUT"
+cat > "$OUTPUT_REPORT" <<EOF
+<testsuite name="output">
+  <testcase classname="output" name="prints"><system-out>own output</system-out></testcase>
+  <testcase classname="output" name="quiet"/>
+  <testcase classname="output" name="fails"><failure message="no"/></testcase>
+  <testcase classname="output" name="floods"><error/><system-out>$LONG_OUTPUT</system-out></testcase>
+  <system-out>suite output</system-out>
+  <system-err>suite errors</system-err>
+</testsuite>
+EOF
+OUTPUT_RUN_ID=$(curl -s -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary "@$OUTPUT_REPORT" \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=output-smoke" \
+  | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+rm -f "$OUTPUT_REPORT"
+OUTPUT_RESULTS=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$OUTPUT_RUN_ID/results")
+# One line per result, without the repeated x's
+OUTPUT_LINES=$(echo "$OUTPUT_RESULTS" | sed 's/},{"id"/}\n{"id"/g' | sed 's/xxxxxxxxxx*/x/')
+echo "$OUTPUT_LINES"
+if echo "$OUTPUT_LINES" | grep '"name":"prints"' | grep -q '"stdout":"own output","stderr":null,"outputTruncated":false' \
+  && echo "$OUTPUT_LINES" | grep '"name":"quiet"' | grep -q '"stdout":null,"stderr":null' \
+  && echo "$OUTPUT_LINES" | grep '"name":"fails"' | grep -q '"stdout":"suite output","stderr":"suite errors"' \
+  && echo "$OUTPUT_LINES" | grep '"name":"floods"' | grep -q '"stdout":"\[... [0-9]* bytes truncated ...\]\\nxEND-OF-OUTPUT","stderr":"suite errors","outputTruncated":true'; then
+  success_msg "Captured output"
+else
+  error_msg "Captured output should be stored per case, inherited by failures and truncated"
+fi
+
+# 12b2. Export the JUnit run back to JUnit XML and ingest the export: the
+# new run has the same counts (3 cases: 1 passed, 1 failed, 1 skipped)
+test_endpoint "12b2. GET /projects/{projectId}/runs/{runId}/junit.xml - Export as JUnit"
+JUNIT_EXPORT=$(mktemp)
+EXPORT_STATUS=$(curl -s -o "$JUNIT_EXPORT" -w "%{http_code}" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/junit.xml")
+cat "$JUNIT_EXPORT"
+REIMPORT=$(curl -s -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary "@$JUNIT_EXPORT" \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=junit-export-smoke")
+echo "$REIMPORT"
+if [ "$EXPORT_STATUS" = "200" ] \
+  && grep -q '<testsuite name="math"' "$JUNIT_EXPORT" \
+  && grep -q '<failure message="expected 2">AssertionError</failure>' "$JUNIT_EXPORT" \
+  && echo "$REIMPORT" | grep -q '"totalCount":3' \
+  && echo "$REIMPORT" | grep -q '"passedCount":1' \
+  && echo "$REIMPORT" | grep -q '"failedCount":1' \
+  && echo "$REIMPORT" | grep -q '"skippedCount":1'; then
+  success_msg "JUnit export round trip"
+else
+  error_msg "JUnit export round trip"
+fi
+rm -f "$JUNIT_EXPORT"
+
+# 12b3. Quarantine the failing "divides" test: a report whose only failure
+# is that test finishes COMPLETED and lists it under quarantinedFailures
+test_endpoint "12b3. POST /projects/{projectId}/quarantine - Quarantine a flaky test"
+QUARANTINE_BODY=$(curl -s -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"name": "divides", "reason": "flaky on CI"}' \
+  "$API_URL/projects/$PROJECT_ID/quarantine")
+echo "$QUARANTINE_BODY"
+QUARANTINE_ID=$(echo "$QUARANTINE_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+QUARANTINED_RUN=$(curl -s -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  --data-binary '<testsuite name="math">
+  <testcase classname="math" name="adds"/>
+  <testcase classname="math" name="divides"><failure message="expected 2"/></testcase>
+</testsuite>' \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=quarantine-smoke")
+echo "$QUARANTINED_RUN"
+QUARANTINED_RUN_ID=$(echo "$QUARANTINED_RUN" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+QUARANTINED_DETAILS=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$QUARANTINED_RUN_ID")
+PAST_EXPIRY_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"name": "adds", "expiresAt": "2000-01-01T00:00:00Z"}' \
+  "$API_URL/projects/$PROJECT_ID/quarantine")
+RELEASE_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/quarantine/$QUARANTINE_ID")
+echo "past expiresAt: $PAST_EXPIRY_STATUS, release: $RELEASE_STATUS"
+if echo "$QUARANTINE_BODY" | grep -q "Status: 201" \
+  && echo "$QUARANTINED_RUN" | grep -q '"status":"COMPLETED"' \
+  && echo "$QUARANTINED_RUN" | grep -q '"quarantined":1' \
+  && echo "$QUARANTINED_DETAILS" | grep -q '"quarantinedFailures":\[{[^]]*"name":"divides"' \
+  && [ "$PAST_EXPIRY_STATUS" = "400" ] && [ "$RELEASE_STATUS" = "204" ]; then
+  success_msg "Quarantined failures don't fail the run"
+else
+  error_msg "Quarantined failures don't fail the run"
+fi
+
+# 12b4. Upload a report with Prefer: respond-async: 202 with the QUEUED run
+# and its Location; the run is COMPLETED once the background job stored it
+test_endpoint "12b4. POST /projects/{projectId}/runs (Prefer: respond-async) - Queue a report"
+ASYNC_HEADERS=$(mktemp)
+ASYNC_BODY=$(curl -s -D "$ASYNC_HEADERS" -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/xml" \
+  -H "Prefer: respond-async" \
+  --data-binary '<testsuite name="async"><testcase classname="async" name="queued"/></testsuite>' \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=async-smoke")
+echo "$ASYNC_BODY"
+ASYNC_RUN_ID=$(echo "$ASYNC_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+ASYNC_STATUS=""
+for _ in 1 2 3 4 5 6 7 8 9 10; do
+  ASYNC_STATUS=$(curl -s -H "x-api-key: $API_KEY" \
+    "$API_URL/projects/$PROJECT_ID/runs/$ASYNC_RUN_ID" \
+    | grep -o '"status":"[A-Z]*"' | head -1 | cut -d'"' -f4)
+  [ "$ASYNC_STATUS" = "QUEUED" ] || break
+  sleep 0.5
+done
+echo "queued run status: $ASYNC_STATUS"
+if echo "$ASYNC_BODY" | grep -q "Status: 202" \
+  && echo "$ASYNC_BODY" | grep -q '"status":"QUEUED"' \
+  && grep -qi "^location: .*/runs/$ASYNC_RUN_ID" "$ASYNC_HEADERS" \
+  && [ "$ASYNC_STATUS" = "COMPLETED" ]; then
+  success_msg "Async report ingest"
+else
+  error_msg "Async report ingest"
+fi
+rm -f "$ASYNC_HEADERS"
+
+# 12c. Ingest a TAP report; the unmet plan (3 planned, 2 run) is kept as a
+# run warning instead of failing the request
+test_endpoint "12c. POST /projects/{projectId}/runs?format=tap - Ingest TAP"
+TAP_BODY=$(curl -s -w "\nStatus: %{http_code}\n" \
+  -X POST \
+  -H "x-api-key: $API_KEY" \
+  -H "Content-Type: text/plain" \
+  --data-binary 'TAP version 13
+1..3
+ok 1 - parses input
+not ok 2 - renders output # TODO not implemented yet' \
+  "$API_URL/projects/$PROJECT_ID/runs?format=tap&branch=tap-smoke")
+echo "$TAP_BODY"
+TAP_RUN_ID=$(echo "$TAP_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+TAP_WARNINGS=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$TAP_RUN_ID" | grep -o '"warnings":\[[^]]*\]')
+echo "$TAP_WARNINGS"
+if echo "$TAP_WARNINGS" | grep -q "expects 3"; then
+  success_msg "TAP ingest"
+else
+  error_msg "TAP plan mismatch should be stored as a run warning"
+fi
+
+# 12c2. Batch of reports (multipart): one run per file; one bad file fails
+# the whole batch with a 400 that names it
+test_endpoint "12c2. POST /projects/{projectId}/runs/batch - Ingest several reports"
+BATCH_DIR=$(mktemp -d)
+printf '<testsuite name="api"><testcase classname="api" name="lists"/></testsuite>' > "$BATCH_DIR/api.xml"
+printf '1..1\nok 1 - web renders\n' > "$BATCH_DIR/web.tap"
+printf '<testsuite><testcase name="a"></testsuite>' > "$BATCH_DIR/broken.xml"
+BATCH_BODY=$(curl -s -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" \
+  -F "files=@$BATCH_DIR/api.xml" -F "files=@$BATCH_DIR/web.tap" \
+  "$API_URL/projects/$PROJECT_ID/runs/batch?branch=batch-smoke&commitSha=abc1234&ciBuildUrl=https://ci.example.com/builds/1")
+echo "$BATCH_BODY"
+BAD_BATCH_BODY=$(curl -s -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" \
+  -F "files=@$BATCH_DIR/api.xml" -F "files=@$BATCH_DIR/broken.xml" \
+  "$API_URL/projects/$PROJECT_ID/runs/batch")
+echo "$BAD_BATCH_BODY"
+rm -rf "$BATCH_DIR"
+if echo "$BATCH_BODY" | grep -q "Status: 201" \
+  && [ "$(echo "$BATCH_BODY" | grep -o '"filename"' | wc -l)" -eq 2 ] \
+  && echo "$BAD_BATCH_BODY" | grep -q "Status: 400" \
+  && echo "$BAD_BATCH_BODY" | grep -q '"filename":"broken.xml"'; then
+  success_msg "Batch report ingest"
+else
+  error_msg "Batch report ingest"
+fi
+
+# 12d. Bodies over BODY_LIMIT_BYTES (default 1 MiB) are a 413 problem
+test_endpoint "12d. POST /projects/{projectId}/runs - Oversized JSON body (413)"
+BIG_RESPONSE=$(mktemp)
+BIG_STATUS=$( (printf '{"source":"'; head -c 1200000 /dev/zero | tr '\0' 'a'; printf '"}') |
+  curl -s -o "$BIG_RESPONSE" -w "%{http_code} %{content_type}" -X POST \
+    -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+    --data-binary @- "$API_URL/projects/$PROJECT_ID/runs")
+echo "$BIG_STATUS"
+cat "$BIG_RESPONSE"; echo
+if [[ "$BIG_STATUS" == "413 application/problem+json"* ]] &&
+  grep -q '"status":413' "$BIG_RESPONSE"; then
+  success_msg "Body size limit"
+else
+  error_msg "Oversized body should be a 413 problem"
+fi
+rm -f "$BIG_RESPONSE"
+
 # 13. List Runs with Filter
 test_endpoint "13. GET /projects/{projectId}/runs?status=QUEUED&limit=10 - List with filter"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs?status=QUEUED&limit=10"
+  "$API_URL/projects/$PROJECT_ID/runs?status=QUEUED&limit=10"
 success_msg "List runs with filter"
 
+# 13b. Cursor pagination (runs from step 9, 12b and 12c exist),
+# branch filter, and 400 for a bogus cursor
+test_endpoint "13b. GET /projects/{projectId}/runs?limit=1&cursor=... - Paginate"
+PAGE_1=$(curl -s -H "x-api-key: $API_KEY" "$API_URL/projects/$PROJECT_ID/runs?limit=1")
+NEXT_CURSOR=$(echo "$PAGE_1" | grep -o '"nextCursor":"[^"]*"' | cut -d'"' -f4)
+PAGE_2=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?limit=1&cursor=$NEXT_CURSOR")
+FIRST_ID=$(echo "$PAGE_1" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+SECOND_ID=$(echo "$PAGE_2" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+echo "page 1: $FIRST_ID, page 2: $SECOND_ID"
+BRANCH_COUNT=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=junit-smoke" | grep -o '"branch":"[^"]*"' | wc -l | tr -d ' ')
+echo "runs on branch junit-smoke: $BRANCH_COUNT"
+BAD_CURSOR_STATUS=$(curl -s -o /dev/null -w "%{http_code}" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?cursor=not-a-cursor")
+echo "invalid cursor: $BAD_CURSOR_STATUS"
+if [ -n "$NEXT_CURSOR" ] && [ -n "$SECOND_ID" ] && [ "$FIRST_ID" != "$SECOND_ID" ] \
+  && [ "$BRANCH_COUNT" = "1" ] && [ "$BAD_CURSOR_STATUS" = "400" ]; then
+  success_msg "Paginate and filter runs"
+else
+  error_msg "Run pagination/filtering did not behave as expected"
+fi
+
+# 13c. Flaky tests report (empty here: no test both passed and failed), also
+# grouped by run OS
+test_endpoint "13c. GET /projects/{projectId}/flaky?days=7&minRuns=2 - Flaky tests"
+curl -s -w "\nStatus: %{http_code}\n" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/flaky?days=7&minRuns=2"
+FLAKY_BY_OS=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/flaky?days=7&minRuns=2&groupBy=os")
+echo "$FLAKY_BY_OS"
+if echo "$FLAKY_BY_OS" | grep -q '"groupBy":"os"'; then
+  success_msg "Flaky tests report"
+else
+  error_msg "Flaky tests report"
+fi
+
+# 13c2. Duration regressions (empty here: too few results for a baseline);
+# factor must be above 1
+test_endpoint "13c2. GET /projects/{projectId}/slow - Slower tests"
+curl -s -w "\nStatus: %{http_code}\n" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/slow?factor=2&recent=3&baseline=10"
+SLOW_BAD_STATUS=$(curl -s -o /dev/null -w "%{http_code}" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/slow?factor=1")
+echo "factor=1: $SLOW_BAD_STATUS"
+if [ "$SLOW_BAD_STATUS" = "400" ]; then
+  success_msg "Slow tests report"
+else
+  error_msg "Slow tests report"
+fi
+
+# 13d. Compare the batch run (step 11) with the JUnit run (12b): no shared
+# cases, so everything is added/removed
+test_endpoint "13d. GET /projects/{projectId}/runs/{runId}/compare/{otherRunId} - Compare runs"
+curl -s -w "\nStatus: %{http_code}\n" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID/compare/$JUNIT_RUN_ID"
+success_msg "Compare runs"
+
+# 13d2. Commit metadata: the batch runs (12c2) match a commit prefix in any
+# case; the newer one compares against the other by default (same branch);
+# a non-hex commitSha is a 400
+test_endpoint "13d2. GET /projects/{projectId}/runs?commit=... and .../compare - Commit filter, default compare"
+COMMIT_COUNT=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?commit=ABC1234" | grep -o '"commitSha":"abc1234"' | wc -l | tr -d ' ')
+LATEST_BATCH_ID=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=batch-smoke&limit=1" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+DEFAULT_COMPARE=$(curl -s -w "\nStatus: %{http_code}\n" -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$LATEST_BATCH_ID/compare")
+BAD_SHA_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -H "X-Testhub-Commit: not-a-sha" \
+  -d '{"branch":"main"}' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+echo "runs on commit abc1234: $COMMIT_COUNT; invalid commit header: $BAD_SHA_STATUS"
+echo "$DEFAULT_COMPARE"
+if [ "$COMMIT_COUNT" = "2" ] && [ "$BAD_SHA_STATUS" = "400" ] \
+  && echo "$DEFAULT_COMPARE" | grep -q "Status: 200" \
+  && echo "$DEFAULT_COMPARE" | grep -q "\"head\":{\"id\":\"$LATEST_BATCH_ID\""; then
+  success_msg "Commit filter and default compare"
+else
+  error_msg "Commit filter / default compare did not behave as expected"
+fi
+
+# 13e. History of one test looked up by name (from the JUnit run)
+test_endpoint "13e. GET /projects/{projectId}/tests/{name}/history - History by test name"
+curl -s -w "\nStatus: %{http_code}\n" \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/tests/divides/history?suite=math&limit=10"
+success_msg "Test history by name"
+
+# 13f. Upload an artifact to the JUnit run, download it back, and check that a
+# disallowed content type is refused with 415
+test_endpoint "13f. POST/GET /projects/{projectId}/runs/{runId}/artifacts - Artifacts"
+ARTIFACT_FILE=$(mktemp)
+echo "smoke test log line" > "$ARTIFACT_FILE"
+ARTIFACT_BODY=$(curl -s -w "\nStatus: %{http_code}\n" \
+  -X POST \
+  -H "x-api-key: $API_KEY" \
+  -F "file=@$ARTIFACT_FILE;type=text/plain;filename=smoke.log" \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/artifacts")
+echo "$ARTIFACT_BODY"
+ARTIFACT_ID=$(echo "$ARTIFACT_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+DOWNLOADED=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/artifacts/$ARTIFACT_ID")
+ARTIFACT_HEAD_LENGTH=$(curl -s --head -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/artifacts/$ARTIFACT_ID" \
+  | grep -i '^content-length:' | cut -d' ' -f2 | tr -d '\r')
+BAD_TYPE_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" \
+  -F "file=@$ARTIFACT_FILE;type=application/x-msdownload;filename=smoke.exe" \
+  "$API_URL/projects/$PROJECT_ID/runs/$JUNIT_RUN_ID/artifacts")
+rm -f "$ARTIFACT_FILE"
+echo "disallowed type: $BAD_TYPE_STATUS, HEAD content-length: $ARTIFACT_HEAD_LENGTH"
+# HEAD reports the stored size (the file plus its newline) without a body
+if [ "$DOWNLOADED" = "smoke test log line" ] && [ "$BAD_TYPE_STATUS" = "415" ] \
+  && [ "$ARTIFACT_HEAD_LENGTH" = "20" ]; then
+  success_msg "Upload and download artifact"
+else
+  error_msg "Artifact upload/download did not behave as expected"
+fi
+
+# 13g. Label filters: both labels of the step 9 run (body + header) match it
+# alone; an invalid label key is rejected
+test_endpoint "13g. GET /projects/{projectId}/runs?label=env:staging&label=job:smoke - Filter by labels"
+LABELED=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?label=env:staging&label=job:smoke")
+LABELED_IDS=$(echo "$LABELED" | grep -o '"id":"[^"]*"' | cut -d'"' -f4 | sort -u | tr '\n' ' ')
+NO_MATCH=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?label=env:staging&label=job:other" | grep -c '"labels"')
+BAD_LABEL_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"labels":{"Not Valid":"x"}}' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+echo "matching runs: $LABELED_IDS; non-matching filter hits: $NO_MATCH; invalid label: $BAD_LABEL_STATUS"
+if [ "$LABELED_IDS" = "$RUN_ID " ] && [ "$NO_MATCH" = "0" ] && [ "$BAD_LABEL_STATUS" = "400" ]; then
+  success_msg "Filter runs by labels"
+else
+  error_msg "Label filtering did not behave as expected"
+fi
+
+# 13g2. Environment: the step 9 run (body + header fields, os lowercased) is
+# the only one on linux and shows its environment; unknown keys are a 400
+test_endpoint "13g2. GET /projects/{projectId}/runs?environment=os:linux - Filter by environment"
+ENV_RUNS=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?environment=os:linux")
+ENV_IDS=$(echo "$ENV_RUNS" | grep -o '"id":"[^"]*"' | cut -d'"' -f4 | sort -u | tr '\n' ' ')
+ENV_DETAIL=$(curl -s -H "x-api-key: $API_KEY" "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID")
+ENV_NO_MATCH=$(curl -s -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs?environment=os:macos" | grep -c '"labels"')
+BAD_ENV_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"environment":{"browser":"chrome"}}' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+echo "linux runs: $ENV_IDS; macos hits: $ENV_NO_MATCH; unknown key: $BAD_ENV_STATUS"
+if [ "$ENV_IDS" = "$RUN_ID " ] && [ "$ENV_NO_MATCH" = "0" ] \
+  && echo "$ENV_DETAIL" | grep -q '"environment":{"os":"linux","arch":"x64","runtime":"node 22"}' \
+  && [ "$BAD_ENV_STATUS" = "400" ]; then
+  success_msg "Filter runs by environment"
+else
+  error_msg "Environment filtering did not behave as expected"
+fi
+
+# 13i. Project stats: runs exist from earlier steps; windows past 90d are a 400
+test_endpoint "13i. GET /projects/{projectId}/stats?window=7d - Project stats"
+STATS=$(curl -s -H "x-api-key: $API_KEY" "$API_URL/projects/$PROJECT_ID/stats?window=7d")
+STATS_BAD=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/stats?window=365d")
+echo "$STATS"
+echo "window=365d: $STATS_BAD"
+if echo "$STATS" | grep -q '"window":"7d"' &&
+  [ "$(echo "$STATS" | grep -o '"day":' | wc -l | tr -d ' ')" = "7" ] &&
+  [ "$STATS_BAD" = "400" ]; then
+  success_msg "Project stats"
+else
+  error_msg "Project stats"
+fi
+
+# 13h. Streamed run: create with no body (RUNNING), append cases twice,
+# complete (FAILED, counts from both batches), complete again (unchanged),
+# then appending is a 409
+test_endpoint "13h. POST /runs (no body), /cases, /complete - In-progress run"
+STREAM_BODY=$(curl -s -X POST -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs")
+STREAM_RUN_ID=$(echo "$STREAM_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+STREAM_STATUS=$(echo "$STREAM_BODY" | grep -o '"status":"[^"]*"' | cut -d'"' -f4)
+for CASE in '{"externalId":"stream.a","name":"a","status":"PASSED"}' \
+  '{"externalId":"stream.b","name":"b","status":"FAILED"}'; do
+  curl -s -o /dev/null -X POST -H "x-api-key: $API_KEY" \
+    -H "Content-Type: application/json" -d "{\"results\":[$CASE]}" \
+    "$API_URL/projects/$PROJECT_ID/runs/$STREAM_RUN_ID/cases"
+done
+COMPLETE_1=$(curl -s -X POST -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$STREAM_RUN_ID/complete")
+COMPLETE_2=$(curl -s -X POST -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/runs/$STREAM_RUN_ID/complete")
+LATE_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"results":[{"externalId":"stream.c","name":"c","status":"PASSED"}]}' \
+  "$API_URL/projects/$PROJECT_ID/runs/$STREAM_RUN_ID/cases")
+echo "created: $STREAM_STATUS; completed: $COMPLETE_1; late append: $LATE_STATUS"
+if [ "$STREAM_STATUS" = "RUNNING" ] &&
+  echo "$COMPLETE_1" | grep -q '"status":"FAILED"' &&
+  echo "$COMPLETE_1" | grep -q '"totalCount":2' &&
+  [ "$COMPLETE_1" = "$COMPLETE_2" ] && [ "$LATE_STATUS" = "409" ]; then
+  success_msg "In-progress run lifecycle"
+else
+  error_msg "In-progress run lifecycle"
+fi
+
+# 13j. Project token with only the ingest scope: it can upload a report to
+# its project, but reading runs, other projects and org routes are a 403;
+# once revoked it is a 401
+test_endpoint "13j. POST /projects/{projectId}/tokens - Project-scoped token"
+TOKEN_BODY=$(curl -s -w "\nStatus: %{http_code}\n" -X POST \
+  -H "x-api-key: $API_KEY" -H "Content-Type: application/json" \
+  -d '{"name": "ci", "scopes": ["ingest"]}' \
+  "$API_URL/projects/$PROJECT_ID/tokens")
+echo "$TOKEN_BODY" | sed 's/"token":"[^"]*"/"token":"***"/'
+PROJECT_TOKEN=$(echo "$TOKEN_BODY" | grep -o '"token":"[^"]*"' | cut -d'"' -f4)
+TOKEN_ID=$(echo "$TOKEN_BODY" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+TOKEN_INGEST_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $PROJECT_TOKEN" -H "Content-Type: text/x-tap" \
+  --data-binary $'1..1\nok 1 - uploaded with a project token' \
+  "$API_URL/projects/$PROJECT_ID/runs?branch=token-smoke")
+TOKEN_READ_STATUS=$(curl -s -o /dev/null -w "%{http_code}" \
+  -H "x-api-key: $PROJECT_TOKEN" "$API_URL/projects/$PROJECT_ID/runs")
+TOKEN_OTHER_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "Authorization: Bearer $PROJECT_TOKEN" -H "Content-Type: text/x-tap" \
+  --data-binary $'1..1\nok 1 - wrong project' \
+  "$API_URL/projects/not-this-project/runs")
+TOKEN_ORG_STATUS=$(curl -s -o /dev/null -w "%{http_code}" \
+  -H "x-api-key: $PROJECT_TOKEN" "$API_URL/projects")
+TOKEN_LISTED=$(curl -s -H "x-api-key: $API_KEY" "$API_URL/projects/$PROJECT_ID/tokens")
+curl -s -o /dev/null -X DELETE -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID/tokens/$TOKEN_ID"
+TOKEN_REVOKED_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST \
+  -H "x-api-key: $PROJECT_TOKEN" -H "Content-Type: text/x-tap" \
+  --data-binary $'1..1\nok 1 - revoked' \
+  "$API_URL/projects/$PROJECT_ID/runs")
+echo "ingest: $TOKEN_INGEST_STATUS, read: $TOKEN_READ_STATUS, other project: $TOKEN_OTHER_STATUS, org: $TOKEN_ORG_STATUS, revoked: $TOKEN_REVOKED_STATUS"
+if echo "$TOKEN_BODY" | grep -q "Status: 201" \
+  && [ "$TOKEN_INGEST_STATUS" = "201" ] && [ "$TOKEN_READ_STATUS" = "403" ] \
+  && [ "$TOKEN_OTHER_STATUS" = "403" ] && [ "$TOKEN_ORG_STATUS" = "403" ] \
+  && [ "$TOKEN_REVOKED_STATUS" = "401" ] \
+  && echo "$TOKEN_LISTED" | grep -q "\"id\":\"$TOKEN_ID\"" \
+  && ! echo "$TOKEN_LISTED" | grep -q '"token"'; then
+  success_msg "Project token scopes"
+else
+  error_msg "Project token scopes"
+fi
+
+# 13k. Public status badge, no credentials: the JUnit branch (a failure) is
+# failing, the token branch (13j) passing, an unknown branch unknown; the
+# ETag gives a 304, and so does Last-Modified without one
+test_endpoint "13k. GET /projects/{projectId}/badge.svg - Status badge"
+BADGE_HEADERS=$(mktemp)
+BADGE_FAILING=$(curl -s -D "$BADGE_HEADERS" \
+  "$API_URL/projects/$PROJECT_ID/badge.svg?branch=junit-smoke")
+BADGE_ETAG=$(grep -i '^etag:' "$BADGE_HEADERS" | cut -d' ' -f2- | tr -d '\r')
+BADGE_PASSING=$(curl -s "$API_URL/projects/$PROJECT_ID/badge.svg?branch=token-smoke")
+BADGE_UNKNOWN=$(curl -s "$API_URL/projects/$PROJECT_ID/badge.svg?branch=no-such-branch")
+BADGE_304=$(curl -s -o /dev/null -w "%{http_code}" -H "If-None-Match: $BADGE_ETAG" \
+  "$API_URL/projects/$PROJECT_ID/badge.svg?branch=junit-smoke")
+BADGE_MODIFIED=$(grep -i '^last-modified:' "$BADGE_HEADERS" | cut -d' ' -f2- | tr -d '\r')
+BADGE_IMS_304=$(curl -s -o /dev/null -w "%{http_code}" -H "If-Modified-Since: $BADGE_MODIFIED" \
+  "$API_URL/projects/$PROJECT_ID/badge.svg?branch=junit-smoke")
+echo "etag: $BADGE_ETAG, revalidated: $BADGE_304 / $BADGE_IMS_304"
+if grep -qi '^content-type: image/svg+xml' "$BADGE_HEADERS" \
+  && grep -qi '^cache-control: public' "$BADGE_HEADERS" \
+  && echo "$BADGE_FAILING" | grep -q '>failing<' \
+  && echo "$BADGE_PASSING" | grep -q '>passing<' \
+  && echo "$BADGE_UNKNOWN" | grep -q '>unknown<' \
+  && [ "$BADGE_304" = "304" ] \
+  && [ "$BADGE_IMS_304" = "304" ]; then
+  success_msg "Status badge"
+else
+  error_msg "Status badge"
+fi
+rm -f "$BADGE_HEADERS"
+
+# 13l. Cross-project feed: failed runs of every project in the org, each
+# with its project; the failing JUnit run from 12b is among them
+test_endpoint "13l. GET /runs?status=failed - Cross-project run feed"
+FEED_BODY=$(curl -s -H "x-api-key: $API_KEY" "$API_URL/runs?status=failed&limit=100")
+FEED_OTHER=$(echo "$FEED_BODY" | grep -o '"status":"[A-Z]*"' | grep -vc '"FAILED"')
+FEED_BAD_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "x-api-key: $API_KEY" \
+  "$API_URL/runs?status=broken")
+echo "non-failed runs: $FEED_OTHER, bad status: $FEED_BAD_STATUS"
+if echo "$FEED_BODY" | grep -q "\"id\":\"$JUNIT_RUN_ID\"" \
+  && echo "$FEED_BODY" | grep -q '"project":{"id":"' \
+  && [ "$FEED_OTHER" = "0" ] && [ "$FEED_BAD_STATUS" = "400" ]; then
+  success_msg "Cross-project run feed"
+else
+  error_msg "Run feed should list only failed runs with their project"
+fi
+
 # 14. Delete Run
 test_endpoint "14. DELETE /projects/{projectId}/runs/{runId} - Delete run"
 curl -s -w "\nStatus: %{http_code}\n" \
   -X DELETE \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs/$RUN_ID"
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID"
 success_msg "Delete run"
 
 # 15. Verify Run Deleted (should return 404)
 test_endpoint "15. GET /projects/{projectId}/runs/{runId} - Verify run deleted (expect 404)"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID/runs/$RUN_ID"
+  "$API_URL/projects/$PROJECT_ID/runs/$RUN_ID"
 success_msg "Verified run deleted"
 
-# 16. Delete Project
-test_endpoint "16. DELETE /projects/{projectId} - Delete project"
+# 16. Delete Project: refused (409) while it still has runs (the JUnit run
+# from 12b), deleted with ?cascade=true
+test_endpoint "16. DELETE /projects/{projectId} - Delete project (409, then cascade)"
+DELETE_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE \
+  -H "x-api-key: $API_KEY" \
+  "$API_URL/projects/$PROJECT_ID")
+echo "without cascade: $DELETE_STATUS"
 curl -s -w "\nStatus: %{http_code}\n" \
   -X DELETE \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID"
-success_msg "Delete project"
+  "$API_URL/projects/$PROJECT_ID?cascade=true"
+if [ "$DELETE_STATUS" = "409" ]; then
+  success_msg "Delete project"
+else
+  error_msg "Deleting a project with runs should return 409 without cascade"
+fi
 
 # 17. Verify Project Deleted (should return 404)
 test_endpoint "17. GET /projects/{projectId} - Verify project deleted (expect 404)"
 curl -s -w "\nStatus: %{http_code}\n" \
   -H "x-api-key: $API_KEY" \
-  "$BASE_URL/projects/$PROJECT_ID"
+  "$API_URL/projects/$PROJECT_ID"
 success_msg "Verified project deleted"
 
 # 18. Test Error Cases
-test_endpoint "18. POST /projects - Create project with duplicate slug (expect 400)"
+test_endpoint "18. POST /projects - Create project with duplicate slug (expect 409)"
 curl -s -w "\nStatus: %{http_code}\n" \
   -X POST \
   -H "x-api-key: $API_KEY" \
@@ -244,7 +1139,7 @@ curl -s -w "\nStatus: %{http_code}\n" \
     "name": "Another Project",
     "slug": "duplicate-test"
   }' \
-  "$BASE_URL/projects"
+  "$API_URL/projects"
 
 curl -s -w "\nStatus: %{http_code}\n" \
   -X POST \
@@ -254,15 +1149,31 @@ curl -s -w "\nStatus: %{http_code}\n" \
     "name": "Another Project",
     "slug": "duplicate-test"
   }' \
-  "$BASE_URL/projects"
+  "$API_URL/projects"
 success_msg "Duplicate slug error test"
 
 # 19. Test Unauthorized (expect 401)
 test_endpoint "19. GET /projects - No API key (expect 401)"
 curl -s -w "\nStatus: %{http_code}\n" \
-  "$BASE_URL/projects"
+  "$API_URL/projects"
 success_msg "Unauthorized test"
 
+# 20. Middleware order: a 429 from the rate limiter is answered after the
+# request ID is assigned, so it echoes X-Request-ID too. Last, since the
+# burst drains this client's bucket (RATE_LIMIT_BURST, default 40)
+test_endpoint "20. GET /health burst - X-Request-ID on 429"
+seq 1 100 | xargs -P 20 -I{} curl -s -o /dev/null "$BASE_URL/health"
+LIMITED_HEADERS=$(curl -s -o /dev/null -D - -H "X-Request-ID: smoke-429-check" "$BASE_URL/health" | tr -d '\r')
+LIMITED_STATUS=$(echo "$LIMITED_HEADERS" | head -1 | cut -d' ' -f2)
+echo "Status: $LIMITED_STATUS"
+if [ "$LIMITED_STATUS" != "429" ]; then
+  success_msg "Not rate limited (RATE_LIMIT_PER_SECOND=0 or a large burst); skipped"
+elif echo "$LIMITED_HEADERS" | grep -qi "^x-request-id: smoke-429-check"; then
+  success_msg "429 carries X-Request-ID"
+else
+  error_msg "429 without X-Request-ID"
+fi
+
 echo ""
 echo -e "${GREEN}========================================${NC}"
 echo -e "${GREEN}✓ All API tests completed!${NC}"
@@ -10,6 +10,9 @@ const API_BASE =
 	'http://localhost:8080';
 const DEV_API_KEY = import.meta.env.VITE_API_KEY as string | undefined;
 
+// Application endpoints live under /v1; auth (and health) stay at the root
+const API_VERSION = 'v1';
+
 export class ApiError extends Error {
 	status: number;
 	statusText: string;
@@ -35,7 +38,8 @@ function isRecord(v: unknown): v is Record<string, unknown> {
 
 async function parseErrorBody(res: Response): Promise<unknown> {
 	const ct = res.headers.get('content-type') ?? '';
-	if (ct.includes('application/json')) {
+	// application/json or application/problem+json (error responses)
+	if (/[/+]json\b/.test(ct)) {
 		try {
 			return await res.json();
 		} catch {
@@ -116,7 +120,11 @@ async function apiFetch<T>(path: string, init?: RequestInit): Promise<T> {
 			(headers as Record<string, string>)['content-type'] ?? 'application/json';
 	}
 
-	const res = await fetch(`${API_BASE}${path}`, {
+	const url = isAuthPath(path)
+		? `${API_BASE}${path}`
+		: `${API_BASE}/${API_VERSION}${path}`;
+
+	const res = await fetch(url, {
 		...init,
 		headers,
 		credentials: 'include',
@@ -140,8 +148,8 @@ async function apiFetch<T>(path: string, init?: RequestInit): Promise<T> {
 		let message = `${res.status} ${res.statusText}`;
 		if (typeof details === 'string' && details.trim()) {
 			message = `${message} — ${details}`;
-		} else if (isRecord(details) && typeof details.message === 'string') {
-			message = `${message} — ${details.message}`;
+		} else if (isRecord(details) && typeof details.detail === 'string') {
+			message = `${message} — ${details.detail}`;
 		}
 
 		throw new ApiError({
@@ -222,6 +230,7 @@ export type SearchRunItem = {
 export type SearchResponse = {
 	tests: SearchTestItem[];
 	runs: SearchRunItem[];
+	nextCursor: string | null;
 };
 
 // Projects
@@ -329,8 +338,8 @@ export async function getAuthMe(): Promise<AuthMeResponse | null> {
 		let message = `${res.status} ${res.statusText}`;
 		if (typeof details === 'string' && details.trim()) {
 			message = `${message} — ${details}`;
-		} else if (isRecord(details) && typeof details.message === 'string') {
-			message = `${message} — ${details.message}`;
+		} else if (isRecord(details) && typeof details.detail === 'string') {
+			message = `${message} — ${details.detail}`;
 		}
 
 		throw new ApiError({
@@ -407,8 +416,12 @@ export function updateProject(projectId: string, body: UpdateProjectRequest) {
 	});
 }
 
-export function deleteProject(projectId: string) {
-	return apiFetch<void>(`/projects/${encodeURIComponent(projectId)}`, {
+export function deleteProject(
+	projectId: string,
+	opts: { cascade?: boolean } = {},
+) {
+	const qs = opts.cascade ? '?cascade=true' : '';
+	return apiFetch<void>(`/projects/${encodeURIComponent(projectId)}${qs}`, {
 		method: 'DELETE',
 	});
 }
@@ -160,7 +160,8 @@ export function ProjectsPage() {
 		setLastError(null);
 
 		try {
-			await deleteProject(project.id);
+			// The confirmation dialogs already warn that runs are deleted too
+			await deleteProject(project.id, { cascade: true });
 			await refresh();
 		} catch (e) {
 			setLastError(e);